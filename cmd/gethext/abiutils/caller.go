@@ -0,0 +1,75 @@
+package abiutils
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	ConfidenceBytecode  = "bytecode"  // All functions of the interface are found in the contract bytecode
+	ConfidenceConfirmed = "confirmed" // The contract also reports the interface by ERC-165 supportsInterface
+
+	stateCallGas = 100000 // Gas limit of read-only calls, EIP-165 requires supportsInterface to use less than 30000
+)
+
+var (
+	erc165InterfaceID     = [4]byte{0x01, 0xff, 0xc9, 0xa7}
+	invalidInterfaceID    = [4]byte{0xff, 0xff, 0xff, 0xff}
+	supportsInterfaceFunc = crypto.Keccak256([]byte("supportsInterface(bytes4)"))[:4]
+	trueWord              = common.LeftPadBytes([]byte{1}, 32)
+)
+
+// StateCaller runs read-only calls against the state of an EVM, it is a ProxyState and
+// a ContractCaller. All state changes made by the calls, including the accessed
+// addresses and slots, are reverted so it can be used while a transaction is executed.
+type StateCaller struct {
+	vm.StateDB
+	evm *vm.EVM
+}
+
+// CallContract calls the contract with the given input and returns its output
+func (c *StateCaller) CallContract(to common.Address, input []byte) ([]byte, error) {
+	snapshot := c.Snapshot()
+	defer c.RevertToSnapshot(snapshot)
+	ret, _, err := c.evm.StaticCall(vm.AccountRef(common.Address{}), to, input, stateCallGas)
+	return ret, err
+}
+
+// NewStateCaller returns a caller using the block and transaction context and the state
+// of the given EVM, calls are not traced by the tracer of the EVM
+func NewStateCaller(env *vm.EVM) *StateCaller {
+	return &StateCaller{
+		StateDB: env.StateDB,
+		evm:     vm.NewEVM(env.Context, env.TxContext, env.StateDB, env.ChainConfig(), vm.Config{}),
+	}
+}
+
+func supportsInterface(caller ContractCaller, addr common.Address, id [4]byte) bool {
+	input := make([]byte, 4+32)
+	copy(input, supportsInterfaceFunc)
+	copy(input[4:], id[:])
+	ret, err := caller.CallContract(addr, input)
+	return err == nil && bytes.Equal(ret, trueWord)
+}
+
+// ConfirmInterfaces calls supportsInterface of a contract implementing ERC-165 to
+// confirm the interfaces detected from its bytecode, confirmed interfaces have
+// ConfidenceConfirmed. Interfaces without a standard identifier like IERC20 stay
+// ConfidenceBytecode.
+func (p *ABIParser) ConfirmInterfaces(caller ContractCaller, addr common.Address, contract *Contract) {
+	if _, ok := contract.Implements["IERC165"]; !ok {
+		return
+	}
+	// detection steps of EIP-165, the contract must reject the invalid identifier
+	if !supportsInterface(caller, addr, erc165InterfaceID) || supportsInterface(caller, addr, invalidInterfaceID) {
+		return
+	}
+	for name, intf := range contract.Implements {
+		if supportsInterface(caller, addr, intf.ID()) {
+			contract.Confidence[name] = ConfidenceConfirmed
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package abiutils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testERC165Caller answers supportsInterface calls with the given interface ids
+type testERC165Caller map[[4]byte]bool
+
+func (c testERC165Caller) CallContract(to common.Address, input []byte) ([]byte, error) {
+	if len(input) != 36 || common.Bytes2Hex(input[:4]) != "01ffc9a7" {
+		return nil, errors.New("execution reverted")
+	}
+	var id [4]byte
+	copy(id[:], input[4:8])
+	if c[id] {
+		return common.LeftPadBytes([]byte{1}, 32), nil
+	}
+	return make([]byte, 32), nil
+}
+
+func TestInterfaceID(t *testing.T) {
+	tests := map[string]string{
+		"IERC165":        "01ffc9a7",
+		"IERC721":        "80ac58cd",
+		"IERC1155":       "d9b67a26",
+		"IAccessControl": "7965db0b",
+		"IERC20":         "36372b07",
+	}
+	for name, id := range tests {
+		intf := defaultInterfaces[name]
+		intfID := intf.ID()
+		assert.Equal(t, id, common.Bytes2Hex(intfID[:]), name)
+	}
+}
+
+func TestConfirmInterfaces(t *testing.T) {
+	parser := NewParser(rawdb.NewMemoryDatabase())
+	ids := []string{}
+	for _, name := range []string{"IERC165", "IERC721", "IOwnable"} {
+		intf := defaultInterfaces[name]
+		for id, elem := range intf.Elements {
+			if elem.Type == "function" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	ifs, _ := parser.ParseInterfaces(ids)
+	newContract := func() *Contract {
+		contract, err := NewContract("", nil, ifs)
+		require.NoError(t, err)
+		return contract
+	}
+
+	contract := newContract()
+	assert.Equal(t, map[string]string{
+		"IERC165":  ConfidenceBytecode,
+		"IERC721":  ConfidenceBytecode,
+		"IOwnable": ConfidenceBytecode,
+	}, contract.Confidence)
+
+	caller := testERC165Caller{erc165InterfaceID: true, {0x80, 0xac, 0x58, 0xcd}: true}
+	parser.ConfirmInterfaces(caller, common.Address{}, contract)
+	assert.Equal(t, map[string]string{
+		"IERC165":  ConfidenceConfirmed,
+		"IERC721":  ConfidenceConfirmed,
+		"IOwnable": ConfidenceBytecode,
+	}, contract.Confidence)
+
+	// contracts which claim every interface do not implement ERC-165
+	caller[invalidInterfaceID] = true
+	contract = newContract()
+	parser.ConfirmInterfaces(caller, common.Address{}, contract)
+	assert.Equal(t, ConfidenceBytecode, contract.Confidence["IERC721"])
+}
+
+func TestParseInterfacesCatalogue(t *testing.T) {
+	pairSigs := []string{}
+	for _, name := range []string{"IERC20", "IERC20Permit", "IUniswapV2Pair"} {
+		intf := defaultInterfaces[name]
+		for id, elem := range intf.Elements {
+			if elem.Type == "function" {
+				pairSigs = append(pairSigs, id)
+			}
+		}
+	}
+	parser := NewParser(rawdb.NewMemoryDatabase())
+	ifs, remaining := parser.ParseInterfaces(pairSigs)
+	names := []string{}
+	for _, intf := range ifs {
+		names = append(names, intf.Name)
+	}
+	assert.ElementsMatch(t, []string{"IERC20", "IERC20Permit", "IUniswapV2Pair"}, names)
+	assert.Empty(t, remaining)
+}
+
+func TestStateCaller(t *testing.T) {
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	addr := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	statedb.SetCode(addr, common.FromHex("600160005260206000f3")) // return uint256(1)
+	env := vm.NewEVM(vm.BlockContext{BlockNumber: common.Big1, Time: common.Big1, Difficulty: common.Big0}, vm.TxContext{}, statedb, params.TestChainConfig, vm.Config{})
+
+	caller := NewStateCaller(env)
+	assert.True(t, supportsInterface(caller, addr, erc165InterfaceID))
+	assert.False(t, statedb.AddressInAccessList(addr))
+	assert.Equal(t, common.FromHex("600160005260206000f3"), caller.GetCode(addr))
+}
@@ -7,8 +7,10 @@ import (
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/cmd/gethext/extdb"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
@@ -16,9 +18,26 @@ import (
 
 type ABIElements []ABIElement
 
+// layout returns the identifier of the element, events also tell their indexed
+// arguments as events of the same signature can index different arguments, e.g.
+// Transfer(address,address,uint256) of ERC-20 and ERC-721
+func (e *ABIElement) layout() string {
+	if e.Type != "event" {
+		return e.Identifier()
+	}
+	types := make([]string, len(e.Inputs))
+	for i, arg := range e.Inputs {
+		types[i] = arg.Type.String()
+		if arg.Indexed {
+			types[i] += " indexed"
+		}
+	}
+	return fmt.Sprintf("%v(%v)", e.Name, strings.Join(types, ","))
+}
+
 func (list *ABIElements) addUnique(item ABIElement) bool {
 	for _, entry := range *list {
-		if item.Identifier() == entry.Identifier() {
+		if item.layout() == entry.layout() {
 			return false
 		}
 	}
@@ -62,45 +81,77 @@ func UnmarshalABI(data []byte) ([]ABIElement, error) {
 	return list, err
 }
 
-func readFourBytesABIs(db ethdb.Database, fourbytes []byte) ABIElements {
+// sigTable is an extdb table of ABI elements keyed by signature hash
+type sigTable struct {
+	name     string // Name of the table used in logs
+	elemType string // Type of the ABI elements in the table
+	keyLen   int    // Length of the signature hash
+	read     func(db ethdb.KeyValueReader, key []byte) []byte
+	write    func(db ethdb.KeyValueWriter, key []byte, data []byte)
+}
+
+var (
+	fourBytesTable = sigTable{"4-bytes", "function", 4, extdb.ReadFourBytesABIs, extdb.WriteFourBytesABIs}
+	eventsTable    = sigTable{"event", "event", common.HashLength, readEventABIs, writeEventABIs}
+	errorsTable    = sigTable{"error", "error", 4, extdb.ReadErrorABIs, extdb.WriteErrorABIs}
+)
+
+func readEventABIs(db ethdb.KeyValueReader, topic []byte) []byte {
+	return extdb.ReadEventABIs(db, common.BytesToHash(topic))
+}
+
+func writeEventABIs(db ethdb.KeyValueWriter, topic []byte, data []byte) {
+	extdb.WriteEventABIs(db, common.BytesToHash(topic), data)
+}
+
+func (t *sigTable) readABIs(db ethdb.KeyValueReader, key []byte) ABIElements {
 	ret := ABIElements{}
-	data := extdb.ReadFourBytesABIs(db, fourbytes)
+	data := t.read(db, key)
 	json.Unmarshal(data, &ret)
 	return ret
 }
 
-func import4BytesABIs(db ethdb.Database, abis map[string]ABIElements, override bool) (int, error) {
+// importABIs writes the ABI elements keyed by hex encoded signature hashes to the
+// table and returns the number of entries which were not in the table. Text
+// signatures are parsed as functions, so they are converted to the element type of
+// the table.
+func (t *sigTable) importABIs(db ethdb.Database, abis map[string]ABIElements, override bool) (int, error) {
 	if len(abis) == 0 {
 		return 0, nil
 	}
-	imported := 0
+	added := 0
 	batch := db.NewBatch()
 	for id, list := range abis {
-		fourbytes, err := hex.DecodeString(id)
-		if err != nil {
+		key, err := hex.DecodeString(strings.TrimPrefix(id, "0x"))
+		if err != nil || len(key) != t.keyLen {
+			log.Warn(fmt.Sprintf("Skipped invalid %s signature", t.name), "id", id)
 			continue
 		}
-		elems := list
-		if !override {
-			elems = readFourBytesABIs(db, fourbytes)
-			modified := false
-			for _, entry := range list {
-				modified = elems.addUnique(entry) || modified
+		existing := t.readABIs(db, key)
+		known := append(ABIElements{}, existing...)
+		elems, modified := existing, override
+		if override {
+			elems = ABIElements{}
+		}
+		for _, entry := range list {
+			if entry.Type == "" || entry.Type == "function" {
+				entry.Type = t.elemType
 			}
-			if !modified {
-				elems = nil
+			if known.addUnique(entry) {
+				added++
+				modified = true
 			}
+			elems.addUnique(entry)
 		}
-		if len(elems) > 0 {
+		if modified && len(elems) > 0 {
 			data, err := json.Marshal(elems)
 			if err != nil {
 				return 0, err
 			}
-			extdb.WriteFourBytesABIs(db, fourbytes, data)
-			imported += len(elems)
+			t.write(batch, key, data)
 		}
 	}
-	return imported, batch.Write()
+	return added, batch.Write()
 }
 
 // rawInterface is data struct hold information about an contract interface to be stored in extdb
@@ -145,28 +196,43 @@ func importInterfaces(db ethdb.Database, ifs map[string]ABIElements, override bo
 	return len(importList), numEntries, batch.Write()
 }
 
-func ImportABIsData(db ethdb.Database, reader io.Reader, override bool) error {
-	dec := json.NewDecoder(reader)
-	var data struct {
-		FourBytes  map[string]ABIElements `json:"4bytes"`     // 4-bytes sigs to abi list
-		Interfaces map[string]ABIElements `json:"interfaces"` // interface name to abi list
-	}
-	if err := dec.Decode(&data); err != nil {
-		return err
+// ImportSignatureData writes the signatures and interfaces to the database, existing
+// signatures are kept unless override is set. Returns the number of new entries.
+func ImportSignatureData(db ethdb.Database, data *SignatureData, override bool) (int, error) {
+	sections := []struct {
+		table *sigTable
+		abis  map[string]ABIElements
+	}{
+		{&fourBytesTable, data.FourBytes},
+		{&eventsTable, data.Events},
+		{&errorsTable, data.Errors},
 	}
-
-	abiCount, err := import4BytesABIs(db, data.FourBytes, override)
-	if err != nil {
-		log.Error("Could not import 4-bytes ABI entries", "error", err)
-		return err
+	total := 0
+	for _, section := range sections {
+		abiCount, err := section.table.importABIs(db, section.abis, override)
+		if err != nil {
+			log.Error(fmt.Sprintf("Could not import %s ABI entries", section.table.name), "error", err)
+			return total, err
+		}
+		log.Info(fmt.Sprintf("Imported %d new %s ABI entries", abiCount, section.table.name))
+		total += abiCount
 	}
-	log.Info(fmt.Sprintf("Imported %d 4-bytes ABI entries", abiCount))
 
 	ifCount, abiCount, err := importInterfaces(db, data.Interfaces, override)
 	if err != nil {
 		log.Error("Could not import contract interfaces", "error", err)
+		return total, err
+	}
+	log.Info(fmt.Sprintf("Imported %d contract interfaces, total ABI entries: %d", ifCount, abiCount))
+	return total + abiCount, nil
+}
+
+func ImportABIsData(db ethdb.Database, reader io.Reader, override bool) error {
+	dec := json.NewDecoder(reader)
+	data := NewSignatureData()
+	if err := dec.Decode(data); err != nil {
 		return err
 	}
-	log.Info(fmt.Sprintf("Imported %d contract interfaces, total ABI entries: %d", abiCount, ifCount))
-	return nil
+	_, err := ImportSignatureData(db, data, override)
+	return err
 }
@@ -3,7 +3,14 @@ package abiutils
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestAbiListUnmarshalJSON(t *testing.T) {
@@ -50,3 +57,89 @@ func TestAbiListUnmarshalJSON(t *testing.T) {
 		fmt.Println(val)
 	}
 }
+
+func TestReadSignatureFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+	tests := []struct {
+		path      string
+		fourbytes []string
+		events    []string
+		errors    []string
+	}{
+		{
+			path:      writeFile("sigs.txt", "# signatures\ntransfer(address,uint256)\n\nevent Transfer(address,address,uint256)\nerror Unauthorized(address)\ninvalid\n"),
+			fourbytes: []string{"a9059cbb"},
+			events:    []string{"ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"},
+			errors:    []string{"8e4a23d6"},
+		},
+		{
+			path:      writeFile("export.csv", "id,created_at,text_signature,hex_signature,bytes_signature\n1,2016-07-09,\"transfer(address,uint256)\",0xa9059cbb,x\n2,2016-07-09,\"approve(address,uint256)\",0x095ea7b3,x\n"),
+			fourbytes: []string{"095ea7b3", "a9059cbb"},
+		},
+		{
+			path:      writeFile("export.json", `{"count":2,"results":[{"text_signature":"balanceOf(address)","hex_signature":"0x70a08231"},{"text_signature":"Transfer(address,address,uint256)","hex_signature":"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}]}`),
+			fourbytes: []string{"70a08231"},
+			events:    []string{"ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"},
+		},
+		{
+			path:      writeFile("combined.json", `{"contracts":{"Token.sol:Token":{"abi":"[{\"inputs\":[],\"name\":\"totalSupply\",\"outputs\":[{\"name\":\"\",\"type\":\"uint256\"}],\"stateMutability\":\"view\",\"type\":\"function\"}]"}}}`),
+			fourbytes: []string{"18160ddd"},
+		},
+	}
+	for _, tt := range tests {
+		data, err := ReadSignatureFile(tt.path)
+		require.NoError(t, err, tt.path)
+		assert.ElementsMatch(t, tt.fourbytes, mapKeys(data.FourBytes), tt.path)
+		assert.ElementsMatch(t, tt.events, mapKeys(data.Events), tt.path)
+		assert.ElementsMatch(t, tt.errors, mapKeys(data.Errors), tt.path)
+	}
+
+	// Hardhat and Foundry artifacts
+	artifacts := filepath.Join(dir, "artifacts")
+	writeFile("artifacts/contracts/Token.sol/Token.json", `{"contractName":"Token","abi":[{"inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"stateMutability":"nonpayable","type":"function"},{"inputs":[{"name":"account","type":"address"}],"name":"Unauthorized","type":"error"}]}`)
+	writeFile("artifacts/contracts/Token.sol/Token.dbg.json", `{"buildInfo":"../../build-info/1.json"}`)
+	writeFile("artifacts/out/Vault.sol/Vault.json", `{"abi":[{"inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"name":"transfer","outputs":[],"stateMutability":"nonpayable","type":"function"},{"anonymous":false,"inputs":[{"indexed":true,"name":"from","type":"address"},{"indexed":true,"name":"to","type":"address"},{"indexed":false,"name":"value","type":"uint256"}],"name":"Transfer","type":"event"}],"bytecode":{"object":"0x"}}`)
+	data, err := ReadSignatureFile(artifacts)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a9059cbb"}, mapKeys(data.FourBytes))
+	assert.Len(t, data.FourBytes["a9059cbb"], 1)
+	assert.ElementsMatch(t, []string{"ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}, mapKeys(data.Events))
+	assert.ElementsMatch(t, []string{"8e4a23d6"}, mapKeys(data.Errors))
+}
+
+func TestImportSignatureDataNewEntries(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	data := NewSignatureData()
+	for _, sig := range []string{"transfer(address,uint256)", "approve(address,uint256)", "event Transfer(address,address,uint256)"} {
+		elem, err := ParseSignature(sig)
+		require.NoError(t, err)
+		assert.True(t, data.Add(elem))
+		assert.False(t, data.Add(elem))
+	}
+	added, err := ImportSignatureData(db, data, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, added)
+
+	// only the new signature is counted
+	elem, err := ParseSignature("transferFrom(address,address,uint256)")
+	require.NoError(t, err)
+	data.Add(elem)
+	added, err = ImportSignatureData(db, data, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, added)
+	assert.Len(t, fourBytesTable.readABIs(db, common.FromHex("a9059cbb")), 1)
+}
+
+func mapKeys(m map[string]ABIElements) []string {
+	ret := []string{}
+	for key := range m {
+		ret = append(ret, key)
+	}
+	return ret
+}
@@ -0,0 +1,314 @@
+package abiutils
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const decodedContractCacheSize = 4096
+
+var (
+	errorSelector = crypto.Keccak256([]byte("Error(string)"))[:4]
+	panicSelector = crypto.Keccak256([]byte("Panic(uint256)"))[:4]
+
+	// panicReasons maps solidity panic codes to their descriptions
+	panicReasons = map[uint64]string{
+		0x00: "generic panic",
+		0x01: "assert(false)",
+		0x11: "arithmetic underflow or overflow",
+		0x12: "division or modulo by zero",
+		0x21: "enum overflow",
+		0x22: "invalid encoded storage byte array accessed",
+		0x31: "out-of-bounds array access; popping on an empty array",
+		0x32: "out-of-bounds access of an array or bytesN",
+		0x41: "out of memory",
+		0x51: "uninitialized function",
+	}
+)
+
+// DecodedRevert holds decoded revert data of a failed call
+type DecodedRevert struct {
+	Kind      string                 `json:"kind"`                // One of "error", "panic" or "custom"
+	Reason    string                 `json:"reason,omitempty"`    // Revert reason or description of the panic code
+	Code      *big.Int               `json:"code,omitempty"`      // Panic code
+	Signature string                 `json:"signature,omitempty"` // Signature of the custom error
+	Args      map[string]interface{} `json:"args,omitempty"`      // Decoded arguments of the custom error
+}
+
+// DecodedLog holds ABI decoded data of a contract log
+type DecodedLog struct {
+	Signature string                 `json:"signature"`      // Matched event signature, e.g Transfer(address,address,uint256)
+	Args      map[string]interface{} `json:"args,omitempty"` // Decoded event arguments from topics and data
+}
+
+// DecodedCall holds ABI decoded data of a contract call
+type DecodedCall struct {
+	Signature  string                 `json:"signature,omitempty"`  // Matched method signature, e.g transfer(address,uint256)
+	Inputs     map[string]interface{} `json:"inputs,omitempty"`     // Decoded call arguments
+	Outputs    map[string]interface{} `json:"outputs,omitempty"`    // Decoded return values
+	Revert     *DecodedRevert         `json:"revert,omitempty"`     // Decoded revert data if the call failed
+	Interfaces []string               `json:"interfaces,omitempty"` // Known interfaces implemented by the callee
+
+	method *abi.Method
+}
+
+// Method returns the matched method of the call, nil if the method is unknown
+func (c *DecodedCall) Method() *abi.Method {
+	return c.method
+}
+
+// decodedContract is the cached decoding data of a contract code
+type decodedContract struct {
+	contract   *Contract
+	interfaces []string
+	methods    map[[4]byte]*abi.Method // Resolved methods by selector, nil value if the selector is unknown
+	mtx        sync.Mutex
+}
+
+// CallDecoder decodes contract calls using interfaces detected from contract code
+// and 4-bytes signatures database. Decode results are cached by code hash.
+type CallDecoder struct {
+	parser *ABIParser
+	cache  *lru.Cache
+}
+
+func unpackArguments(args abi.Arguments, data []byte) (map[string]interface{}, error) {
+	values, err := args.Unpack(data)
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]interface{}, len(values))
+	for idx, val := range values {
+		name := args[idx].Name
+		if name == "" {
+			name = fmt.Sprintf("arg%d", idx)
+		}
+		ret[name] = val
+	}
+	return ret, nil
+}
+
+func (d *CallDecoder) loadContract(codeHash common.Hash, code []byte) *decodedContract {
+	if cached, ok := d.cache.Get(codeHash); ok {
+		return cached.(*decodedContract)
+	}
+	entry := &decodedContract{methods: make(map[[4]byte]*abi.Method)}
+	if contract, err := d.parser.ParseContract(code); err == nil {
+		entry.contract = contract
+		for name := range contract.Implements {
+			entry.interfaces = append(entry.interfaces, name)
+		}
+		sort.Strings(entry.interfaces)
+	}
+	d.cache.Add(codeHash, entry)
+	return entry
+}
+
+// resolveMethod finds the method matching the call input, methods of contract are looked
+// up first, then 4-bytes signatures which can unpack the input
+func (d *CallDecoder) resolveMethod(entry *decodedContract, input []byte) *abi.Method {
+	var selector [4]byte
+	copy(selector[:], input[:4])
+
+	entry.mtx.Lock()
+	defer entry.mtx.Unlock()
+	if method, exist := entry.methods[selector]; exist {
+		return method
+	}
+	var resolved *abi.Method
+	if entry.contract != nil {
+		if method, err := entry.contract.MethodById(selector[:]); err == nil {
+			resolved = method
+		}
+	}
+	if resolved == nil {
+		for _, elem := range d.parser.LookupFourBytes(common.Bytes2Hex(selector[:])) {
+			if elem.Type != "function" {
+				continue
+			}
+			method := abi.NewMethod(elem.Name, elem.Name, abi.Function, elem.StateMutability, false, false, elem.Inputs, elem.Outputs)
+			if _, err := method.Inputs.Unpack(input[4:]); err == nil {
+				resolved = &method
+				break
+			}
+		}
+	}
+	entry.methods[selector] = resolved
+	return resolved
+}
+
+// DecodeInput decodes the method and arguments of a call to a contract with the given code
+func (d *CallDecoder) DecodeInput(codeHash common.Hash, code []byte, input []byte) *DecodedCall {
+	entry := d.loadContract(codeHash, code)
+	call := &DecodedCall{Interfaces: entry.interfaces}
+	if len(input) < 4 {
+		return call
+	}
+	if method := d.resolveMethod(entry, input); method != nil {
+		call.method = method
+		call.Signature = method.Sig
+		call.Inputs, _ = unpackArguments(method.Inputs, input[4:])
+	}
+	return call
+}
+
+// DecodeOutput decodes the return values of a successful call or the revert data of a failed call
+func (d *CallDecoder) DecodeOutput(codeHash common.Hash, code []byte, call *DecodedCall, output []byte, failed bool) {
+	if failed {
+		entry := d.loadContract(codeHash, code)
+		call.Revert = d.DecodeRevert(entry.contract, output)
+		return
+	}
+	if call.method != nil && len(output) > 0 {
+		call.Outputs, _ = unpackArguments(call.method.Outputs, output)
+	}
+}
+
+// DecodeRevert decodes Error(string), Panic(uint256) or custom error revert data. Custom errors
+// are looked up in the contract ABI first, then in 4-bytes signatures
+func (d *CallDecoder) DecodeRevert(contract *Contract, data []byte) *DecodedRevert {
+	if len(data) < 4 {
+		return nil
+	}
+	selector := data[:4]
+	switch {
+	case bytes.Equal(selector, errorSelector):
+		if reason, err := abi.UnpackRevert(data); err == nil {
+			return &DecodedRevert{Kind: "error", Reason: reason}
+		}
+	case bytes.Equal(selector, panicSelector):
+		typ, _ := abi.NewType("uint256", "", nil)
+		if values, err := (abi.Arguments{{Type: typ}}).Unpack(data[4:]); err == nil {
+			code := values[0].(*big.Int)
+			reason, known := panicReasons[code.Uint64()]
+			if !known || !code.IsUint64() {
+				reason = "unknown panic code"
+			}
+			return &DecodedRevert{Kind: "panic", Reason: reason, Code: code}
+		}
+	default:
+		if contract != nil {
+			for _, abiErr := range contract.Errors {
+				if bytes.Equal(abiErr.ID[:4], selector) {
+					if args, err := unpackArguments(abiErr.Inputs, data[4:]); err == nil {
+						return &DecodedRevert{Kind: "custom", Signature: abiErr.Sig, Args: args}
+					}
+				}
+			}
+		}
+		// errors were imported to the 4-bytes table before it had its own table
+		id := common.Bytes2Hex(selector)
+		for _, elems := range [][]ABIElement{d.parser.LookupError(id), d.parser.LookupFourBytes(id)} {
+			for _, elem := range elems {
+				if args, err := unpackArguments(elem.Inputs, data[4:]); err == nil {
+					return &DecodedRevert{Kind: "custom", Signature: elem.Identifier(), Args: args}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// unpackEvent decodes the indexed arguments from topics and the others from data,
+// topics does not include the event topic
+func unpackEvent(args abi.Arguments, topics []common.Hash, data []byte) (map[string]interface{}, error) {
+	named := make(abi.Arguments, len(args))
+	indexed := abi.Arguments{}
+	for idx, arg := range args {
+		if arg.Name == "" {
+			arg.Name = fmt.Sprintf("arg%d", idx)
+		}
+		named[idx] = arg
+		if arg.Indexed {
+			indexed = append(indexed, arg)
+		}
+	}
+	ret := make(map[string]interface{}, len(args))
+	if err := abi.ParseTopicsIntoMap(ret, indexed, topics); err != nil {
+		return nil, err
+	}
+	if err := named.UnpackIntoMap(ret, data); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// fitIndexed marks the arguments indexed to match the number of topics. Text signatures
+// do not tell which arguments are indexed, the first arguments are marked as most events
+// index their leading arguments, e.g. Transfer(address indexed,address indexed,uint256).
+// Arguments with indexed flags are refitted the same way if the flags do not match,
+// false is returned in that case.
+func fitIndexed(args abi.Arguments, numIndexed int) (abi.Arguments, bool) {
+	if numIndexed > len(args) {
+		return nil, false
+	}
+	count := 0
+	for _, arg := range args {
+		if arg.Indexed {
+			count++
+		}
+	}
+	if count == numIndexed {
+		return args, true
+	}
+	ret := make(abi.Arguments, len(args))
+	copy(ret, args)
+	for idx := range ret {
+		ret[idx].Indexed = idx < numIndexed
+	}
+	return ret, count == 0
+}
+
+// DecodeEvent decodes a log emitted by the contract, the event is looked up in the
+// contract ABI first, then in event signatures. Anonymous events cannot be decoded.
+func (d *CallDecoder) DecodeEvent(contract *Contract, topics []common.Hash, data []byte) *DecodedLog {
+	if len(topics) == 0 {
+		return nil
+	}
+	if contract != nil {
+		for _, event := range contract.Events {
+			if event.ID == topics[0] {
+				if args, err := unpackEvent(event.Inputs, topics[1:], data); err == nil {
+					return &DecodedLog{Signature: event.Sig, Args: args}
+				}
+			}
+		}
+	}
+	// signatures whose indexed flags do not match the topics are tried last
+	elems := d.parser.LookupEvent(topics[0])
+	for _, exact := range []bool{true, false} {
+		for _, elem := range elems {
+			inputs, fit := fitIndexed(elem.Inputs, len(topics)-1)
+			if inputs == nil || fit != exact {
+				continue
+			}
+			if args, err := unpackEvent(inputs, topics[1:], data); err == nil {
+				return &DecodedLog{Signature: elem.Identifier(), Args: args}
+			}
+		}
+	}
+	return nil
+}
+
+// DecodeLog decodes a log emitted by a contract with the given code
+func (d *CallDecoder) DecodeLog(codeHash common.Hash, code []byte, log *types.Log) *DecodedLog {
+	entry := d.loadContract(codeHash, code)
+	return d.DecodeEvent(entry.contract, log.Topics, log.Data)
+}
+
+func NewCallDecoder(parser *ABIParser) *CallDecoder {
+	cache, _ := lru.New(decodedContractCacheSize)
+	return &CallDecoder{
+		parser: parser,
+		cache:  cache,
+	}
+}
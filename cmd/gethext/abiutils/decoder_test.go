@@ -0,0 +1,127 @@
+package abiutils
+
+import (
+	"encoding/hex"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/status-im/keycard-go/hexutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallDecoderDecodeInput(t *testing.T) {
+	data, err := os.ReadFile("./tests/erc20.bin")
+	require.NoError(t, err)
+	code, err := hex.DecodeString(string(data))
+	require.NoError(t, err)
+
+	decoder := NewCallDecoder(NewParser(rawdb.NewMemoryDatabase()))
+	input := hexutils.HexToBytes("a9059cbb000000000000000000000000a73bc58956dc002ab777452aa0b60d37b4f6d6370000000000000000000000000000000000000000000000000de0b6b3a7640000")
+	call := decoder.DecodeInput(crypto.Keccak256Hash(code), code, input)
+	assert.Contains(t, call.Interfaces, "IERC20")
+	assert.Equal(t, "transfer(address,uint256)", call.Signature)
+	assert.Equal(t, common.HexToAddress("0xA73BC58956dC002Ab777452aa0b60d37B4f6d637"), call.Inputs["to"])
+	assert.Equal(t, big.NewInt(1000000000000000000), call.Inputs["amount"])
+
+	output := common.LeftPadBytes([]byte{1}, 32)
+	decoder.DecodeOutput(crypto.Keccak256Hash(code), code, call, output, false)
+	assert.Equal(t, true, call.Outputs["arg0"])
+}
+
+func TestCallDecoderDecodeRevert(t *testing.T) {
+	decoder := NewCallDecoder(NewParser(rawdb.NewMemoryDatabase()))
+
+	// Error("insufficient balance")
+	stringTy, _ := abi.NewType("string", "", nil)
+	packed, err := (abi.Arguments{{Type: stringTy}}).Pack("insufficient balance")
+	require.NoError(t, err)
+	errData := append(common.CopyBytes(errorSelector), packed...)
+	revert := decoder.DecodeRevert(nil, errData)
+	require.NotNil(t, revert)
+	assert.Equal(t, "error", revert.Kind)
+	assert.Equal(t, "insufficient balance", revert.Reason)
+
+	// Panic(0x11)
+	panicData := append(common.CopyBytes(panicSelector), common.LeftPadBytes([]byte{0x11}, 32)...)
+	revert = decoder.DecodeRevert(nil, panicData)
+	require.NotNil(t, revert)
+	assert.Equal(t, "panic", revert.Kind)
+	assert.Equal(t, big.NewInt(0x11), revert.Code)
+	assert.Equal(t, "arithmetic underflow or overflow", revert.Reason)
+
+	assert.Nil(t, decoder.DecodeRevert(nil, []byte{0xde, 0xad}))
+}
+
+func TestCallDecoderDecodeEvent(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	data := `{
+		"events": {
+			"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef": "Transfer(address,address,uint256)"
+		},
+		"errors": {
+			"e450d38c": "ERC20InsufficientBalance(address,uint256,uint256)"
+		}
+	}`
+	require.NoError(t, ImportABIsData(db, strings.NewReader(data), false))
+	decoder := NewCallDecoder(NewParser(db))
+
+	var (
+		from   = common.HexToAddress("0x64108bbDe14CC327EBba159e1937A9791Ce0e8a9")
+		to     = common.HexToAddress("0xc58Bb74606b73c5043B75d7Aa25ebe1D5D4E7c72")
+		topic  = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+		amount = common.LeftPadBytes(big.NewInt(1000).Bytes(), 32)
+	)
+	decoded := decoder.DecodeEvent(nil, []common.Hash{topic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())}, amount)
+	require.NotNil(t, decoded)
+	assert.Equal(t, "Transfer(address,address,uint256)", decoded.Signature)
+	assert.Equal(t, from, decoded.Args["arg0"])
+	assert.Equal(t, to, decoded.Args["arg1"])
+	assert.Equal(t, big.NewInt(1000), decoded.Args["arg2"])
+
+	// ERC721 transfers index the token id too
+	decoded = decoder.DecodeEvent(nil, []common.Hash{topic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes()), common.BytesToHash(amount)}, nil)
+	require.NotNil(t, decoded)
+	assert.Equal(t, big.NewInt(1000), decoded.Args["arg2"])
+
+	assert.Nil(t, decoder.DecodeEvent(nil, []common.Hash{common.HexToHash("0x01")}, nil))
+
+	selector := crypto.Keccak256([]byte("ERC20InsufficientBalance(address,uint256,uint256)"))[:4]
+	errData := append(common.CopyBytes(selector), common.LeftPadBytes(from.Bytes(), 32)...)
+	errData = append(errData, common.LeftPadBytes([]byte{1}, 32)...)
+	errData = append(errData, common.LeftPadBytes([]byte{2}, 32)...)
+	revert := decoder.DecodeRevert(nil, errData)
+	require.NotNil(t, revert)
+	assert.Equal(t, "custom", revert.Kind)
+	assert.Equal(t, "ERC20InsufficientBalance(address,uint256,uint256)", revert.Signature)
+	assert.Equal(t, from, revert.Args["arg0"])
+}
+
+func TestCallDecoderDecodeTransferEvents(t *testing.T) {
+	// IERC20 and IERC721 Transfer events share the signature but not the indexed arguments
+	decoder := NewCallDecoder(NewParser(rawdb.NewMemoryDatabase()))
+	var (
+		from  = common.HexToAddress("0x64108bbDe14CC327EBba159e1937A9791Ce0e8a9")
+		to    = common.HexToAddress("0xc58Bb74606b73c5043B75d7Aa25ebe1D5D4E7c72")
+		topic = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+		value = common.LeftPadBytes(big.NewInt(1000).Bytes(), 32)
+	)
+	assert.Len(t, decoder.parser.LookupEvent(topic), 2)
+
+	erc20 := decoder.DecodeEvent(nil, []common.Hash{topic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())}, value)
+	require.NotNil(t, erc20)
+	assert.Equal(t, from, erc20.Args["from"])
+	assert.Equal(t, to, erc20.Args["to"])
+	assert.Equal(t, big.NewInt(1000), erc20.Args["value"])
+
+	erc721 := decoder.DecodeEvent(nil, []common.Hash{topic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes()), common.BytesToHash(value)}, nil)
+	require.NotNil(t, erc721)
+	assert.Equal(t, from, erc721.Args["from"])
+	assert.Equal(t, big.NewInt(1000), erc721.Args["tokenId"])
+}
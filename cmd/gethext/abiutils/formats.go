@@ -0,0 +1,326 @@
+package abiutils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// SignatureData holds signatures to be imported into the database, it is the
+// format of the import file: 4-bytes, events and errors sections map signature
+// hashes to ABI elements, the interfaces section maps names to interface ABIs
+type SignatureData struct {
+	FourBytes  map[string]ABIElements `json:"4bytes"`     // 4-bytes sigs to abi list
+	Events     map[string]ABIElements `json:"events"`     // event topics to abi list
+	Errors     map[string]ABIElements `json:"errors"`     // 4-bytes custom error sigs to abi list
+	Interfaces map[string]ABIElements `json:"interfaces"` // interface name to abi list
+}
+
+func NewSignatureData() *SignatureData {
+	return &SignatureData{
+		FourBytes:  make(map[string]ABIElements),
+		Events:     make(map[string]ABIElements),
+		Errors:     make(map[string]ABIElements),
+		Interfaces: make(map[string]ABIElements),
+	}
+}
+
+func addToSection(section map[string]ABIElements, id string, elem ABIElement) bool {
+	list := section[id]
+	added := list.addUnique(elem)
+	section[id] = list
+	return added
+}
+
+// Add adds the element to the section of its type keyed by its signature hash,
+// returns false if the element is a duplicate or has no signature
+func (d *SignatureData) Add(elem ABIElement) bool {
+	switch elem.Type {
+	case "function":
+		return addToSection(d.FourBytes, FourBytesSigOf(elem.Identifier()), elem)
+	case "event":
+		return addToSection(d.Events, common.Bytes2Hex(crypto.Keccak256([]byte(elem.Identifier()))), elem)
+	case "error":
+		return addToSection(d.Errors, FourBytesSigOf(elem.Identifier()), elem)
+	}
+	return false
+}
+
+// Merge adds all signatures and interfaces of other, existing interfaces are kept
+func (d *SignatureData) Merge(other *SignatureData) {
+	sections := []struct{ dst, src map[string]ABIElements }{
+		{d.FourBytes, other.FourBytes},
+		{d.Events, other.Events},
+		{d.Errors, other.Errors},
+	}
+	for _, section := range sections {
+		for id, list := range section.src {
+			for _, elem := range list {
+				addToSection(section.dst, id, elem)
+			}
+		}
+	}
+	for name, abi := range other.Interfaces {
+		if _, exist := d.Interfaces[name]; !exist {
+			d.Interfaces[name] = abi
+		}
+	}
+}
+
+// ParseSignature parses a text signature, e.g "transfer(address,uint256)". Signatures
+// prefixed by "event" or "error" are parsed as events or custom errors.
+func ParseSignature(text string) (ABIElement, error) {
+	typ := "function"
+	text = strings.TrimSpace(text)
+	for _, prefix := range []string{"function", "event", "error"} {
+		if strings.HasPrefix(text, prefix+" ") {
+			typ, text = prefix, strings.TrimSpace(text[len(prefix):])
+			break
+		}
+	}
+	elem, err := ParseMethodSig(text)
+	if err != nil {
+		return ABIElement{}, err
+	}
+	elem.Type = typ
+	return elem, nil
+}
+
+// fourbytesEntry is a signature exported from 4byte.directory, the length of the hex
+// signature tells functions from events
+type fourbytesEntry struct {
+	TextSignature string `json:"text_signature"`
+	HexSignature  string `json:"hex_signature"`
+}
+
+func (e *fourbytesEntry) element() (ABIElement, error) {
+	elem, err := ParseSignature(e.TextSignature)
+	if err != nil {
+		return ABIElement{}, err
+	}
+	if len(common.FromHex(e.HexSignature)) == common.HashLength {
+		elem.Type = "event"
+	}
+	return elem, nil
+}
+
+// solcContract is a compiled contract in Hardhat or Foundry artifacts and solc outputs,
+// solc --combined-json outputs the ABI as a JSON string
+type solcContract struct {
+	ABI json.RawMessage `json:"abi"`
+}
+
+func (c *solcContract) elements() (ABIElements, error) {
+	raw := c.ABI
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		raw = []byte(text)
+	}
+	ret := ABIElements{}
+	err := json.Unmarshal(raw, &ret)
+	return ret, err
+}
+
+// jsonSignatureFile holds all known JSON formats, they are told apart by their fields
+type jsonSignatureFile struct {
+	SignatureData
+	Results   []fourbytesEntry           `json:"results"`   // 4byte.directory API pages
+	ABI       json.RawMessage            `json:"abi"`       // Hardhat and Foundry artifacts
+	Contracts map[string]json.RawMessage `json:"contracts"` // solc --combined-json and standard JSON outputs
+	Output    *struct {
+		Contracts map[string]json.RawMessage `json:"contracts"`
+	} `json:"output"` // Hardhat build info
+}
+
+// addContracts adds the ABIs of solc contracts, which are keyed by "file:name" in
+// combined JSON output or nested by file and name in standard JSON output
+func (d *SignatureData) addContracts(contracts map[string]json.RawMessage) int {
+	count := 0
+	for _, raw := range contracts {
+		contract := solcContract{}
+		if err := json.Unmarshal(raw, &contract); err == nil && len(contract.ABI) > 0 {
+			count += d.addABI(&contract)
+			continue
+		}
+		nested := make(map[string]solcContract)
+		if err := json.Unmarshal(raw, &nested); err != nil {
+			continue
+		}
+		for _, contract := range nested {
+			count += d.addABI(&contract)
+		}
+	}
+	return count
+}
+
+func (d *SignatureData) addABI(contract *solcContract) int {
+	elems, err := contract.elements()
+	if err != nil {
+		log.Debug("Skipped invalid contract ABI", "error", err)
+		return 0
+	}
+	count := 0
+	for _, elem := range elems {
+		if d.Add(elem) {
+			count++
+		}
+	}
+	return count
+}
+
+func (d *SignatureData) readJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		// 4byte.directory exports or ABI files output by solc --abi
+		entries := []fourbytesEntry{}
+		if err := json.Unmarshal(trimmed, &entries); err == nil && len(entries) > 0 && entries[0].TextSignature != "" {
+			d.addFourbytesEntries(entries)
+			return nil
+		}
+		d.addABI(&solcContract{ABI: trimmed})
+		return nil
+	}
+	file := jsonSignatureFile{SignatureData: *NewSignatureData()}
+	if err := json.Unmarshal(trimmed, &file); err != nil {
+		return err
+	}
+	d.Merge(&file.SignatureData)
+	d.addFourbytesEntries(file.Results)
+	if len(file.ABI) > 0 {
+		d.addABI(&solcContract{ABI: file.ABI})
+	}
+	d.addContracts(file.Contracts)
+	if file.Output != nil {
+		d.addContracts(file.Output.Contracts)
+	}
+	return nil
+}
+
+func (d *SignatureData) addFourbytesEntries(entries []fourbytesEntry) {
+	for _, entry := range entries {
+		elem, err := entry.element()
+		if err != nil {
+			log.Debug("Skipped invalid signature", "signature", entry.TextSignature, "error", err)
+			continue
+		}
+		d.Add(elem)
+	}
+}
+
+// readCSV reads 4byte.directory CSV exports, signatures are taken from the
+// text_signature column, or the first column looking like a signature if there is
+// no header
+func (d *SignatureData) readCSV(reader io.Reader) error {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	records, err := csvReader.ReadAll()
+	if err != nil {
+		return err
+	}
+	textCol, hexCol := -1, -1
+	if len(records) > 0 {
+		for idx, name := range records[0] {
+			switch strings.TrimSpace(name) {
+			case "text_signature":
+				textCol = idx
+			case "hex_signature":
+				hexCol = idx
+			}
+		}
+		if textCol >= 0 {
+			records = records[1:]
+		}
+	}
+	for _, record := range records {
+		entry := fourbytesEntry{}
+		for idx, field := range record {
+			if idx == hexCol {
+				entry.HexSignature = field
+			} else if idx == textCol || (textCol < 0 && entry.TextSignature == "" && methodSigRegex.MatchString(field)) {
+				entry.TextSignature = field
+			}
+		}
+		d.addFourbytesEntries([]fourbytesEntry{entry})
+	}
+	return nil
+}
+
+// readText reads a signature per line, empty lines and lines starting with # are skipped
+func (d *SignatureData) readText(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		elem, err := ParseSignature(line)
+		if err != nil {
+			log.Debug("Skipped invalid signature", "signature", line, "error", err)
+			continue
+		}
+		d.Add(elem)
+	}
+	return scanner.Err()
+}
+
+// readArtifacts reads the ABIs of all JSON files in the directory and its
+// subdirectories, e.g Hardhat artifacts or Foundry out directory
+func (d *SignatureData) readArtifacts(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(path)
+		if info.IsDir() || (ext != ".json" && ext != ".abi") || strings.HasSuffix(path, ".dbg.json") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := d.readJSON(data); err != nil {
+			log.Debug("Skipped invalid artifact", "file", path, "error", err)
+		}
+		return nil
+	})
+}
+
+// ReadSignatureFile reads signatures from the file, which can be in the import file
+// format, a 4byte.directory JSON or CSV export, a text file of one signature per line,
+// a compiled contract artifact, or a directory of contract artifacts
+func ReadSignatureFile(path string) (*SignatureData, error) {
+	data := NewSignatureData()
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return data, data.readArtifacts(path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".abi":
+		err = data.readJSON(content)
+	case ".csv":
+		err = data.readCSV(bytes.NewReader(content))
+	default:
+		err = data.readText(bytes.NewReader(content))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	return data, nil
+}
@@ -4,14 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/cmd/gethext/extdb"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/core/asm"
-	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	lru "github.com/hashicorp/golang-lru"
@@ -74,58 +74,17 @@ func ParseMethodSig(str string) (ABIElement, error) {
 	}, nil
 }
 
-// ParseMethodIds parses the contract byte code to get all 4-bytes method ids
-// Single function calls will follow the following repeating pattern:
-// DUP1
-// PUSH4 <4-byte function signature>
-// EQ
-// PUSH2 <jumpdestination for the function>
-// JUMPI
+// ParseMethodIds parses the contract byte code to get all 4-bytes method ids. The
+// dispatcher is walked symbolically, see selectorWalker, so the selectors are found
+// whatever the order of the comparisons, the search strategy or the push size used by
+// the compiler. Creation code is parsed as the runtime code it deploys.
 func ParseMethodIds(bytecode []byte) []string {
-	pattern := []vm.OpCode{vm.DUP1, vm.PUSH4, 0x00, vm.PUSH2, vm.JUMPI}
-	matchPattern := func(ins []vm.OpCode) bool {
-		if len(ins) < len(pattern) {
-			return false
-		}
-		segment := ins[len(ins)-len(pattern):]
-		for i, op := range pattern {
-			if op != 0x00 && op != segment[i] {
-				return false
-			}
-		}
-		return true
-	}
-
-	methodIds := map[string]bool{}
-	push4Args := [4]byte{}
-	inJumpTable := false
-	instructions := make([]vm.OpCode, 0, 64)
-
-	it := asm.NewInstructionIterator(bytecode)
-	for it.Next() {
-		op := it.Op()
-		instructions = append(instructions, it.Op())
-		if op == vm.CALLDATALOAD && !inJumpTable {
-			inJumpTable = true
-		}
-		if inJumpTable {
-			switch op {
-			case vm.PUSH4:
-				copy(push4Args[:], it.Arg())
-			case vm.JUMPI:
-				if matchPattern(instructions) {
-					methodIds[common.Bytes2Hex(push4Args[:])] = true
-					instructions = instructions[:0]
-				}
-			case vm.REVERT:
-				break
-			}
-		}
-	}
-	ret := make([]string, 0, len(methodIds))
-	for key := range methodIds {
-		ret = append(ret, key)
+	selectors := dispatcherSelectors(bytecode)
+	ret := make([]string, 0, len(selectors))
+	for selector := range selectors {
+		ret = append(ret, fmt.Sprintf("%08x", selector))
 	}
+	sort.Strings(ret)
 	return ret
 }
 
@@ -134,6 +93,8 @@ type ABIParser struct {
 	db             ethdb.Database
 	interfaces     map[string]Interface
 	fourbytesCache *lru.Cache
+	eventsCache    *lru.Cache
+	errorsCache    *lru.Cache
 }
 
 func (p *ABIParser) LookupInterface(name string) (*Interface, error) {
@@ -166,6 +127,38 @@ func (p *ABIParser) LookupFourBytes(id string) []ABIElement {
 	return ret
 }
 
+// lookupSigs returns the ABI elements of the table and the known interfaces matching
+// the signature hash, duplicated signatures are removed
+func (p *ABIParser) lookupSigs(cache *lru.Cache, table *sigTable, key []byte, match func(id string, elem ABIElement) bool) []ABIElement {
+	if cached, ok := cache.Get(string(key)); ok {
+		return cached.([]ABIElement)
+	}
+	ret := table.readABIs(p.db, key)
+	for _, intf := range p.interfaces {
+		for id, elem := range intf.Elements {
+			if match(id, elem) {
+				ret.addUnique(elem)
+			}
+		}
+	}
+	cache.Add(string(key), []ABIElement(ret))
+	return ret
+}
+
+// LookupEvent returns the known event signatures of the given log topic0
+func (p *ABIParser) LookupEvent(topic common.Hash) []ABIElement {
+	return p.lookupSigs(p.eventsCache, &eventsTable, topic.Bytes(), func(_ string, elem ABIElement) bool {
+		return elem.Type == "event" && crypto.Keccak256Hash([]byte(elem.Identifier())) == topic
+	})
+}
+
+// LookupError returns the known custom error signatures of the given 4-bytes selector
+func (p *ABIParser) LookupError(id string) []ABIElement {
+	return p.lookupSigs(p.errorsCache, &errorsTable, common.FromHex(id), func(elemId string, elem ABIElement) bool {
+		return elem.Type == "error" && elemId == id
+	})
+}
+
 func (p *ABIParser) isImplemented(intf Interface, sigs []string) bool {
 	methodMap := make(map[string]bool)
 	for _, id := range sigs {
@@ -241,9 +234,13 @@ func loadInterfaces(db ethdb.Database) map[string]Interface {
 
 func NewParser(db ethdb.Database) *ABIParser {
 	abiCache, _ := lru.New(fourbytesCacheSize)
+	eventsCache, _ := lru.New(fourbytesCacheSize)
+	errorsCache, _ := lru.New(fourbytesCacheSize)
 	return &ABIParser{
 		db:             db,
 		interfaces:     loadInterfaces(db),
 		fourbytesCache: abiCache,
+		eventsCache:    eventsCache,
+		errorsCache:    errorsCache,
 	}
 }
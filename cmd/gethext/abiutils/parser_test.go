@@ -30,6 +30,49 @@ func TestParseMethodIds(t *testing.T) {
 	}
 }
 
+func TestParseMethodIdsStyles(t *testing.T) {
+	tests := []struct {
+		file      string
+		methodIds []string
+	}{
+		{"solc_binsearch.bin", []string{"0bee7a67", "3a0b0eff", "3dffc387", "43756e5c", "493279b1", "4bf6c882", "51e80672", "6d70f7ae", "6e47b482", "70fd5bad", "75d47a0a", "7942fd05", "96713da9", "9a99b4f0", "9dc09262", "a1a11bf5", "a78abc16", "ab51bb96", "c81b1662", "dc927faf", "f9a2bbc7", "fb5478b3", "fc3e5908", "fd6a6879"}},
+		{"solc_binsearch_div.bin", []string{"0121b93f", "013cf08b", "2e4176cf", "5c19a95c", "609ff1bd", "9e7b8d61", "a3ec138d", "e2ba53f0"}},
+		{"solc_legacy.bin", []string{"2d0335ab", "548db174", "7f649783", "b092145e", "c3f44c0a", "c47cf5de"}},
+		{"solc_exp.bin", []string{"38cc4831", "767800de", "a6f9dae1", "d1d80fdf"}},
+		{"solc_eqfirst.bin", []string{"02d05d3f", "0accce06", "1ab9075a", "31ed2746", "645a3b72", "772fdae3", "a7f43779", "ae5f8080", "c9bded21", "f905c15a"}},
+		{"solc_push1.bin", []string{"76b5686a", "bb38c66c"}},
+		// no compiler output of these styles is available, they are assembled by hand. Jump
+		// targets are only pushed by PUSH3 if the code exceeds 64KiB.
+		{"solc_pushtargets.bin", []string{"3ccfd60b", "d0e30db0", "f3fef3a3"}},
+		{"solc_viair.bin", []string{"2e64cec1", "6057361d", "8da5cb5b"}},
+		{"vyper_mload.bin", []string{"313ce567", "70a08231", "a9059cbb"}},
+		{"vyper_xor.bin", []string{"06fdde03", "2e1a7d4d", "95d89b41"}},
+		{"erc20.bin", []string{"06fdde03", "095ea7b3", "18160ddd", "23b872dd", "313ce567", "39509351", "70a08231", "95d89b41", "a457c2d7", "a9059cbb", "dd62ed3e"}},
+	}
+	for _, tt := range tests {
+		data, err := os.ReadFile("./tests/" + tt.file)
+		require.NoError(t, err)
+		bytecode, err := hex.DecodeString(string(data))
+		require.NoError(t, err)
+		assert.Equal(t, tt.methodIds, ParseMethodIds(bytecode), tt.file)
+	}
+}
+
+func TestParseMethodIdsLeadingZeros(t *testing.T) {
+	tests := []struct {
+		code      string
+		methodIds []string
+	}{
+		// DUP1 ISZERO PUSH2 JUMPI dispatches the zero selector
+		{"60003560e01c8015610013578063123456781461001357005b00", []string{"00000000", "12345678"}},
+		// selectors with leading zeros are pushed by shorter pushes
+		{"60003560e01c80156100285780600e14610028578061a2b114610028578062fdd58e1461002857005b00", []string{"00000000", "0000000e", "0000a2b1", "00fdd58e"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.methodIds, ParseMethodIds(common.FromHex(tt.code)), tt.code)
+	}
+}
+
 func TestABIParserGetInterfaces(t *testing.T) {
 	unknowns := []string{
 		"aabb1337", // test unknown methods
@@ -0,0 +1,197 @@
+package abiutils
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	ProxyMinimal  = "eip1167" // EIP-1167 minimal proxy, the implementation is in the bytecode
+	ProxyEIP1967  = "eip1967" // EIP-1967 transparent or UUPS proxy
+	ProxyBeacon   = "beacon"  // EIP-1967 beacon proxy
+	ProxyEIP1822  = "eip1822" // EIP-1822 universal upgradeable proxy
+	ProxyOZLegacy = "ozlegacy"
+
+	maxProxyDepth = 3 // Proxies of proxies resolved at most
+)
+
+var (
+	// EIP-1967 slots are the hash of the name minus one
+	eip1967ImplementationSlot  = eip1967Slot("eip1967.proxy.implementation")
+	eip1967BeaconSlot          = eip1967Slot("eip1967.proxy.beacon")
+	eip1822ProxiableSlot       = crypto.Keccak256Hash([]byte("PROXIABLE"))
+	ozLegacyImplementationSlot = crypto.Keccak256Hash([]byte("org.zeppelinos.proxy.implementation"))
+
+	// beaconImplementationSlot is the slot of the implementation in the OpenZeppelin
+	// UpgradeableBeacon, it follows the owner of Ownable
+	beaconImplementationSlot = common.BigToHash(common.Big1)
+	beaconImplementationFunc = crypto.Keccak256([]byte("implementation()"))[:4]
+
+	minimalProxyPrefix = common.FromHex("363d3d373d3d3d363d")
+	minimalProxySuffix = common.FromHex("5af43d82803e903d91")
+
+	ErrNotProxy = errors.New("not a proxy contract")
+)
+
+func eip1967Slot(name string) common.Hash {
+	slot := crypto.Keccak256Hash([]byte(name)).Big()
+	return common.BigToHash(slot.Sub(slot, common.Big1))
+}
+
+// ProxyState is the state proxies are resolved at, it is implemented by state.StateDB
+type ProxyState interface {
+	GetCode(addr common.Address) []byte
+	GetState(addr common.Address, slot common.Hash) common.Hash
+}
+
+// ContractCaller is an optional interface of ProxyState which calls view functions,
+// without it the implementation of a beacon is read from the UpgradeableBeacon layout
+type ContractCaller interface {
+	CallContract(to common.Address, input []byte) ([]byte, error)
+}
+
+// ProxyInfo describes a proxy and its current implementation
+type ProxyInfo struct {
+	Type           string
+	Implementation common.Address
+	Beacon         common.Address // Beacon of a beacon proxy
+}
+
+// ParseMinimalProxy returns the implementation of an EIP-1167 minimal proxy, the
+// address can be pushed by PUSH1 to PUSH20 for vanity addresses with leading zeros
+func ParseMinimalProxy(code []byte) (common.Address, bool) {
+	if !bytes.HasPrefix(code, minimalProxyPrefix) || len(code) <= len(minimalProxyPrefix) {
+		return common.Address{}, false
+	}
+	push := vm.OpCode(code[len(minimalProxyPrefix)])
+	if push < vm.PUSH1 || push > vm.PUSH20 {
+		return common.Address{}, false
+	}
+	start := len(minimalProxyPrefix) + 1
+	end := start + int(push-vm.PUSH1) + 1
+	if len(code) < end+len(minimalProxySuffix) || !bytes.HasPrefix(code[end:], minimalProxySuffix) {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(code[start:end]), true
+}
+
+// slotAddress returns the contract address stored in a storage slot
+func slotAddress(state ProxyState, addr common.Address, slot common.Hash) (common.Address, bool) {
+	val := state.GetState(addr, slot)
+	if val == (common.Hash{}) || !bytes.Equal(val[:common.HashLength-common.AddressLength], make([]byte, common.HashLength-common.AddressLength)) {
+		return common.Address{}, false
+	}
+	ret := common.BytesToAddress(val.Bytes())
+	return ret, len(state.GetCode(ret)) > 0
+}
+
+// beaconImplementation returns the implementation of a beacon
+func beaconImplementation(state ProxyState, beacon common.Address) (common.Address, bool) {
+	if caller, ok := state.(ContractCaller); ok {
+		ret, err := caller.CallContract(beacon, beaconImplementationFunc)
+		if err == nil && len(ret) == common.HashLength {
+			impl := common.BytesToAddress(ret)
+			return impl, len(state.GetCode(impl)) > 0
+		}
+	}
+	return slotAddress(state, beacon, beaconImplementationSlot)
+}
+
+// DetectProxy returns the proxy type and the implementation of the contract at the
+// given state, or ErrNotProxy if the contract is not a known kind of proxy
+func DetectProxy(state ProxyState, addr common.Address) (*ProxyInfo, error) {
+	if impl, ok := ParseMinimalProxy(state.GetCode(addr)); ok {
+		return &ProxyInfo{Type: ProxyMinimal, Implementation: impl}, nil
+	}
+	if impl, ok := slotAddress(state, addr, eip1967ImplementationSlot); ok {
+		return &ProxyInfo{Type: ProxyEIP1967, Implementation: impl}, nil
+	}
+	if beacon, ok := slotAddress(state, addr, eip1967BeaconSlot); ok {
+		if impl, ok := beaconImplementation(state, beacon); ok {
+			return &ProxyInfo{Type: ProxyBeacon, Implementation: impl, Beacon: beacon}, nil
+		}
+	}
+	if impl, ok := slotAddress(state, addr, eip1822ProxiableSlot); ok {
+		return &ProxyInfo{Type: ProxyEIP1822, Implementation: impl}, nil
+	}
+	if impl, ok := slotAddress(state, addr, ozLegacyImplementationSlot); ok {
+		return &ProxyInfo{Type: ProxyOZLegacy, Implementation: impl}, nil
+	}
+	return nil, ErrNotProxy
+}
+
+// merge adds the interfaces and ABI elements of the implementation to the proxy
+// contract, elements of the proxy itself take precedence
+func (c *Contract) merge(impl *Contract) {
+	for name, intf := range impl.Implements {
+		if _, exist := c.Implements[name]; !exist {
+			c.Implements[name] = intf
+			c.Confidence[name] = impl.Confidence[name]
+		}
+	}
+	for name, method := range impl.Methods {
+		if _, exist := c.Methods[name]; !exist {
+			c.Methods[name] = method
+		}
+	}
+	for name, method := range impl.OwnMethods {
+		if _, exist := c.OwnMethods[name]; !exist {
+			c.OwnMethods[name] = method
+		}
+	}
+	for name, event := range impl.Events {
+		if _, exist := c.Events[name]; !exist {
+			c.Events[name] = event
+		}
+	}
+	for name, abiErr := range impl.Errors {
+		if _, exist := c.Errors[name]; !exist {
+			c.Errors[name] = abiErr
+		}
+	}
+	for name, elem := range impl.Unknown {
+		if _, exist := c.Unknown[name]; !exist {
+			c.Unknown[name] = elem
+		}
+	}
+}
+
+// ParseContractAt parses the contract at the given state, if it is a proxy the
+// implementation is resolved and its interfaces and methods are merged into the result.
+// If the state is also a ContractCaller, the interfaces are confirmed with ERC-165.
+func (p *ABIParser) ParseContractAt(state ProxyState, addr common.Address) (*Contract, error) {
+	contract, err := p.parseContractAt(state, addr, 0)
+	if err != nil {
+		return nil, err
+	}
+	if caller, ok := state.(ContractCaller); ok {
+		p.ConfirmInterfaces(caller, addr, contract)
+	}
+	return contract, nil
+}
+
+func (p *ABIParser) parseContractAt(state ProxyState, addr common.Address, depth int) (*Contract, error) {
+	contract, err := p.ParseContract(state.GetCode(addr))
+	if depth >= maxProxyDepth {
+		return contract, err
+	}
+	proxy, perr := DetectProxy(state, addr)
+	if perr != nil {
+		return contract, err
+	}
+	if contract == nil {
+		// minimal proxies have no methods of their own
+		if contract, err = NewContract("", nil, nil); err != nil {
+			return nil, err
+		}
+	}
+	contract.Proxy = proxy
+	if impl, err := p.parseContractAt(state, proxy.Implementation, depth+1); err == nil {
+		contract.merge(impl)
+	}
+	return contract, nil
+}
@@ -0,0 +1,141 @@
+package abiutils
+
+import (
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testProxyState struct {
+	code    map[common.Address][]byte
+	storage map[common.Address]map[common.Hash]common.Hash
+}
+
+func newTestProxyState() *testProxyState {
+	return &testProxyState{
+		code:    make(map[common.Address][]byte),
+		storage: make(map[common.Address]map[common.Hash]common.Hash),
+	}
+}
+
+func (s *testProxyState) GetCode(addr common.Address) []byte {
+	return s.code[addr]
+}
+
+func (s *testProxyState) GetState(addr common.Address, slot common.Hash) common.Hash {
+	return s.storage[addr][slot]
+}
+
+func (s *testProxyState) setState(addr common.Address, slot common.Hash, val common.Hash) {
+	if s.storage[addr] == nil {
+		s.storage[addr] = make(map[common.Hash]common.Hash)
+	}
+	s.storage[addr][slot] = val
+}
+
+func minimalProxyCode(impl []byte) []byte {
+	code := append([]byte{}, minimalProxyPrefix...)
+	code = append(code, byte(0x5f+len(impl)))
+	code = append(code, impl...)
+	code = append(code, minimalProxySuffix...)
+	return append(code, common.FromHex("602b57fd5bf3")...)
+}
+
+func TestParseMinimalProxy(t *testing.T) {
+	impl := common.HexToAddress("0xbebebebebebebebebebebebebebebebebebebebe")
+	addr, ok := ParseMinimalProxy(minimalProxyCode(impl.Bytes()))
+	assert.True(t, ok)
+	assert.Equal(t, impl, addr)
+
+	vanity := common.HexToAddress("0x0000000000ffffffffffffffffffffffffffffff")
+	addr, ok = ParseMinimalProxy(minimalProxyCode(vanity.Bytes()[5:]))
+	assert.True(t, ok)
+	assert.Equal(t, vanity, addr)
+
+	_, ok = ParseMinimalProxy(minimalProxyCode(impl.Bytes())[:30])
+	assert.False(t, ok)
+}
+
+func TestDetectProxy(t *testing.T) {
+	var (
+		proxy  = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		impl   = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		beacon = common.HexToAddress("0x3000000000000000000000000000000000000003")
+		eoa    = common.HexToAddress("0x4000000000000000000000000000000000000004")
+	)
+	tests := []struct {
+		name  string
+		setup func(s *testProxyState)
+		info  *ProxyInfo
+	}{
+		{"eip1167", func(s *testProxyState) {
+			s.code[proxy] = minimalProxyCode(impl.Bytes())
+		}, &ProxyInfo{Type: ProxyMinimal, Implementation: impl}},
+		{"eip1967", func(s *testProxyState) {
+			s.setState(proxy, eip1967ImplementationSlot, common.BytesToHash(impl.Bytes()))
+		}, &ProxyInfo{Type: ProxyEIP1967, Implementation: impl}},
+		{"beacon", func(s *testProxyState) {
+			s.code[beacon] = []byte{0x00}
+			s.setState(proxy, eip1967BeaconSlot, common.BytesToHash(beacon.Bytes()))
+			s.setState(beacon, beaconImplementationSlot, common.BytesToHash(impl.Bytes()))
+		}, &ProxyInfo{Type: ProxyBeacon, Implementation: impl, Beacon: beacon}},
+		{"eip1822", func(s *testProxyState) {
+			s.setState(proxy, eip1822ProxiableSlot, common.BytesToHash(impl.Bytes()))
+		}, &ProxyInfo{Type: ProxyEIP1822, Implementation: impl}},
+		{"ozlegacy", func(s *testProxyState) {
+			s.setState(proxy, ozLegacyImplementationSlot, common.BytesToHash(impl.Bytes()))
+		}, &ProxyInfo{Type: ProxyOZLegacy, Implementation: impl}},
+		{"no code", func(s *testProxyState) {
+			s.setState(proxy, eip1967ImplementationSlot, common.BytesToHash(eoa.Bytes()))
+		}, nil},
+		{"not address", func(s *testProxyState) {
+			s.setState(proxy, eip1967ImplementationSlot, common.HexToHash("0xff00000000000000000000002000000000000000000000000000000000000002"))
+		}, nil},
+	}
+	for _, tt := range tests {
+		state := newTestProxyState()
+		state.code[impl] = []byte{0x00}
+		tt.setup(state)
+		info, err := DetectProxy(state, proxy)
+		if tt.info == nil {
+			assert.ErrorIs(t, err, ErrNotProxy, tt.name)
+			continue
+		}
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.info, info, tt.name)
+	}
+}
+
+func TestParseContractAtProxy(t *testing.T) {
+	data, err := os.ReadFile("./tests/erc20.bin")
+	require.NoError(t, err)
+	erc20, err := hex.DecodeString(string(data))
+	require.NoError(t, err)
+
+	var (
+		clone = common.HexToAddress("0x1000000000000000000000000000000000000001")
+		proxy = common.HexToAddress("0x2000000000000000000000000000000000000002")
+		impl  = common.HexToAddress("0x3000000000000000000000000000000000000003")
+	)
+	state := newTestProxyState()
+	state.code[impl] = erc20
+	state.code[proxy] = []byte{0x00}
+	state.setState(proxy, eip1967ImplementationSlot, common.BytesToHash(impl.Bytes()))
+	state.code[clone] = minimalProxyCode(proxy.Bytes())
+
+	parser := NewParser(rawdb.NewMemoryDatabase())
+	contract, err := parser.ParseContractAt(state, clone)
+	require.NoError(t, err)
+	assert.Equal(t, &ProxyInfo{Type: ProxyMinimal, Implementation: proxy}, contract.Proxy)
+	assert.Contains(t, contract.Implements, "IERC20")
+	assert.Contains(t, contract.Methods, "transfer")
+
+	contract, err = parser.ParseContractAt(state, impl)
+	require.NoError(t, err)
+	assert.Nil(t, contract.Proxy)
+}
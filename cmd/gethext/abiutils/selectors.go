@@ -0,0 +1,466 @@
+package abiutils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+const (
+	maxDispatcherSteps = 1 << 18 // Instructions executed at most when walking a dispatcher
+	maxSelector        = 0xffffffff
+	selectorShift      = 224
+)
+
+type symKind int
+
+const (
+	symUnknown  symKind = iota
+	symConst            // A known constant
+	symCalldata         // The first calldata word, the selector is in its 4 high bytes
+	symSelector         // The 4 bytes selector
+	symMatch            // Non-zero if the selector equals val
+	symMismatch         // Non-zero if the selector differs from val
+)
+
+// symValue is a stack or memory word of the symbolic execution
+type symValue struct {
+	kind symKind
+	val  uint256.Int
+}
+
+var unknownValue = symValue{kind: symUnknown}
+
+func constValue(val *uint256.Int) symValue {
+	return symValue{kind: symConst, val: *val}
+}
+
+func (v symValue) String() string {
+	if v.kind == symUnknown || v.kind == symCalldata || v.kind == symSelector {
+		return fmt.Sprint(int(v.kind))
+	}
+	return fmt.Sprintf("%d:%s", v.kind, v.val.Hex())
+}
+
+// compareSelector returns the result of comparing the selector with a constant, the
+// result is unknown if the constant can not be a selector
+func compareSelector(a, b symValue, kind symKind) symValue {
+	if a.kind == symConst {
+		a, b = b, a
+	}
+	if a.kind == symSelector && b.kind == symConst && b.val.IsUint64() && b.val.Uint64() <= maxSelector {
+		return symValue{kind: kind, val: b.val}
+	}
+	return unknownValue
+}
+
+// dispatchPath is a path through the dispatcher being walked
+type dispatchPath struct {
+	pc    uint64
+	stack []symValue
+	mem   map[uint64]symValue // Words stored at constant offsets
+}
+
+func (p *dispatchPath) fork(pc uint64) *dispatchPath {
+	mem := make(map[uint64]symValue, len(p.mem))
+	for off, val := range p.mem {
+		mem[off] = val
+	}
+	return &dispatchPath{pc: pc, stack: append([]symValue{}, p.stack...), mem: mem}
+}
+
+func (p *dispatchPath) pop() symValue {
+	val := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	return val
+}
+
+func (p *dispatchPath) push(val symValue) {
+	p.stack = append(p.stack, val)
+}
+
+// key identifies the path state, a state which was walked already is not walked again
+func (p *dispatchPath) key() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d", p.pc)
+	for _, val := range p.stack {
+		sb.WriteByte('|')
+		sb.WriteString(val.String())
+	}
+	return sb.String()
+}
+
+// stackEffect returns the number of items popped and pushed by the opcodes which are not
+// interpreted, ok is false if the opcode halts or is not defined
+func stackEffect(op vm.OpCode) (pops int, pushes int, ok bool) {
+	switch {
+	case op == vm.ADDMOD || op == vm.MULMOD:
+		return 3, 1, true
+	case op >= vm.ADD && op <= vm.SIGNEXTEND, op >= vm.LT && op <= vm.SAR, op == vm.KECCAK256:
+		if op == vm.ISZERO || op == vm.NOT {
+			return 1, 1, true
+		}
+		return 2, 1, true
+	case op == vm.BALANCE, op == vm.CALLDATALOAD, op == vm.EXTCODESIZE, op == vm.EXTCODEHASH, op == vm.BLOCKHASH, op == vm.MLOAD, op == vm.SLOAD:
+		return 1, 1, true
+	case op == vm.CALLDATACOPY, op == vm.CODECOPY, op == vm.RETURNDATACOPY:
+		return 3, 0, true
+	case op == vm.EXTCODECOPY:
+		return 4, 0, true
+	case op >= vm.ADDRESS && op <= vm.BASEFEE, op == vm.PC, op == vm.MSIZE, op == vm.GAS:
+		return 0, 1, true
+	case op == vm.POP:
+		return 1, 0, true
+	case op == vm.MSTORE, op == vm.MSTORE8, op == vm.SSTORE:
+		return 2, 0, true
+	case op == vm.JUMPDEST:
+		return 0, 0, true
+	case op >= vm.LOG0 && op <= vm.LOG4:
+		return 2 + int(op-vm.LOG0), 0, true
+	case op == vm.CREATE:
+		return 3, 1, true
+	case op == vm.CREATE2:
+		return 4, 1, true
+	case op == vm.CALL, op == vm.CALLCODE:
+		return 7, 1, true
+	case op == vm.DELEGATECALL, op == vm.STATICCALL:
+		return 6, 1, true
+	}
+	return 0, 0, false
+}
+
+// evalConst evaluates an arithmetic opcode on constant operands, a is the top of the stack
+func evalConst(op vm.OpCode, a, b *uint256.Int) (*uint256.Int, bool) {
+	z := new(uint256.Int)
+	switch op {
+	case vm.ADD:
+		z.Add(a, b)
+	case vm.SUB:
+		z.Sub(a, b)
+	case vm.MUL:
+		z.Mul(a, b)
+	case vm.DIV:
+		z.Div(a, b)
+	case vm.EXP:
+		z.Exp(a, b)
+	case vm.AND:
+		z.And(a, b)
+	case vm.OR:
+		z.Or(a, b)
+	case vm.XOR:
+		z.Xor(a, b)
+	case vm.SHL:
+		if a.LtUint64(256) {
+			z.Lsh(b, uint(a.Uint64()))
+		}
+	case vm.SHR:
+		if a.LtUint64(256) {
+			z.Rsh(b, uint(a.Uint64()))
+		}
+	case vm.LT:
+		if a.Lt(b) {
+			z.SetOne()
+		}
+	case vm.GT:
+		if a.Gt(b) {
+			z.SetOne()
+		}
+	case vm.EQ:
+		if a.Eq(b) {
+			z.SetOne()
+		}
+	default:
+		return nil, false
+	}
+	return z, true
+}
+
+// evalBinary interprets the binary opcodes deriving the selector from the calldata and
+// comparing it, a is the top of the stack
+func evalBinary(op vm.OpCode, a, b symValue) symValue {
+	if a.kind == symConst && b.kind == symConst {
+		if z, ok := evalConst(op, &a.val, &b.val); ok {
+			return constValue(z)
+		}
+		return unknownValue
+	}
+	switch op {
+	case vm.SHR:
+		// PUSH1 0xe0 SHR
+		if a.kind == symConst && a.val.Eq(uint256.NewInt(selectorShift)) && b.kind == symCalldata {
+			return symValue{kind: symSelector}
+		}
+	case vm.DIV:
+		// PUSH29 0x0100000000... SWAP1 DIV
+		if a.kind == symCalldata && b.kind == symConst && b.val.Eq(new(uint256.Int).Lsh(uint256.NewInt(1), selectorShift)) {
+			return symValue{kind: symSelector}
+		}
+	case vm.AND:
+		// PUSH4 0xffffffff AND
+		if a.kind == symConst {
+			a, b = b, a
+		}
+		if a.kind == symSelector && b.kind == symConst && new(uint256.Int).And(&b.val, uint256.NewInt(maxSelector)).Eq(uint256.NewInt(maxSelector)) {
+			return a
+		}
+	case vm.EQ:
+		return compareSelector(a, b, symMatch)
+	case vm.XOR, vm.SUB:
+		return compareSelector(a, b, symMismatch)
+	}
+	return unknownValue
+}
+
+// selectorWalker finds the selectors a contract dispatches on by walking the code
+// symbolically from its entry point. The selector is tracked from CALLDATALOAD through
+// the shifts and masks used by the compilers, every JUMPI conditioned on comparing it
+// with a constant records the constant. Both branches of other conditional jumps are
+// walked, which covers linear and binary search dispatchers, while the code of matched
+// functions is not walked.
+type selectorWalker struct {
+	code      []byte
+	jumpdests map[uint64]bool
+	visited   map[string]bool
+	steps     int
+	selectors map[uint32]bool
+	copies    map[uint64][2]uint64 // Code copied to memory by offset: code offset and size
+	runtime   []byte               // Runtime code returned by creation code
+}
+
+func newSelectorWalker(code []byte) *selectorWalker {
+	w := &selectorWalker{
+		code:      code,
+		jumpdests: make(map[uint64]bool),
+		visited:   make(map[string]bool),
+		selectors: make(map[uint32]bool),
+		copies:    make(map[uint64][2]uint64),
+	}
+	for pc := uint64(0); pc < uint64(len(code)); pc++ {
+		op := vm.OpCode(code[pc])
+		if op == vm.JUMPDEST {
+			w.jumpdests[pc] = true
+		} else if op.IsPush() {
+			pc += uint64(op - vm.PUSH1 + 1)
+		}
+	}
+	return w
+}
+
+func (w *selectorWalker) walk() {
+	paths := []*dispatchPath{{mem: make(map[uint64]symValue)}}
+	for len(paths) > 0 && w.steps < maxDispatcherSteps {
+		path := paths[len(paths)-1]
+		paths = append(paths[:len(paths)-1], w.step(path)...)
+	}
+}
+
+// jumpTarget returns the path continuing at target, nil if it is not a walkable jump
+func (w *selectorWalker) jumpTarget(path *dispatchPath, target symValue) *dispatchPath {
+	if target.kind != symConst || !target.val.IsUint64() || !w.jumpdests[target.val.Uint64()] {
+		return nil
+	}
+	path.pc = target.val.Uint64()
+	if key := path.key(); !w.visited[key] {
+		w.visited[key] = true
+		return path
+	}
+	return nil
+}
+
+// step walks the path until it halts or branches, returns the paths to continue with
+func (w *selectorWalker) step(path *dispatchPath) []*dispatchPath {
+	for ; w.steps < maxDispatcherSteps && path.pc < uint64(len(w.code)); w.steps++ {
+		op := vm.OpCode(w.code[path.pc])
+		switch {
+		case op == 0x5f: // PUSH0
+			path.push(constValue(new(uint256.Int)))
+		case op.IsPush():
+			size := uint64(op - vm.PUSH1 + 1)
+			arg := make([]byte, size)
+			if path.pc+1 < uint64(len(w.code)) {
+				copy(arg, w.code[path.pc+1:])
+			}
+			path.push(constValue(new(uint256.Int).SetBytes(arg)))
+			path.pc += size
+		case op >= vm.DUP1 && op <= vm.DUP16:
+			n := int(op - vm.DUP1 + 1)
+			if len(path.stack) < n {
+				return nil
+			}
+			path.push(path.stack[len(path.stack)-n])
+		case op >= vm.SWAP1 && op <= vm.SWAP16:
+			n := int(op - vm.SWAP1 + 1)
+			if len(path.stack) <= n {
+				return nil
+			}
+			top := len(path.stack) - 1
+			path.stack[top], path.stack[top-n] = path.stack[top-n], path.stack[top]
+		case op == vm.JUMP:
+			if len(path.stack) < 1 {
+				return nil
+			}
+			if next := w.jumpTarget(path, path.pop()); next != nil {
+				return []*dispatchPath{next}
+			}
+			return nil
+		case op == vm.JUMPI:
+			if len(path.stack) < 2 {
+				return nil
+			}
+			target, cond := path.pop(), path.pop()
+			var (
+				next   []*dispatchPath
+				jump   = true
+				noJump = true
+			)
+			switch cond.kind {
+			case symMatch:
+				// the jump enters the function, only the remaining dispatcher is walked
+				w.selectors[uint32(cond.val.Uint64())] = true
+				jump = false
+			case symMismatch:
+				w.selectors[uint32(cond.val.Uint64())] = true
+				noJump = false
+			case symConst:
+				jump, noJump = !cond.val.IsZero(), cond.val.IsZero()
+			}
+			if noJump {
+				cont := path.fork(path.pc + 1)
+				if key := cont.key(); !w.visited[key] {
+					w.visited[key] = true
+					next = append(next, cont)
+				}
+			}
+			if jump {
+				if taken := w.jumpTarget(path, target); taken != nil {
+					next = append(next, taken)
+				}
+			}
+			return next
+		case op == vm.STOP, op == vm.REVERT, op == vm.INVALID, op == vm.SELFDESTRUCT:
+			return nil
+		case op == vm.RETURN:
+			if len(path.stack) >= 2 {
+				w.returned(path.pop(), path.pop())
+			}
+			return nil
+		default:
+			if !w.exec(path, op) {
+				return nil
+			}
+		}
+		path.pc++
+	}
+	return nil
+}
+
+// exec interprets an opcode which does not change the control flow
+func (w *selectorWalker) exec(path *dispatchPath, op vm.OpCode) bool {
+	pops, pushes, ok := stackEffect(op)
+	if !ok || len(path.stack) < pops {
+		return false
+	}
+	switch {
+	case op == vm.CALLDATALOAD:
+		if off := path.pop(); off.kind == symConst && off.val.IsZero() {
+			path.push(symValue{kind: symCalldata})
+		} else {
+			path.push(unknownValue)
+		}
+	case op == vm.ISZERO:
+		switch val := path.pop(); val.kind {
+		case symMatch:
+			path.push(symValue{kind: symMismatch, val: val.val})
+		case symMismatch:
+			path.push(symValue{kind: symMatch, val: val.val})
+		case symSelector:
+			// DUP1 ISZERO PUSH2 JUMPI dispatches the zero selector
+			path.push(symValue{kind: symMatch})
+		case symConst:
+			path.push(constValue(new(uint256.Int).SetUint64(boolToUint64(val.val.IsZero()))))
+		default:
+			path.push(unknownValue)
+		}
+	case op == vm.NOT:
+		if val := path.pop(); val.kind == symConst {
+			path.push(constValue(new(uint256.Int).Not(&val.val)))
+		} else {
+			path.push(unknownValue)
+		}
+	case op == vm.MSTORE:
+		off, val := path.pop(), path.pop()
+		if off.kind == symConst && off.val.IsUint64() {
+			path.mem[off.val.Uint64()] = val
+		}
+	case op == vm.MLOAD:
+		path.push(w.load(path, path.pop()))
+	case op == vm.CODECOPY:
+		dest, off, size := path.pop(), path.pop(), path.pop()
+		if dest.kind == symConst && off.kind == symConst && size.kind == symConst &&
+			dest.val.IsUint64() && off.val.IsUint64() && size.val.IsUint64() {
+			w.copies[dest.val.Uint64()] = [2]uint64{off.val.Uint64(), size.val.Uint64()}
+		}
+	case pops == 2 && pushes == 1:
+		a, b := path.pop(), path.pop()
+		path.push(evalBinary(op, a, b))
+	default:
+		path.stack = path.stack[:len(path.stack)-pops]
+		for i := 0; i < pushes; i++ {
+			path.push(unknownValue)
+		}
+	}
+	return true
+}
+
+// load returns the memory word at off. Vyper stores the first calldata word at 0x1c,
+// so the word at 0 holds the selector in its low 4 bytes.
+func (w *selectorWalker) load(path *dispatchPath, off symValue) symValue {
+	if off.kind != symConst || !off.val.IsUint64() {
+		return unknownValue
+	}
+	if val, exist := path.mem[off.val.Uint64()]; exist {
+		return val
+	}
+	if val, exist := path.mem[off.val.Uint64()+28]; exist && val.kind == symCalldata {
+		return symValue{kind: symSelector}
+	}
+	return unknownValue
+}
+
+// returned records the runtime code returned by creation code
+func (w *selectorWalker) returned(off, size symValue) {
+	if off.kind != symConst || !off.val.IsUint64() || w.runtime != nil {
+		return
+	}
+	copied, exist := w.copies[off.val.Uint64()]
+	if !exist || copied[0] >= uint64(len(w.code)) || copied[1] == 0 {
+		return
+	}
+	end := copied[0] + copied[1]
+	if end > uint64(len(w.code)) {
+		end = uint64(len(w.code))
+	}
+	w.runtime = w.code[copied[0]:end]
+}
+
+func boolToUint64(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// dispatcherSelectors returns the selectors the code dispatches on, if the code is
+// creation code the selectors of the runtime code it returns
+func dispatcherSelectors(code []byte) map[uint32]bool {
+	w := newSelectorWalker(code)
+	w.walk()
+	if len(w.selectors) == 0 && w.runtime != nil {
+		runtime := newSelectorWalker(w.runtime)
+		runtime.walk()
+		return runtime.selectors
+	}
+	return w.selectors
+}
@@ -26,6 +26,17 @@ type Interface struct {
 	Elements   map[string]ABIElement // map from 4-bytes to abi element
 }
 
+// ID returns the ERC-165 interface identifier, the XOR of all function selectors of the interface
+func (intf *Interface) ID() [4]byte {
+	var id [4]byte
+	for _, method := range intf.Methods {
+		for i := range id {
+			id[i] ^= method.ID[i]
+		}
+	}
+	return id
+}
+
 func (intf *Interface) UnpackInput(v interface{}, name string, data []byte) error {
 	var args abi.Arguments
 	if method, exist := intf.Methods[name]; exist {
@@ -142,6 +153,8 @@ type Contract struct {
 	Implements map[string]Interface   // Known interfaces that the contract implemented
 	OwnMethods map[string]abi.Method  // Methods owned by contract itself only, not included in any interfaces
 	Unknown    map[string]interface{} // Unknown ABI elements
+	Proxy      *ProxyInfo             // Proxy type and implementation if the contract is a proxy
+	Confidence map[string]string      // How each implemented interface was detected, see ConfidenceBytecode
 }
 
 func (c *Contract) Interface(name string) *Interface {
@@ -198,8 +211,10 @@ func NewContract(name string, elems []ABIElement, ifs []Interface) (*Contract, e
 		}
 	}
 	impls := make(map[string]Interface)
+	confidence := make(map[string]string)
 	for _, item := range ifs {
 		impls[item.Name] = item
+		confidence[item.Name] = ConfidenceBytecode
 		for _, method := range item.Methods {
 			contractABI.Methods[method.Name] = method
 		}
@@ -207,6 +222,8 @@ func NewContract(name string, elems []ABIElement, ifs []Interface) (*Contract, e
 	return &Contract{
 		privateABI: contractABI,
 		Implements: impls,
+		OwnMethods: ownMethods,
 		Unknown:    unknown,
+		Confidence: confidence,
 	}, nil
 }
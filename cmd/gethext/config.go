@@ -36,6 +36,8 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/usbwallet"
 	"github.com/ethereum/go-ethereum/cmd/gethext/monitor"
 	"github.com/ethereum/go-ethereum/cmd/gethext/plugin"
+	"github.com/ethereum/go-ethereum/cmd/gethext/reexec"
+	"github.com/ethereum/go-ethereum/cmd/gethext/sink"
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/eth/ethconfig"
@@ -101,6 +103,9 @@ type gethConfig struct {
 	Metrics  metrics.Config
 	Monitor  monitor.Config
 	Plugins  plugin.Config
+	Sinks    sink.Config
+
+	Checkpoints reexec.CheckpointConfig
 }
 
 func defaultNodeConfig() node.Config {
@@ -150,6 +155,9 @@ func loadConfig(ctx *cli.Context) *gethConfig {
 		Node:    defaultNodeConfig(),
 		Metrics: metrics.DefaultConfig,
 		Monitor: monitor.DefaultConfig,
+		Sinks:   sink.DefaultConfig,
+
+		Checkpoints: reexec.DefaultCheckpointConfig,
 	}
 
 	// Load config file.
@@ -176,6 +184,15 @@ func loadConfig(ctx *cli.Context) *gethConfig {
 	if ctx.IsSet(monitorEnableFlag.Name) {
 		cfg.Monitor.Enabled = ctx.GlobalBool(monitorEnableFlag.Name)
 	}
+	if ctx.IsSet(monitorVerifyFlag.Name) {
+		cfg.Monitor.VerifyReplay = ctx.GlobalBool(monitorVerifyFlag.Name)
+	}
+	if ctx.IsSet(indexerEnableFlag.Name) {
+		cfg.Monitor.Indexer = ctx.GlobalBool(indexerEnableFlag.Name)
+	}
+	if ctx.IsSet(checkpointIntervalFlag.Name) {
+		cfg.Checkpoints.Interval = ctx.GlobalUint64(checkpointIntervalFlag.Name)
+	}
 	return cfg
 }
 
@@ -13,6 +13,8 @@ import (
 	"github.com/ethereum/go-ethereum/cmd/gethext/abiutils"
 	"github.com/ethereum/go-ethereum/cmd/gethext/monitor"
 	"github.com/ethereum/go-ethereum/cmd/gethext/plugin"
+	"github.com/ethereum/go-ethereum/cmd/gethext/reexec"
+	"github.com/ethereum/go-ethereum/cmd/gethext/sink"
 	"github.com/ethereum/go-ethereum/cmd/gethext/task"
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/log"
@@ -20,24 +22,32 @@ import (
 )
 
 const (
-	extNamespace      = "/eth/db/ethexplorer"
-	extDatabaseName   = "ethexplorer"
-	extDatabaseHandle = 512
-	extDatabaseCache  = 1024
-	indexerTaskName   = "indexer"
-	pluginsDataDir    = "plugins"
+	extNamespace            = "/eth/db/ethexplorer"
+	extDatabaseName         = "ethexplorer"
+	extDatabaseHandle       = 512
+	extDatabaseCache        = 1024
+	checkpointsDatabaseName = "checkpoints"
+	checkpointsNamespace    = "/eth/db/checkpoints"
+	indexerTaskName         = "indexer"
+	pluginsDataDir          = "plugins"
+	sinksDataDir            = "sinks"
 )
 
 type EthExplorerConfig struct {
 	InstanceDir string
 	Plugins     *plugin.Config
 	Monitor     *monitor.Config
+	Sinks       *sink.Config
+	Checkpoints *reexec.CheckpointConfig
 }
 
 func (c *EthExplorerConfig) sanitize() error {
 	if len(c.Plugins.DataDir) == 0 {
 		c.Plugins.DataDir = filepath.Join(c.InstanceDir, pluginsDataDir)
 	}
+	if len(c.Sinks.Dir) == 0 {
+		c.Sinks.Dir = filepath.Join(c.InstanceDir, sinksDataDir)
+	}
 	return nil
 }
 
@@ -46,6 +56,8 @@ type EthExplorer struct {
 	chainMonitor  *monitor.ChainMonitor
 	pluginManager *plugin.PluginManager
 	taskManager   *task.TaskManager
+	sinkManager   *sink.Manager
+	checkpoints   *reexec.CheckpointStore // Nil if checkpointing is disabled
 
 	quitCh   chan struct{}
 	quitLock sync.Mutex
@@ -63,6 +75,11 @@ func (s *EthExplorer) Start() error {
 		log.Error("Could not start plugin manager", "error", err)
 		return err
 	}
+	// tasks are restored after plugins registered their processors
+	if err := s.taskManager.Start(); err != nil {
+		log.Error("Could not start task manager", "error", err)
+		return err
+	}
 	return nil
 }
 
@@ -75,6 +92,11 @@ func (s *EthExplorer) Stop() error {
 		s.pluginManager.Stop()
 		s.chainMonitor.Stop()
 		s.taskManager.Stop()
+		// replayers hand states over to the checkpoint writer until they are stopped
+		if s.checkpoints != nil {
+			s.checkpoints.Close()
+		}
+		s.sinkManager.Close()
 		close(s.quitCh)
 	}
 	s.quitLock.Unlock()
@@ -92,26 +114,47 @@ func NewExplorerService(cfg *EthExplorerConfig, node *node.Node, eth *eth.Ethere
 	}
 
 	abiutils.InitDefaultParser(diskdb)
-	chainMonitor, err := monitor.NewChainMonitor(cfg.Monitor, diskdb, eth.BlockChain())
+	sinkManager, err := sink.NewManager(cfg.Sinks)
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoints *reexec.CheckpointStore
+	if cfg.Checkpoints.Interval > 0 {
+		checkpointdb, err := node.OpenDatabase(checkpointsDatabaseName, extDatabaseCache, extDatabaseHandle, checkpointsNamespace, false)
+		if err != nil {
+			return nil, err
+		}
+		checkpoints, err = reexec.NewCheckpointStore(cfg.Checkpoints, checkpointdb, eth.ChainDb())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	chainMonitor, err := monitor.NewChainMonitor(cfg.Monitor, diskdb, checkpoints, eth.BlockChain(), sinkManager)
 	if err != nil {
 		return nil, err
 	}
 
-	taskManager, err := task.NewTaskManager()
+	taskManager, err := task.NewTaskManager(diskdb, eth.ChainDb(), checkpoints, eth.BlockChain(), sinkManager)
 	if err != nil {
 		return nil, err
 	}
+	node.RegisterAPIs(taskManager.APIs())
 
 	pluginManager, err := plugin.NewPluginManager(cfg.Plugins, diskdb, node, eth.APIBackend, chainMonitor, taskManager)
 	if err != nil {
 		return nil, err
 	}
+	node.RegisterAPIs(pluginManager.APIs())
 
 	instance := &EthExplorer{
 		config:        cfg,
 		chainMonitor:  chainMonitor,
 		pluginManager: pluginManager,
 		taskManager:   taskManager,
+		sinkManager:   sinkManager,
+		checkpoints:   checkpoints,
 		quitCh:        make(chan struct{}),
 	}
 	return instance, nil
@@ -7,6 +7,8 @@
 package extdb
 
 import (
+	"bytes"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
@@ -116,6 +118,28 @@ func WriteFourBytesABIs(db ethdb.KeyValueWriter, fourBytes []byte, data []byte)
 	}
 }
 
+func ReadEventABIs(db ethdb.KeyValueReader, topic common.Hash) []byte {
+	data, _ := db.Get(EventABIsKey(topic))
+	return data
+}
+
+func WriteEventABIs(db ethdb.KeyValueWriter, topic common.Hash, data []byte) {
+	if err := db.Put(EventABIsKey(topic), data); err != nil {
+		log.Crit("Failed to write event abis", "err", err)
+	}
+}
+
+func ReadErrorABIs(db ethdb.KeyValueReader, fourBytes []byte) []byte {
+	data, _ := db.Get(ErrorABIsKey(fourBytes))
+	return data
+}
+
+func WriteErrorABIs(db ethdb.KeyValueWriter, fourBytes []byte, data []byte) {
+	if err := db.Put(ErrorABIsKey(fourBytes), data); err != nil {
+		log.Crit("Failed to write custom error abis", "err", err)
+	}
+}
+
 func ReadInterfaceABI(db ethdb.KeyValueReader, name string) []byte {
 	data, _ := db.Get(InterfaceABIKey(name))
 	return data
@@ -126,3 +150,95 @@ func WriteInterfaceABI(db ethdb.KeyValueWriter, name string, data []byte) {
 		log.Crit("Failed to write contract interface list", "err", err)
 	}
 }
+
+// MigratePluginData moves the keys written before plugin keys were separated from the
+// plugin name, PluginDataKeyPrefix + name + key, to PluginDataPrefix(name) + key. It
+// runs once per plugin. The old keys of a plugin are ambiguous with the keys of other
+// plugins whose names start with its name, isOther tells which owners must be skipped.
+func MigratePluginData(db ethdb.Database, plName string, isOther func(owner string) bool) (int, error) {
+	if has, _ := db.Has(PluginDataMarkerKey(plName)); has {
+		return 0, nil
+	}
+	var (
+		legacyPrefix = append(common.CopyBytes(PluginDataKeyPrefix), plName...)
+		newPrefix    = PluginDataPrefix(plName)
+		batch        = db.NewBatch()
+		moved        = 0
+	)
+	it := db.NewIterator(legacyPrefix, nil)
+	defer it.Release()
+	for it.Next() {
+		key := it.Key()
+		if bytes.HasPrefix(key, newPrefix) {
+			continue
+		}
+		if owner, ok := PluginDataOwner(key); ok && owner != plName && isOther(owner) {
+			continue
+		}
+		batch.Put(append(common.CopyBytes(newPrefix), key[len(legacyPrefix):]...), common.CopyBytes(it.Value()))
+		batch.Delete(common.CopyBytes(key))
+		moved++
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return moved, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return moved, err
+	}
+	batch.Put(PluginDataMarkerKey(plName), []byte{1})
+	return moved, batch.Write()
+}
+
+func ReadTaskRecord(db ethdb.KeyValueReader, name string) []byte {
+	data, _ := db.Get(TaskRecordKey(name))
+	return data
+}
+
+// ReadAllTaskRecords returns all task records stored in database
+func ReadAllTaskRecords(db ethdb.Iteratee) [][]byte {
+	it := db.NewIterator(TaskRecordPrefix, nil)
+	defer it.Release()
+	var ret [][]byte
+	for it.Next() {
+		ret = append(ret, common.CopyBytes(it.Value()))
+	}
+	return ret
+}
+
+func WriteTaskRecord(db ethdb.KeyValueWriter, name string, data []byte) {
+	if err := db.Put(TaskRecordKey(name), data); err != nil {
+		log.Crit("Failed to write task record", "err", err)
+	}
+}
+
+func DeleteTaskRecord(db ethdb.KeyValueWriter, name string) {
+	if err := db.Delete(TaskRecordKey(name)); err != nil {
+		log.Crit("Failed to delete task record", "err", err)
+	}
+}
+
+// ReadAllTaskSchedules returns all task schedules stored in database
+func ReadAllTaskSchedules(db ethdb.Iteratee) [][]byte {
+	it := db.NewIterator(TaskSchedulePrefix, nil)
+	defer it.Release()
+	var ret [][]byte
+	for it.Next() {
+		ret = append(ret, common.CopyBytes(it.Value()))
+	}
+	return ret
+}
+
+func WriteTaskSchedule(db ethdb.KeyValueWriter, name string, data []byte) {
+	if err := db.Put(TaskScheduleKey(name), data); err != nil {
+		log.Crit("Failed to write task schedule", "err", err)
+	}
+}
+
+func DeleteTaskSchedule(db ethdb.KeyValueWriter, name string) {
+	if err := db.Delete(TaskScheduleKey(name)); err != nil {
+		log.Crit("Failed to delete task schedule", "err", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -59,6 +60,11 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		indexStates   stat
 		indexRecords  stat
 		fourBytes     stat
+		eventSigs     stat
+		errorSigs     stat
+		tasks         stat
+		schedules     stat
+		plugins       = make(map[string]*stat)
 
 		// Meta- and unaccounted data
 		metadata    stat
@@ -91,8 +97,28 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 			indexRecords.Add(size)
 		case bytes.HasPrefix(key, FourBytesMethodPrefix) && len(key) == (len(FourBytesMethodPrefix)+4):
 			fourBytes.Add(size)
+		case bytes.HasPrefix(key, EventSigPrefix) && len(key) == (len(EventSigPrefix)+common.HashLength):
+			eventSigs.Add(size)
+		case bytes.HasPrefix(key, ErrorSigPrefix) && len(key) == (len(ErrorSigPrefix)+4):
+			errorSigs.Add(size)
 		case bytes.HasPrefix(key, InterfaceABIPrefix) && bytes.HasSuffix(key, InterfaceABISuffix):
 			interfaceABIs.Add(size)
+		case bytes.HasPrefix(key, TaskRecordPrefix):
+			tasks.Add(size)
+		case bytes.HasPrefix(key, TaskSchedulePrefix):
+			schedules.Add(size)
+		case bytes.HasPrefix(key, PluginDataMarkerPrefix):
+			metadata.Add(size)
+		case bytes.HasPrefix(key, PluginDataKeyPrefix):
+			name, ok := PluginDataOwner(key)
+			if !ok {
+				unaccounted.Add(size)
+				break
+			}
+			if plugins[name] == nil {
+				plugins[name] = new(stat)
+			}
+			plugins[name].Add(size)
 		default:
 			var accounted bool
 			for _, meta := range [][]byte{
@@ -122,9 +148,21 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		{"Key-Value store", "Account Index States", indexStates.Size(), indexStates.Count()},
 		{"Key-Value store", "Account Index Data", indexRecords.Size(), indexRecords.Count()},
 		{"Key-Value store", "Method Signatures", fourBytes.Size(), fourBytes.Count()},
+		{"Key-Value store", "Event Signatures", eventSigs.Size(), eventSigs.Count()},
+		{"Key-Value store", "Error Signatures", errorSigs.Size(), errorSigs.Count()},
 		{"Key-Value store", "Interface ABIs", interfaceABIs.Size(), interfaceABIs.Count()},
-		{"Key-Value store", "Metadata", metadata.Size(), metadata.Count()},
+		{"Key-Value store", "Tasks", tasks.Size(), tasks.Count()},
+		{"Key-Value store", "Task Schedules", schedules.Size(), schedules.Count()},
+	}
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		stats = append(stats, []string{"Key-Value store", fmt.Sprintf("Plugin %s", name), plugins[name].Size(), plugins[name].Count()})
 	}
+	stats = append(stats, []string{"Key-Value store", "Metadata", metadata.Size(), metadata.Count()})
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"Database", "Category", "Size", "Items"})
 	table.SetFooter([]string{"", "Total", total.String(), " "})
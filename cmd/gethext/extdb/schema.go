@@ -28,9 +28,14 @@ var (
 	AccountTokenTxPrefix    = []byte("x")   // AccountTokenTxPrefix + address + refNum -> transaction hash
 	TokenHolderPrefix       = []byte("h")   // TokenHolderPrefix + token address + refNum -> account address
 	FourBytesMethodPrefix   = []byte("4")   // FourBytesMethodPrefix + 4 bytes sig -> list of method abis
+	EventSigPrefix          = []byte("e")   // EventSigPrefix + topic0 -> list of event abis
+	ErrorSigPrefix          = []byte("r")   // ErrorSigPrefix + 4 bytes sig -> list of custom error abis
 	InterfaceABIPrefix      = []byte("I")   // InterfaceABIPrefix + name + InterfaceABISuffix -> contract interface ABI
 	InterfaceABISuffix      = []byte("abi") // InterfaceABISuffix suffix of interface ABI key. e.g: IERC20abi -> ERC20 interface ABI
-	PluginDataKeyPrefix     = []byte("p")   // PluginDataKeyPrefix + plugin name + key -> value
+	PluginDataKeyPrefix     = []byte("p")   // PluginDataKeyPrefix + plugin name + PluginDataSeparator + key -> value
+	PluginDataMarkerPrefix  = []byte("P")   // PluginDataMarkerPrefix + plugin name -> marks the plugin data as migrated to PluginDataSeparator keys
+	TaskRecordPrefix        = []byte("k")   // TaskRecordPrefix + task name -> task record
+	TaskSchedulePrefix      = []byte("S")   // TaskSchedulePrefix + schedule name -> task schedule
 )
 
 var (
@@ -91,6 +96,14 @@ func FourBytesABIsKey(fourBytes []byte) []byte {
 	return append(FourBytesMethodPrefix, fourBytes...)
 }
 
+func EventABIsKey(topic common.Hash) []byte {
+	return append(EventSigPrefix, topic.Bytes()...)
+}
+
+func ErrorABIsKey(fourBytes []byte) []byte {
+	return append(ErrorSigPrefix, fourBytes...)
+}
+
 func InterfaceABIKey(name string) []byte {
 	key := make([]byte, 0, len(InterfaceABIPrefix)+len(name)+len(InterfaceABISuffix))
 	key = append(key, InterfaceABIPrefix...)
@@ -99,9 +112,48 @@ func InterfaceABIKey(name string) []byte {
 	return key
 }
 
+// PluginDataSeparator separates the plugin name from the keys of the plugin, plugin
+// names are file names so they never contain it
+const PluginDataSeparator = '/'
+
 func PluginDataPrefix(plName string) []byte {
-	ret := make([]byte, len(PluginDataKeyPrefix)+len(plName))
+	ret := make([]byte, len(PluginDataKeyPrefix)+len(plName)+1)
 	copy(ret, PluginDataKeyPrefix)
 	copy(ret[len(PluginDataKeyPrefix):], plName)
+	ret[len(ret)-1] = PluginDataSeparator
+	return ret
+}
+
+func PluginDataMarkerKey(plName string) []byte {
+	ret := make([]byte, len(PluginDataMarkerPrefix)+len(plName))
+	copy(ret, PluginDataMarkerPrefix)
+	copy(ret[len(PluginDataMarkerPrefix):], plName)
+	return ret
+}
+
+// PluginDataOwner returns the name of the plugin owning a plugin data key
+func PluginDataOwner(key []byte) (string, bool) {
+	if !bytes.HasPrefix(key, PluginDataKeyPrefix) {
+		return "", false
+	}
+	name := key[len(PluginDataKeyPrefix):]
+	idx := bytes.IndexByte(name, PluginDataSeparator)
+	if idx <= 0 {
+		return "", false
+	}
+	return string(name[:idx]), true
+}
+
+func TaskRecordKey(name string) []byte {
+	ret := make([]byte, len(TaskRecordPrefix)+len(name))
+	copy(ret, TaskRecordPrefix)
+	copy(ret[len(TaskRecordPrefix):], name)
+	return ret
+}
+
+func TaskScheduleKey(name string) []byte {
+	ret := make([]byte, len(TaskSchedulePrefix)+len(name))
+	copy(ret, TaskSchedulePrefix)
+	copy(ret[len(TaskSchedulePrefix):], name)
 	return ret
 }
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/ethereum/go-ethereum/cmd/gethext/abiutils"
 	"github.com/ethereum/go-ethereum/cmd/gethext/extdb"
@@ -14,7 +13,7 @@ import (
 var (
 	importOverrideFlag = cli.BoolFlag{
 		Name:  "override",
-		Usage: "Override 4-bytes ABI entries in database with provided data. If not specified, command will append only unique entries",
+		Usage: "Override signature ABI entries in database with provided data. If not specified, command will append only unique entries",
 	}
 )
 
@@ -42,13 +41,13 @@ var (
 	import4BytesCmd = cli.Command{
 		Action:    utils.MigrateFlags(import4Bytes),
 		Name:      "import-4bytes",
-		ArgsUsage: "<data.json>",
+		ArgsUsage: "<file|dir> [<file|dir>...]",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
 			importOverrideFlag,
 		},
-		Usage:       "Import 4-bytes signatures and pre-defined contract interfaces",
-		Description: `This commands imports 4-bytes signature and known interface's methods to the database. Contract parser use this data to detect contract type and extract contract methods`,
+		Usage:       "Import 4-bytes, event and error signatures and pre-defined contract interfaces",
+		Description: `This commands imports 4-bytes signature and known interface's methods to the database. Contract parser use this data to detect contract type and extract contract methods. The "events" section maps event topics to event signatures and the "errors" section maps 4-bytes selectors to custom error signatures, they are used to decode logs and reverts. The command also reads 4byte.directory JSON and CSV exports, text files of one signature per line (prefixed by "event" or "error" for events and custom errors), compiled contract artifacts and directories of Hardhat, Foundry or solc artifacts.`,
 	}
 )
 
@@ -87,9 +86,17 @@ func inspectExtDB(ctx *cli.Context) error {
 
 func import4Bytes(ctx *cli.Context) error {
 	override := ctx.Bool(importOverrideFlag.Name)
-	if ctx.NArg() != 1 {
+	if ctx.NArg() < 1 {
 		return fmt.Errorf("invalid number of arguments: %v", ctx.Command.ArgsUsage)
 	}
+	data := abiutils.NewSignatureData()
+	for _, path := range ctx.Args() {
+		fileData, err := abiutils.ReadSignatureFile(path)
+		if err != nil {
+			utils.Fatalf("Could not read input file: %v", err)
+		}
+		data.Merge(fileData)
+	}
 	stack := newNode(ctx, loadConfig(ctx))
 	defer stack.Close()
 	db, err := stack.OpenDatabase(extDatabaseName, extDatabaseCache, extDatabaseHandle, extNamespace, false)
@@ -97,9 +104,10 @@ func import4Bytes(ctx *cli.Context) error {
 		utils.Fatalf("Could not open database: %v", err)
 	}
 	defer db.Close()
-	file, err := os.Open(ctx.Args().Get(0))
+	added, err := abiutils.ImportSignatureData(db, data, override)
 	if err != nil {
-		utils.Fatalf("Could not read input file: %v", err)
+		return err
 	}
-	return abiutils.ImportABIsData(db, file, override)
+	fmt.Printf("Imported %d new entries\n", added)
+	return nil
 }
@@ -15,8 +15,16 @@ var (
 		Name:  "monitor.enabled",
 		Usage: "Enable chain monitor",
 	}
+	monitorVerifyFlag = cli.BoolFlag{
+		Name:  "monitor.verify",
+		Usage: "Verify replayed blocks against canonical state root, receipts root, gas used and logs bloom",
+	}
 	indexerEnableFlag = cli.BoolFlag{
 		Name:  "indexer.enabled",
-		Usage: "Enable chain indexer",
+		Usage: "Enable chain indexer, proxy implementations of contracts called in monitored blocks are recorded",
+	}
+	checkpointIntervalFlag = cli.Uint64Flag{
+		Name:  "checkpoint.interval",
+		Usage: "Persist the replayed state every given number of blocks so reexec tasks can start from it (0 = disabled)",
 	}
 )
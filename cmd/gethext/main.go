@@ -224,7 +224,9 @@ var (
 		pluginsDirFlag,
 		pluginsEnabledFlag,
 		monitorEnableFlag,
+		monitorVerifyFlag,
 		indexerEnableFlag,
+		checkpointIntervalFlag,
 	}
 )
 
@@ -267,6 +269,7 @@ func init() {
 		snapshotCommand,
 		blsCommand,
 		extdbCommand,
+		pluginCommand,
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 
@@ -338,6 +341,8 @@ func geth(ctx *cli.Context) error {
 		InstanceDir: stack.InstanceDir(),
 		Plugins:     &cfg.Plugins,
 		Monitor:     &cfg.Monitor,
+		Sinks:       &cfg.Sinks,
+		Checkpoints: &cfg.Checkpoints,
 	}
 	ethexplorer, err := NewExplorerService(serviceCfg, stack, ethereum)
 	if err != nil {
@@ -6,16 +6,91 @@
 
 package monitor
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	QueuePolicyBlock = "block" // Wait for the processor when its queue is full
+	QueuePolicyDrop  = "drop"  // Drop events when the processor queue is full
+)
+
 var (
 	DefaultConfig = Config{
-		Enabled: false,
+		Enabled:   false,
+		Processor: DefaultProcessorConfig,
+	}
+
+	DefaultProcessorConfig = ProcessorConfig{
+		CallBudget:  100 * time.Millisecond,
+		BlockBudget: time.Second,
+		QueueSize:   4096,
+		QueuePolicy: QueuePolicyBlock,
 	}
 )
 
+// ProcessorConfig sets the time budgets of a processor and how it is run
+type ProcessorConfig struct {
+	CallBudget  time.Duration // Maximum duration of a single hook call, overruns are recorded in metrics. 0 disables the budget
+	BlockBudget time.Duration // Maximum total duration of hook calls per block, overruns are recorded in metrics. 0 disables the budget
+	Async       bool          // Run the processor on its own goroutine so it does not delay other processors, its hooks have no state and EVM
+	QueueSize   int           // Size of the event queue of an async processor
+	QueuePolicy string        // What to do when the queue of an async processor is full, "block" or "drop"
+}
+
+func (cfg *ProcessorConfig) Sanitize() error {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultProcessorConfig.QueueSize
+	}
+	switch cfg.QueuePolicy {
+	case "":
+		cfg.QueuePolicy = DefaultProcessorConfig.QueuePolicy
+	case QueuePolicyBlock, QueuePolicyDrop:
+	default:
+		return fmt.Errorf("invalid queue policy %q", cfg.QueuePolicy)
+	}
+	return nil
+}
+
 type Config struct {
-	Enabled bool
+	Enabled      bool
+	VerifyReplay bool // Compare every replayed block with the canonical block, processors must implement reexec.BlockHook
+	DecodeCalls  bool // Annotate call frames passed to processors with ABI decoded data
+	Indexer      bool // Index the proxy implementations of contracts called in monitored blocks
+
+	Processor  ProcessorConfig            // Default config of processors
+	Processors map[string]ProcessorConfig `toml:",omitempty"` // Configs of processors by name, override the default config
+}
+
+// processorConfig returns the config of the named processor
+func (cfg *Config) processorConfig(name string) ProcessorConfig {
+	if procCfg, exist := cfg.Processors[name]; exist {
+		return procCfg
+	}
+	return cfg.Processor
 }
 
 func (cfg *Config) Sanitize() error {
+	if err := cfg.Processor.Sanitize(); err != nil {
+		return err
+	}
+	for name, procCfg := range cfg.Processors {
+		if err := procCfg.Sanitize(); err != nil {
+			return fmt.Errorf("processor %s: %w", name, err)
+		}
+		cfg.Processors[name] = procCfg
+	}
+	// the indexer reads the state after every block, which detached contexts do not have
+	if indexerCfg := cfg.processorConfig(contractIndexerName); cfg.Indexer && indexerCfg.Async {
+		log.Warn("Contract indexer can not run asynchronously, running it synchronously")
+		indexerCfg.Async = false
+		if cfg.Processors == nil {
+			cfg.Processors = make(map[string]ProcessorConfig)
+		}
+		cfg.Processors[contractIndexerName] = indexerCfg
+	}
 	return nil
 }
@@ -31,3 +31,19 @@ func (h *monitorHook) OnTxEnd(ctx *reexec.Context, ret *reexec.TxResult, resetGa
 		proc.OnTxEnd(ctx, ret, resetGas)
 	}
 }
+
+func (h *monitorHook) OnBlockCommit(ctx *reexec.Context) {
+	for _, proc := range h.processors {
+		if blockProc, ok := proc.(reexec.BlockHook); ok {
+			blockProc.OnBlockCommit(ctx)
+		}
+	}
+}
+
+func (h *monitorHook) OnBlockDiscard(ctx *reexec.Context, report *reexec.DivergenceReport) {
+	for _, proc := range h.processors {
+		if blockProc, ok := proc.(reexec.BlockHook); ok {
+			blockProc.OnBlockDiscard(ctx, report)
+		}
+	}
+}
@@ -123,15 +123,18 @@ func (s *blockIndexData) commitChanges(batch ethdb.Batch, withState bool) error
 
 func (s *blockIndexData) commitAccounts(batch ethdb.Batch) error {
 	for addr, acc := range s.dirtyAccounts {
+		if isEmptyAccountInfo(acc.AccountInfo) && acc.ContractInfo == nil {
+			continue
+		}
 		if !isEmptyAccountInfo(acc.AccountInfo) {
 			enc, _ := rlp.EncodeToBytes(acc.AccountInfo)
 			extdb.WriteAccountInfo(batch, addr, enc)
-			if acc.ContractInfo != nil {
-				enc, _ := rlp.EncodeToBytes(acc.ContractInfo)
-				extdb.WriteContractInfo(batch, addr, enc)
-			}
-			s.indexdb.cacheAccountDetail(addr, acc)
 		}
+		if acc.ContractInfo != nil {
+			enc, _ := rlp.EncodeToBytes(acc.ContractInfo)
+			extdb.WriteContractInfo(batch, addr, enc)
+		}
+		s.indexdb.cacheAccountDetail(addr, acc)
 	}
 	return nil
 }
@@ -66,13 +66,20 @@ func (db *IndexDB) AccountDetail(addr common.Address) (*AccountDetail, error) {
 		return cached.(*AccountDetail), nil
 	}
 	accInfo, err := db.readAccountInfo(addr)
-	if err != nil {
+	if err != nil && err != ErrNoAccountInfo {
 		return nil, err
 	}
 	contractInfo, err := db.readContractInfo(addr)
-	if err != ErrNoContractInfo {
+	if err != nil && err != ErrNoContractInfo {
 		return nil, err
 	}
+	if accInfo == nil {
+		// contracts may be indexed without account info
+		if contractInfo == nil {
+			return nil, ErrNoAccountInfo
+		}
+		accInfo = new(AccountInfo)
+	}
 	detail := &AccountDetail{
 		Address:      addr,
 		AccountInfo:  accInfo,
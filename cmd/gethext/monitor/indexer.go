@@ -0,0 +1,100 @@
+package monitor
+
+import (
+	"github.com/ethereum/go-ethereum/cmd/gethext/abiutils"
+	"github.com/ethereum/go-ethereum/cmd/gethext/reexec"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const contractIndexerName = "indexer"
+
+// contractIndexer records the proxy type and implementations of the contracts called
+// in every committed block, resolved at the state after the block
+type contractIndexer struct {
+	indexdb   *IndexDB
+	block     common.Hash                 // Block the called contracts were collected from
+	contracts map[common.Address]struct{} // Contracts called in the current block
+}
+
+func (c *contractIndexer) Name() string {
+	return contractIndexerName
+}
+
+func (c *contractIndexer) collectContracts(frames []reexec.CallFrame) {
+	for _, frame := range frames {
+		if frame.Type != vm.CREATE && frame.Type != vm.CREATE2 && frame.Type != vm.SELFDESTRUCT {
+			c.contracts[frame.To] = struct{}{}
+		}
+		c.collectContracts(frame.Calls)
+	}
+}
+
+func (c *contractIndexer) OnTxStart(ctx *reexec.Context, gasLimit uint64) {}
+
+func (c *contractIndexer) OnCallEnter(ctx *reexec.Context, call *reexec.CallFrame) {}
+
+func (c *contractIndexer) OnCallExit(ctx *reexec.Context, call *reexec.CallFrame) {}
+
+func (c *contractIndexer) OnTxEnd(ctx *reexec.Context, ret *reexec.TxResult, restGas uint64) {
+	if hash := ctx.Block().Hash(); hash != c.block {
+		c.block, c.contracts = hash, make(map[common.Address]struct{})
+	}
+	c.collectContracts(ret.CallStack)
+}
+
+func (c *contractIndexer) OnBlockCommit(ctx *reexec.Context) {
+	if ctx.Block().Hash() != c.block {
+		return
+	}
+	if err := c.indexProxies(ctx.Block(), ctx.State()); err != nil {
+		log.Error("Could not index proxy contracts", "number", ctx.Block().NumberU64(), "error", err)
+	}
+	c.reset()
+}
+
+func (c *contractIndexer) OnBlockDiscard(ctx *reexec.Context, report *reexec.DivergenceReport) {
+	c.reset()
+}
+
+// reset drops the collected contracts, the same block may be replayed again after a
+// reorg or a discard and starts a new collection then
+func (c *contractIndexer) reset() {
+	c.block, c.contracts = common.Hash{}, nil
+}
+
+// indexProxies records the current implementation of every called proxy, contract info
+// is only written if the implementation changed
+func (c *contractIndexer) indexProxies(block *types.Block, state abiutils.ProxyState) error {
+	data := newBlockIndexData(c.indexdb, block)
+	for addr := range c.contracts {
+		proxy, err := abiutils.DetectProxy(state, addr)
+		if err != nil {
+			continue
+		}
+		detail, err := c.indexdb.AccountDetail(addr)
+		if err == ErrNoAccountInfo {
+			detail = &AccountDetail{addr, &AccountInfo{}, nil}
+		} else if err != nil {
+			return err
+		}
+		if detail.ContractInfo == nil {
+			detail.ContractInfo = new(ContractInfo)
+		}
+		if detail.ContractInfo.SetImplementation(proxy.Type, proxy.Implementation, block.NumberU64()) {
+			log.Debug("Indexed proxy implementation", "proxy", addr, "type", proxy.Type, "implementation", proxy.Implementation, "number", block.NumberU64())
+			data.SetAccountDetail(detail)
+		}
+	}
+	batch := c.indexdb.NewBatch()
+	if err := data.Commit(batch, false); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+func newContractIndexer(indexdb *IndexDB) *contractIndexer {
+	return &contractIndexer{indexdb: indexdb}
+}
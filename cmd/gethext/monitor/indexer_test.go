@@ -0,0 +1,87 @@
+package monitor
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/cmd/gethext/abiutils"
+	"github.com/ethereum/go-ethereum/cmd/gethext/reexec"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContractIndexerProxyUpgrade(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		indexer = newContractIndexer(NewIndexDB(db, state.NewDatabase(db)))
+		proxy   = common.HexToAddress("0x01")
+		caller  = common.HexToAddress("0x02")
+		impl1   = common.HexToAddress("0x03")
+		impl2   = common.HexToAddress("0x04")
+		slot    = crypto.Keccak256Hash([]byte("eip1967.proxy.implementation")).Big()
+		implKey = common.BigToHash(slot.Sub(slot, common.Big1))
+	)
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	require.NoError(t, err)
+	statedb.SetCode(proxy, []byte{0x60, 0x00})
+	statedb.SetCode(impl1, []byte{0x60, 0x01})
+	statedb.SetCode(impl2, []byte{0x60, 0x02})
+
+	// the proxy is called by a contract in every block
+	indexBlock := func(number int64, impl common.Address) {
+		statedb.SetState(proxy, implKey, common.BytesToHash(impl.Bytes()))
+		indexer.contracts = map[common.Address]struct{}{}
+		indexer.collectContracts([]reexec.CallFrame{{Type: vm.CALL, To: caller, Calls: []reexec.CallFrame{{Type: vm.DELEGATECALL, To: proxy}}}})
+		require.NoError(t, indexer.indexProxies(types.NewBlockWithHeader(&types.Header{Number: big.NewInt(number)}), statedb))
+	}
+	indexBlock(1, impl1)
+	indexBlock(2, impl1)
+	indexBlock(3, impl2)
+	indexBlock(4, impl2)
+
+	// implementations are read back from disk
+	detail, err := NewIndexDB(db, state.NewDatabase(db)).AccountDetail(proxy)
+	require.NoError(t, err)
+	require.NotNil(t, detail.ContractInfo)
+	assert.Equal(t, abiutils.ProxyEIP1967, detail.ContractInfo.ProxyType)
+	assert.Equal(t, []ProxyImplementation{{impl1, 1}, {impl2, 3}}, detail.ContractInfo.Implementations)
+	assert.Equal(t, impl2, detail.ContractInfo.Implementation())
+
+	// contracts which are not proxies are not indexed
+	_, err = NewIndexDB(db, state.NewDatabase(db)).AccountDetail(caller)
+	assert.ErrorIs(t, err, ErrNoAccountInfo)
+}
+
+func TestContractIndexerReplayedBlock(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	indexer := newContractIndexer(NewIndexDB(db, state.NewDatabase(db)))
+	ctx := newTestContext(t, 1)
+	result := &reexec.TxResult{CallStack: []reexec.CallFrame{{Type: vm.CALL, To: common.HexToAddress("0x01")}}}
+
+	// the same block is collected again after it was committed or discarded
+	indexer.OnTxEnd(ctx, result, 0)
+	indexer.OnBlockCommit(ctx)
+	indexer.OnTxEnd(ctx, result, 0)
+	indexer.OnBlockDiscard(ctx, nil)
+	indexer.OnTxEnd(ctx, result, 0)
+	assert.Len(t, indexer.contracts, 1)
+	indexer.OnBlockCommit(ctx)
+	assert.Nil(t, indexer.contracts)
+}
+
+func TestContractIndexerSync(t *testing.T) {
+	cfg := &Config{Indexer: true, Processor: ProcessorConfig{Async: true}}
+	require.NoError(t, cfg.Sanitize())
+	assert.False(t, cfg.processorConfig(contractIndexerName).Async)
+	assert.True(t, cfg.processorConfig("other").Async)
+
+	cfg = &Config{Indexer: true, Processors: map[string]ProcessorConfig{contractIndexerName: {Async: true, QueueSize: 8}}}
+	require.NoError(t, cfg.Sanitize())
+	assert.Equal(t, ProcessorConfig{QueueSize: 8, QueuePolicy: QueuePolicyBlock}, cfg.processorConfig(contractIndexerName))
+}
@@ -12,7 +12,9 @@ import (
 	"runtime/debug"
 	"sync"
 
+	"github.com/ethereum/go-ethereum/cmd/gethext/abiutils"
 	"github.com/ethereum/go-ethereum/cmd/gethext/reexec"
+	"github.com/ethereum/go-ethereum/cmd/gethext/sink"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
@@ -31,8 +33,9 @@ type ChainMonitor struct {
 	config     *Config
 	blockchain *core.BlockChain
 	replayer   *reexec.ChainReplayer
+	sinks      *sink.Manager // Sinks of processors emitting records
 
-	processors   map[Processor]bool
+	processors   map[Processor]*processorRunner
 	chainHeadSub event.Subscription
 	chainHeadCh  chan core.ChainHeadEvent
 
@@ -43,11 +46,11 @@ type ChainMonitor struct {
 }
 
 func (m *ChainMonitor) getProcessors() []Processor {
-	ret := make([]Processor, 0)
-	for proc, enabled := range m.processors {
-		if enabled {
-			ret = append(ret, proc)
-		}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	ret := make([]Processor, 0, len(m.processors))
+	for _, runner := range m.processors {
+		ret = append(ret, runner)
 	}
 	return ret
 }
@@ -62,8 +65,10 @@ func (m *ChainMonitor) processBlock(ctx context.Context, block *types.Block) {
 	hook := &monitorHook{m.getProcessors()}
 	_, err := m.replayer.ReplayBlock(ctx, block, nil, hook)
 	if err != nil {
+		log.Error("ChainMonitor could not replay block", "number", block.NumberU64(), "error", err)
 		return
 	}
+	m.sinks.Flush()
 }
 
 func (m *ChainMonitor) eventLoop() {
@@ -106,34 +111,70 @@ func (m *ChainMonitor) Stop() error {
 		m.cancel()
 	}
 	m.wg.Wait()
+	m.mtx.Lock()
+	for proc, runner := range m.processors {
+		runner.stop()
+		delete(m.processors, proc)
+	}
+	m.mtx.Unlock()
 	log.Info("ChainMonitor stopped")
 	return nil
 }
 
+// AddProcessor registers the processor to process every new block. If replayed blocks
+// are verified, processors must implement reexec.BlockHook, others are refused.
 func (m *ChainMonitor) AddProcessor(proc Processor) {
+	if _, ok := proc.(reexec.BlockHook); m.config.VerifyReplay && !ok {
+		log.Error("Could not add processor", "processor", processorName(proc), "error", reexec.ErrBlockHookRequired)
+		return
+	}
+	if err := m.sinks.Attach(proc); err != nil {
+		log.Error("Could not open sink of processor", "error", err)
+	}
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
-	m.processors[proc] = true
+	if _, exist := m.processors[proc]; exist {
+		return
+	}
+	runner := newProcessorRunner(proc, m.config)
+	runner.start()
+	m.processors[proc] = runner
 }
 
 func (m *ChainMonitor) RemoveProcessor(proc Processor) {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
-	delete(m.processors, proc)
+	if runner, exist := m.processors[proc]; exist {
+		runner.stop()
+		delete(m.processors, proc)
+	}
 }
 
-func NewChainMonitor(cfg *Config, db ethdb.Database, bc *core.BlockChain) (*ChainMonitor, error) {
+func NewChainMonitor(cfg *Config, db ethdb.Database, checkpoints *reexec.CheckpointStore, bc *core.BlockChain, sinks *sink.Manager) (*ChainMonitor, error) {
 	if err := cfg.Sanitize(); err != nil {
 		return nil, err
 	}
 	// MaxTrieInMemory is set to 128, ensuring the state trie stays in the blockchain's state cache (state.Database).
 	// For monitoring, we only re-execute the lastest block, so we can use the blockchain's state cache directly.
+	// Monitored states are checkpointed before they are pruned, so reexec tasks can start from them.
 	replayer := reexec.NewChainReplayer(bc.StateCache(), bc)
-	return &ChainMonitor{
+	if checkpoints != nil {
+		replayer.SetCheckpoints(checkpoints)
+	}
+	replayer.SetVerify(cfg.VerifyReplay)
+	if cfg.DecodeCalls {
+		replayer.SetCallDecoder(abiutils.NewCallDecoder(abiutils.DefaultParser()))
+	}
+	monitor := &ChainMonitor{
 		config:     cfg,
 		blockchain: bc,
 		replayer:   replayer,
+		sinks:      sinks,
 		quitCh:     make(chan struct{}),
-		processors: make(map[Processor]bool),
-	}, nil
+		processors: make(map[Processor]*processorRunner),
+	}
+	if cfg.Indexer {
+		monitor.AddProcessor(newContractIndexer(NewIndexDB(db, bc.StateCache())))
+	}
+	return monitor, nil
 }
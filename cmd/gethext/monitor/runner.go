@@ -0,0 +1,235 @@
+package monitor
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/gethext/reexec"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// NamedProcessor is an optional interface of Processor, the name selects the processor
+// config and labels its metrics. Unnamed processors are named by their type.
+type NamedProcessor interface {
+	Name() string
+}
+
+func processorName(proc Processor) string {
+	if named, ok := proc.(NamedProcessor); ok {
+		return named.Name()
+	}
+	return strings.TrimPrefix(fmt.Sprintf("%T", proc), "*")
+}
+
+type hookKind int
+
+const (
+	hookTxStart hookKind = iota
+	hookCallEnter
+	hookCallExit
+	hookTxEnd
+	hookBlockCommit
+	hookBlockDiscard
+)
+
+// hookEvent is a hook call of a processor
+type hookEvent struct {
+	kind   hookKind
+	ctx    *reexec.Context
+	gas    uint64
+	call   *reexec.CallFrame
+	ret    *reexec.TxResult
+	report *reexec.DivergenceReport
+}
+
+// detach copies the replay context and call frames of the event, they are mutated
+// while the block is replayed so queued events can not refer to them. The state and
+// EVM are not copied, the detached context has none.
+func (ev *hookEvent) detach() *hookEvent {
+	ret := *ev
+	ret.ctx = ev.ctx.Detached()
+	if ev.call != nil {
+		call := *ev.call
+		ret.call = &call
+	}
+	if ev.ret != nil {
+		txResult := *ev.ret
+		ret.ret = &txResult
+	}
+	return &ret
+}
+
+// processorRunner calls the hooks of a processor and accounts the time it spends
+// against its budgets. An async processor runs on its own goroutine and receives
+// hook calls through a bounded queue, the replay may already have moved on when it
+// is called, so its context has no state and no EVM.
+type processorRunner struct {
+	name   string
+	proc   Processor
+	config ProcessorConfig
+
+	block     common.Hash   // Block the processor is processing
+	blockTime time.Duration // Time spent in hooks for the current block
+	overrun   bool          // Whether the block budget was exceeded for the current block
+
+	queue  chan *hookEvent
+	quitCh chan struct{}
+	wg     sync.WaitGroup
+
+	callTimer      metrics.Timer
+	callOverruns   metrics.Counter
+	blockOverruns  metrics.Counter
+	droppedEvents  metrics.Counter
+	queueSizeGauge metrics.Gauge
+}
+
+func (r *processorRunner) dispatch(ev *hookEvent) {
+	if hash := ev.ctx.Block().Hash(); hash != r.block {
+		r.block, r.blockTime, r.overrun = hash, 0, false
+	}
+	start := time.Now()
+	switch ev.kind {
+	case hookTxStart:
+		r.proc.OnTxStart(ev.ctx, ev.gas)
+	case hookCallEnter:
+		r.proc.OnCallEnter(ev.ctx, ev.call)
+	case hookCallExit:
+		r.proc.OnCallExit(ev.ctx, ev.call)
+	case hookTxEnd:
+		r.proc.OnTxEnd(ev.ctx, ev.ret, ev.gas)
+	case hookBlockCommit:
+		if blockProc, ok := r.proc.(reexec.BlockHook); ok {
+			blockProc.OnBlockCommit(ev.ctx)
+		}
+	case hookBlockDiscard:
+		if blockProc, ok := r.proc.(reexec.BlockHook); ok {
+			blockProc.OnBlockDiscard(ev.ctx, ev.report)
+		}
+	}
+	elapsed := time.Since(start)
+	r.callTimer.Update(elapsed)
+	if r.config.CallBudget > 0 && elapsed > r.config.CallBudget {
+		r.callOverruns.Inc(1)
+		log.Debug("Processor exceeded call budget", "processor", r.name, "elapsed", common.PrettyDuration(elapsed), "budget", r.config.CallBudget)
+	}
+	r.blockTime += elapsed
+	if r.config.BlockBudget > 0 && r.blockTime > r.config.BlockBudget && !r.overrun {
+		r.overrun = true
+		r.blockOverruns.Inc(1)
+		log.Warn("Processor exceeded block budget", "processor", r.name, "number", ev.ctx.Block().NumberU64(), "elapsed", common.PrettyDuration(r.blockTime), "budget", r.config.BlockBudget)
+	}
+}
+
+// send runs the hook, or queues it if the processor is async
+func (r *processorRunner) send(ev *hookEvent) {
+	if r.queue == nil {
+		r.dispatch(ev)
+		return
+	}
+	ev = ev.detach()
+	// block events are never dropped, so async processors always see the end of a block
+	if r.config.QueuePolicy == QueuePolicyDrop && ev.kind < hookBlockCommit {
+		select {
+		case r.queue <- ev:
+		case <-r.quitCh:
+		default:
+			r.droppedEvents.Inc(1)
+		}
+	} else {
+		select {
+		case r.queue <- ev:
+		case <-r.quitCh:
+		}
+	}
+	r.queueSizeGauge.Update(int64(len(r.queue)))
+}
+
+// safeDispatch keeps the goroutine of an async processor running if a hook panics
+func (r *processorRunner) safeDispatch(ev *hookEvent) {
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error(fmt.Sprintf("Processor %s panic: %#v\n%s", r.name, err, debug.Stack()))
+		}
+	}()
+	r.dispatch(ev)
+}
+
+func (r *processorRunner) loop() {
+	defer r.wg.Done()
+	for {
+		select {
+		case ev := <-r.queue:
+			r.safeDispatch(ev)
+		case <-r.quitCh:
+			// run the events queued before stopping, so the processor sees the end of the block
+			for {
+				select {
+				case ev := <-r.queue:
+					r.safeDispatch(ev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *processorRunner) OnTxStart(ctx *reexec.Context, gasLimit uint64) {
+	r.send(&hookEvent{kind: hookTxStart, ctx: ctx, gas: gasLimit})
+}
+
+func (r *processorRunner) OnCallEnter(ctx *reexec.Context, call *reexec.CallFrame) {
+	r.send(&hookEvent{kind: hookCallEnter, ctx: ctx, call: call})
+}
+
+func (r *processorRunner) OnCallExit(ctx *reexec.Context, call *reexec.CallFrame) {
+	r.send(&hookEvent{kind: hookCallExit, ctx: ctx, call: call})
+}
+
+func (r *processorRunner) OnTxEnd(ctx *reexec.Context, ret *reexec.TxResult, restGas uint64) {
+	r.send(&hookEvent{kind: hookTxEnd, ctx: ctx, ret: ret, gas: restGas})
+}
+
+func (r *processorRunner) OnBlockCommit(ctx *reexec.Context) {
+	r.send(&hookEvent{kind: hookBlockCommit, ctx: ctx})
+}
+
+func (r *processorRunner) OnBlockDiscard(ctx *reexec.Context, report *reexec.DivergenceReport) {
+	r.send(&hookEvent{kind: hookBlockDiscard, ctx: ctx, report: report})
+}
+
+func (r *processorRunner) start() {
+	if !r.config.Async {
+		return
+	}
+	r.queue = make(chan *hookEvent, r.config.QueueSize)
+	r.wg.Add(1)
+	go r.loop()
+}
+
+// stop stops the goroutine of an async processor once the queued events were run
+func (r *processorRunner) stop() {
+	close(r.quitCh)
+	r.wg.Wait()
+}
+
+func newProcessorRunner(proc Processor, config *Config) *processorRunner {
+	name := processorName(proc)
+	prefix := "gethext/monitor/processor/" + strings.NewReplacer("/", "_", ".", "_").Replace(name)
+	return &processorRunner{
+		name:           name,
+		proc:           proc,
+		config:         config.processorConfig(name),
+		quitCh:         make(chan struct{}),
+		callTimer:      metrics.GetOrRegisterTimer(prefix+"/call", nil),
+		callOverruns:   metrics.GetOrRegisterCounter(prefix+"/overrun/call", nil),
+		blockOverruns:  metrics.GetOrRegisterCounter(prefix+"/overrun/block", nil),
+		droppedEvents:  metrics.GetOrRegisterCounter(prefix+"/dropped", nil),
+		queueSizeGauge: metrics.GetOrRegisterGauge(prefix+"/queue", nil),
+	}
+}
@@ -0,0 +1,258 @@
+package monitor
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/gethext/reexec"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProcessor records the hooks it was called with, if gate is set every call
+// signals entered then waits for the gate
+type testProcessor struct {
+	name    string
+	delay   time.Duration
+	entered chan struct{}
+	gate    chan struct{}
+
+	hooks     []hookKind
+	withState []bool // Whether the context of each hook had a state
+	mtx       sync.Mutex
+}
+
+func (p *testProcessor) Name() string {
+	return p.name
+}
+
+func (p *testProcessor) record(kind hookKind, ctx *reexec.Context) {
+	if p.gate != nil {
+		p.entered <- struct{}{}
+		<-p.gate
+	}
+	time.Sleep(p.delay)
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.hooks = append(p.hooks, kind)
+	p.withState = append(p.withState, ctx.State() != nil)
+}
+
+func (p *testProcessor) recorded() ([]hookKind, []bool) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return append([]hookKind{}, p.hooks...), append([]bool{}, p.withState...)
+}
+
+func (p *testProcessor) OnTxStart(ctx *reexec.Context, gasLimit uint64) {
+	p.record(hookTxStart, ctx)
+}
+
+func (p *testProcessor) OnCallEnter(ctx *reexec.Context, call *reexec.CallFrame) {
+	p.record(hookCallEnter, ctx)
+}
+
+func (p *testProcessor) OnCallExit(ctx *reexec.Context, call *reexec.CallFrame) {
+	p.record(hookCallExit, ctx)
+}
+
+func (p *testProcessor) OnTxEnd(ctx *reexec.Context, ret *reexec.TxResult, restGas uint64) {
+	p.record(hookTxEnd, ctx)
+}
+
+func (p *testProcessor) OnBlockCommit(ctx *reexec.Context) {
+	p.record(hookBlockCommit, ctx)
+}
+
+func (p *testProcessor) OnBlockDiscard(ctx *reexec.Context, report *reexec.DivergenceReport) {
+	p.record(hookBlockDiscard, ctx)
+}
+
+// txProcessor only implements the transaction hooks
+type txProcessor struct {
+	reexec.TransactionHook
+}
+
+// newTestContext returns a replay context of an empty block with the given number
+func newTestContext(t *testing.T, number int64) *reexec.Context {
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	block := types.NewBlockWithHeader(&types.Header{Number: big.NewInt(number)})
+	return reexec.NewCallTracerWithHook(block, types.HomesteadSigner{}, statedb, nil).(*reexec.CallTracerWithHook).Context
+}
+
+func enableMetrics(t *testing.T) {
+	enabled := metrics.Enabled
+	metrics.Enabled = true
+	t.Cleanup(func() { metrics.Enabled = enabled })
+}
+
+func waitEntered(t *testing.T, proc *testProcessor) {
+	select {
+	case <-proc.entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("processor was not called")
+	}
+}
+
+func TestProcessorRunnerBudgets(t *testing.T) {
+	enableMetrics(t)
+	proc := &testProcessor{name: "test/budgets", delay: 5 * time.Millisecond}
+	runner := newProcessorRunner(proc, &Config{Processor: ProcessorConfig{CallBudget: time.Millisecond, BlockBudget: 12 * time.Millisecond}})
+	runner.start()
+	defer runner.stop()
+
+	// every call exceeds the call budget, the block budget is exceeded once per block
+	for _, number := range []int64{1, 2} {
+		ctx := newTestContext(t, number)
+		for i := 0; i < 3; i++ {
+			runner.OnTxStart(ctx, 0)
+		}
+		runner.OnBlockCommit(ctx)
+	}
+	assert.Equal(t, int64(8), runner.callTimer.Count())
+	assert.Equal(t, int64(8), runner.callOverruns.Count())
+	assert.Equal(t, int64(2), runner.blockOverruns.Count())
+
+	// metrics are labelled by the processor name
+	assert.Equal(t, runner.callOverruns, metrics.DefaultRegistry.Get("gethext/monitor/processor/test_budgets/overrun/call"))
+
+	// processors run synchronously see the state
+	hooks, withState := proc.recorded()
+	assert.Len(t, hooks, 8)
+	assert.NotContains(t, withState, false)
+}
+
+func TestProcessorRunnerQueueDrop(t *testing.T) {
+	enableMetrics(t)
+	proc := &testProcessor{name: "test/drop", entered: make(chan struct{}), gate: make(chan struct{})}
+	runner := newProcessorRunner(proc, &Config{Processor: ProcessorConfig{Async: true, QueueSize: 1, QueuePolicy: QueuePolicyDrop}})
+	runner.start()
+	defer runner.stop()
+
+	// the first event is running, the second one is queued and the third one dropped
+	ctx := newTestContext(t, 1)
+	runner.OnTxStart(ctx, 0)
+	waitEntered(t, proc)
+	runner.OnTxEnd(ctx, &reexec.TxResult{}, 0)
+	runner.OnCallEnter(ctx, &reexec.CallFrame{})
+	assert.Equal(t, int64(1), runner.droppedEvents.Count())
+
+	// block events are never dropped, they wait for the queue
+	done := make(chan struct{})
+	go func() {
+		runner.OnBlockCommit(ctx)
+		close(done)
+	}()
+	close(proc.gate)
+	go func() {
+		for range proc.entered {
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("block event not queued")
+	}
+	require.Eventually(t, func() bool {
+		hooks, _ := proc.recorded()
+		return len(hooks) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	hooks, withState := proc.recorded()
+	assert.Equal(t, []hookKind{hookTxStart, hookTxEnd, hookBlockCommit}, hooks)
+	assert.Equal(t, int64(1), runner.droppedEvents.Count())
+
+	// async processors are called with detached contexts
+	assert.Equal(t, []bool{false, false, false}, withState)
+}
+
+func TestProcessorRunnerQueueBlock(t *testing.T) {
+	proc := &testProcessor{name: "test/block", entered: make(chan struct{}), gate: make(chan struct{})}
+	runner := newProcessorRunner(proc, &Config{Processor: ProcessorConfig{Async: true, QueueSize: 1, QueuePolicy: QueuePolicyBlock}})
+	runner.start()
+	defer runner.stop()
+
+	ctx := newTestContext(t, 1)
+	runner.OnTxStart(ctx, 0)
+	waitEntered(t, proc)
+	runner.OnTxEnd(ctx, &reexec.TxResult{}, 0)
+
+	// the queue is full, the replay waits for the processor
+	done := make(chan struct{})
+	go func() {
+		runner.OnCallEnter(ctx, &reexec.CallFrame{})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("event queued while the queue was full")
+	case <-time.After(50 * time.Millisecond):
+	}
+	proc.gate <- struct{}{}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not queued")
+	}
+	close(proc.gate)
+	go func() {
+		for range proc.entered {
+		}
+	}()
+	require.Eventually(t, func() bool {
+		hooks, _ := proc.recorded()
+		return len(hooks) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	hooks, _ := proc.recorded()
+	assert.Equal(t, []hookKind{hookTxStart, hookTxEnd, hookCallEnter}, hooks)
+}
+
+func TestProcessorRunnerStop(t *testing.T) {
+	proc := &testProcessor{name: "test/stop", entered: make(chan struct{}), gate: make(chan struct{})}
+	runner := newProcessorRunner(proc, &Config{Processor: ProcessorConfig{Async: true, QueueSize: 4, QueuePolicy: QueuePolicyBlock}})
+	runner.start()
+
+	ctx := newTestContext(t, 1)
+	runner.OnTxStart(ctx, 0)
+	waitEntered(t, proc)
+	runner.OnTxEnd(ctx, &reexec.TxResult{}, 0)
+	runner.OnBlockCommit(ctx)
+
+	// the queued events are run before the runner stops
+	stopped := make(chan struct{})
+	go func() {
+		runner.stop()
+		close(stopped)
+	}()
+	close(proc.gate)
+	go func() {
+		for range proc.entered {
+		}
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("runner did not stop")
+	}
+	hooks, _ := proc.recorded()
+	assert.Equal(t, []hookKind{hookTxStart, hookTxEnd, hookBlockCommit}, hooks)
+}
+
+func TestAddProcessorVerifyReplay(t *testing.T) {
+	m := &ChainMonitor{config: &Config{VerifyReplay: true}, processors: make(map[Processor]*processorRunner), quitCh: make(chan struct{})}
+	defer m.Stop()
+
+	// processors can not commit verified results without the block hooks
+	m.AddProcessor(&txProcessor{})
+	assert.Empty(t, m.processors)
+	proc := &testProcessor{name: "test/verify"}
+	m.AddProcessor(proc)
+	assert.Contains(t, m.processors, Processor(proc))
+}
@@ -65,6 +65,35 @@ type ContractInfo struct {
 	MethodSigs []string       // List of 4-bytes method signatures in contract
 	OwnABI     []byte         // JSON ABI which elements are excluded from implemented intefaces
 	Creator    common.Address // Contract creator address
+
+	ProxyType       string                `rlp:"optional"` // Proxy type if the contract is a proxy, see abiutils.DetectProxy
+	Implementations []ProxyImplementation `rlp:"optional"` // Implementations of the proxy from the first to the current one
+}
+
+// ProxyImplementation is an implementation of a proxy contract and the block it was first seen at
+type ProxyImplementation struct {
+	Address common.Address
+	Block   uint64
+}
+
+// Implementation returns the current implementation of the proxy, nil address if
+// the contract is not a proxy
+func (c *ContractInfo) Implementation() common.Address {
+	if len(c.Implementations) == 0 {
+		return nilAddress
+	}
+	return c.Implementations[len(c.Implementations)-1].Address
+}
+
+// SetImplementation records the implementation of the proxy seen at the given block,
+// returns true if it was upgraded since the last record
+func (c *ContractInfo) SetImplementation(proxyType string, impl common.Address, block uint64) bool {
+	c.ProxyType = proxyType
+	if len(c.Implementations) > 0 && c.Implementation() == impl {
+		return false
+	}
+	c.Implementations = append(c.Implementations, ProxyImplementation{Address: impl, Block: block})
+	return true
 }
 
 type AccountDetail struct {
@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	StateEnabled  = "enabled"
+	StateDisabled = "disabled"
+	StateFailed   = "failed" // Disabled because it failed to enable or its process crashed
+)
+
+// PluginInfo describes a loaded plugin and its current state
+type PluginInfo struct {
+	Name         string   `json:"name"`
+	Version      string   `json:"version,omitempty"`
+	APIVersion   int      `json:"apiVersion"`
+	State        string   `json:"state"`
+	Dependencies []string `json:"dependencies,omitempty"`
+	Error        string   `json:"error,omitempty"`
+}
+
+func pluginInfo(pl *loadedPlugin) *PluginInfo {
+	info := &PluginInfo{
+		Name:         pl.name,
+		Version:      pl.manifest.Version,
+		APIVersion:   pl.manifest.APIVersion,
+		State:        StateDisabled,
+		Dependencies: pl.manifest.Dependencies,
+	}
+	if proc, ok := pl.instance.(*processPlugin); ok && info.Version == "" {
+		info.Version = proc.version()
+	}
+	if pl.enabled {
+		info.State = StateEnabled
+	} else if pl.lastErr != nil {
+		info.State = StateFailed
+	}
+	if pl.lastErr != nil {
+		info.Error = pl.lastErr.Error()
+	}
+	return info
+}
+
+// PluginInfo returns the state of a loaded plugin
+func (m *PluginManager) PluginInfo(name string) (*PluginInfo, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	pl, exist := m.plugins[name]
+	if !exist {
+		return nil, errNotFound
+	}
+	return pluginInfo(pl), nil
+}
+
+// PluginInfos returns the state of all loaded plugins sorted by name
+func (m *PluginManager) PluginInfos() []*PluginInfo {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	ret := make([]*PluginInfo, 0, len(m.plugins))
+	for _, pl := range m.plugins {
+		ret = append(ret, pluginInfo(pl))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// APIs returns the RPC APIs of the plugin manager
+func (m *PluginManager) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "plugin",
+			Service:   &PluginAPI{m},
+		},
+	}
+}
+
+// PluginAPI provides an API to manage plugins of a running node
+type PluginAPI struct {
+	m *PluginManager
+}
+
+// List returns all loaded plugins
+func (api *PluginAPI) List() []*PluginInfo {
+	return api.m.PluginInfos()
+}
+
+// Enable enables a plugin and its dependencies
+func (api *PluginAPI) Enable(name string) (*PluginInfo, error) {
+	if err := api.m.EnablePlugin(name); err != nil {
+		return nil, err
+	}
+	return api.m.PluginInfo(name)
+}
+
+// Disable disables a plugin and the plugins depending on it
+func (api *PluginAPI) Disable(name string) (*PluginInfo, error) {
+	if _, err := api.m.PluginInfo(name); err != nil {
+		return nil, err
+	}
+	if err := api.m.DisablePlugin(name); err != nil {
+		return nil, err
+	}
+	return api.m.PluginInfo(name)
+}
+
+// Restart disables and enables a plugin again
+func (api *PluginAPI) Restart(name string) (*PluginInfo, error) {
+	if err := api.m.RestartPlugin(name); err != nil {
+		return nil, err
+	}
+	return api.m.PluginInfo(name)
+}
+
+// ReloadConfig reloads the plugins config file
+func (api *PluginAPI) ReloadConfig() error {
+	return api.m.ReloadConfig()
+}
+
+// Rescan loads new plugins dropped into the plugins binary directory, returns names of the new plugins
+func (api *PluginAPI) Rescan() ([]string, error) {
+	return api.m.Rescan()
+}
+
+// SetLogLevel changes the log level of a plugin, e.g. "debug"
+func (api *PluginAPI) SetLogLevel(name string, level string) error {
+	return api.m.SetLogLevel(name, level)
+}
+
+// Logs returns the most recent log entries of a plugin, all kept entries if limit is not given
+func (api *PluginAPI) Logs(name string, limit *int) ([]*LogEntry, error) {
+	n := 0
+	if limit != nil {
+		n = *limit
+	}
+	return api.m.Logs(name, n)
+}
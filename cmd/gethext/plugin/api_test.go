@@ -0,0 +1,41 @@
+package plugin
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPluginInfos(t *testing.T) {
+	events := []string{}
+	m := newTestManager(&events, map[string][]string{
+		"bot":     nil,
+		"monitor": {"bot"},
+		"jeth":    nil,
+	})
+	m.plugins["jeth"].instance.(*testPlugin).enableErr = errors.New("invalid config")
+	m.config.Enabled = []string{"monitor", "jeth"}
+	m.Start()
+
+	infos := m.PluginInfos()
+	assert.Equal(t, []*PluginInfo{
+		{Name: "bot", APIVersion: APIVersion, State: StateEnabled},
+		{Name: "jeth", APIVersion: APIVersion, State: StateFailed, Error: "invalid config"},
+		{Name: "monitor", APIVersion: APIVersion, State: StateEnabled, Dependencies: []string{"bot"}},
+	}, infos)
+}
+
+func TestPluginRestart(t *testing.T) {
+	events := []string{}
+	m := newTestManager(&events, map[string][]string{
+		"bot":     nil,
+		"monitor": {"bot"},
+	})
+	assert.NoError(t, m.EnablePlugin("monitor"))
+	events = events[:0]
+	assert.NoError(t, m.RestartPlugin("bot"))
+	assert.Equal(t, []string{"disable monitor", "disable bot", "enable bot", "enable monitor"}, events)
+	enabled, _ := m.Status()
+	assert.Len(t, enabled, 2)
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"sync"
 
 	"github.com/naoina/toml"
 )
@@ -41,6 +42,14 @@ type Config struct {
 	BinaryDir  string
 	DataDir    string
 	Enabled    []string
+	Log        LogConfig
+}
+
+// LogConfig configures the logs of plugins
+type LogConfig struct {
+	Levels      map[string]string `toml:",omitempty"` // Log level by plugin name, plugins log at info level by default
+	File        bool              `toml:",omitempty"` // Write the logs of each plugin to logs/plugin.log in its data directory
+	RotateHours int               `toml:",omitempty"` // Hours between log file rotations, defaults to 1
 }
 
 type ConfigStore struct {
@@ -48,10 +57,17 @@ type ConfigStore struct {
 	fileName   string
 	fileInfo   os.FileInfo
 	configData map[string]interface{}
+	mtx        sync.Mutex
 }
 
 // GetConfig retrieves the config for the given name into the provided interface.
 func (c *ConfigStore) GetConfig(name string, cfg interface{}) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.getConfig(name, cfg)
+}
+
+func (c *ConfigStore) getConfig(name string, cfg interface{}) error {
 	var (
 		rawConf interface{}
 		exists  bool
@@ -68,19 +84,43 @@ func (c *ConfigStore) GetConfig(name string, cfg interface{}) error {
 
 // LoadConfig checks for config file changes and loads config to the provided interfaces
 func (c *ConfigStore) LoadConfig(name string, cfg interface{}) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
 	fileInfo, err := os.Stat(c.fileName)
 	if err != nil {
 		return err
 	}
 	if c.fileInfo == nil || fileInfo.ModTime().After(c.fileInfo.ModTime()) {
-		tomlConfig := make(map[string]interface{})
-		if err := loadTOMLConfig(c.fileName, &tomlConfig); err != nil {
+		if err := c.reload(fileInfo); err != nil {
 			return err
 		}
-		c.configData = tomlConfig[c.prefix].(map[string]interface{})
-		c.fileInfo = fileInfo
 	}
-	return c.GetConfig(name, cfg)
+	return c.getConfig(name, cfg)
+}
+
+func (c *ConfigStore) reload(fileInfo os.FileInfo) error {
+	tomlConfig := make(map[string]interface{})
+	if err := loadTOMLConfig(c.fileName, &tomlConfig); err != nil {
+		return err
+	}
+	configData, ok := tomlConfig[c.prefix].(map[string]interface{})
+	if !ok {
+		configData = make(map[string]interface{})
+	}
+	c.configData = configData
+	c.fileInfo = fileInfo
+	return nil
+}
+
+// Reload reloads the config file even if its modification time did not change
+func (c *ConfigStore) Reload() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	fileInfo, err := os.Stat(c.fileName)
+	if err != nil {
+		return err
+	}
+	return c.reload(fileInfo)
 }
 
 func NewConfigStore(prefix, fileName string) *ConfigStore {
@@ -2,50 +2,295 @@ package plugin
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/go-stack/stack"
 )
 
+const (
+	logRingSize       = 512
+	logFileName       = "plugin.log"
+	defaultLogLevel   = log.LvlInfo
+	logFileBufferSize = 4096 // Number of records buffered before they are written to the file
+)
+
+var (
+	logKeyNames = log.RecordKeyNames{Time: "t", Msg: "msg", Lvl: "lvl", Ctx: "ctx"}
+	pluginLogs  = make(map[string]*pluginLog)
+	logsMtx     sync.Mutex
+)
+
+// LogEntry is a log record of a plugin kept in memory
+type LogEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"msg"`
+	Context map[string]string `json:"ctx,omitempty"`
+}
+
+func newLogEntry(r *log.Record) *LogEntry {
+	entry := &LogEntry{
+		Time:    r.Time,
+		Level:   r.Lvl.String(),
+		Message: r.Msg,
+	}
+	if len(r.Ctx) > 0 {
+		entry.Context = make(map[string]string, len(r.Ctx)/2)
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			entry.Context[fmt.Sprint(r.Ctx[i])] = fmt.Sprint(r.Ctx[i+1])
+		}
+	}
+	return entry
+}
+
+// logRing keeps the most recent log entries of a plugin
+type logRing struct {
+	entries []*LogEntry
+	next    int
+	mtx     sync.Mutex
+}
+
+func (r *logRing) add(entry *LogEntry) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if len(r.entries) < logRingSize {
+		r.entries = append(r.entries, entry)
+		return
+	}
+	r.entries[r.next] = entry
+	r.next = (r.next + 1) % logRingSize
+}
+
+// tail returns the last n entries from oldest to newest, all entries if n <= 0
+func (r *logRing) tail(n int) []*LogEntry {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	ordered := append(append([]*LogEntry{}, r.entries[r.next:]...), r.entries[:r.next]...)
+	if n > 0 && n < len(ordered) {
+		ordered = ordered[len(ordered)-n:]
+	}
+	return ordered
+}
+
+// pluginLog is the log output shared by all loggers of a plugin. Records above the
+// plugin level are discarded, the others are kept in the ring buffer, written to the
+// plugin log file if enabled and passed to the root handler, which still applies the
+// node verbosity. So a plugin can log at debug level to its file and ring buffer
+// without turning the whole node to debug level.
+type pluginLog struct {
+	name   string
+	level  int32
+	ring   logRing
+	out    log.Handler // Handler set by SetHandler, nil to use the root handler
+	file   log.Handler
+	writer *log.AsyncFileWriter
+	mtx    sync.RWMutex
+}
+
+func (l *pluginLog) Level() log.Lvl {
+	return log.Lvl(atomic.LoadInt32(&l.level))
+}
+
+func (l *pluginLog) SetLevel(lvl log.Lvl) {
+	atomic.StoreInt32(&l.level, int32(lvl))
+}
+
+func (l *pluginLog) Log(r *log.Record) error {
+	if r.Lvl > l.Level() {
+		return nil
+	}
+	l.ring.add(newLogEntry(r))
+	l.mtx.RLock()
+	out, file := l.out, l.file
+	l.mtx.RUnlock()
+	if file != nil {
+		file.Log(r)
+	}
+	if out == nil {
+		out = log.Root().GetHandler()
+	}
+	tagged := *r
+	tagged.Msg = fmt.Sprintf("[%s] %s", l.name, r.Msg)
+	return out.Log(&tagged)
+}
+
+// openFile writes the logs to a file in dir rotated every rotateHours hours
+func (l *pluginLog) openFile(dir string, rotateHours int) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if rotateHours < 1 {
+		rotateHours = 1
+	}
+	writer := log.NewAsyncFileWriter(filepath.Join(dir, logFileName), logFileBufferSize, rotateHours)
+	if err := writer.Start(); err != nil {
+		return err
+	}
+	l.closeFile()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.writer, l.file = writer, log.StreamHandler(writer, log.LogfmtFormat())
+	return nil
+}
+
+func (l *pluginLog) closeFile() {
+	l.mtx.Lock()
+	writer := l.writer
+	l.writer, l.file = nil, nil
+	l.mtx.Unlock()
+	if writer != nil {
+		writer.Stop()
+	}
+}
+
+func getPluginLog(name string) *pluginLog {
+	logsMtx.Lock()
+	defer logsMtx.Unlock()
+	if pl, exist := pluginLogs[name]; exist {
+		return pl
+	}
+	pl := &pluginLog{name: name, level: int32(defaultLogLevel)}
+	pluginLogs[name] = pl
+	return pl
+}
+
+// logger is a log.Logger writing to the log output of a plugin
 type logger struct {
-	tag string
+	out *pluginLog
+	ctx []interface{}
+}
+
+func (l *logger) write(lvl log.Lvl, msg string, ctx []interface{}) {
+	if lvl > l.out.Level() {
+		return
+	}
+	recCtx := make([]interface{}, 0, len(l.ctx)+len(ctx)+1)
+	recCtx = append(append(recCtx, l.ctx...), ctx...)
+	if len(recCtx)%2 != 0 {
+		recCtx = append(recCtx, nil)
+	}
+	l.out.Log(&log.Record{
+		Time:     time.Now(),
+		Lvl:      lvl,
+		Msg:      msg,
+		Ctx:      recCtx,
+		Call:     stack.Caller(2),
+		KeyNames: logKeyNames,
+	})
 }
 
+// New returns a logger of the same plugin with the given context added
 func (l *logger) New(ctx ...interface{}) log.Logger {
-	return log.Root().New(ctx)
+	return &logger{out: l.out, ctx: append(append([]interface{}{}, l.ctx...), ctx...)}
 }
 
+// GetHandler returns the handler records of the plugin are passed to
 func (l *logger) GetHandler() log.Handler {
-	return log.Root().GetHandler()
+	l.out.mtx.RLock()
+	defer l.out.mtx.RUnlock()
+	if l.out.out == nil {
+		return log.Root().GetHandler()
+	}
+	return l.out.out
 }
 
+// SetHandler replaces the handler records of the plugin are passed to instead of the
+// root handler, it does not change the handler of other loggers
 func (l *logger) SetHandler(h log.Handler) {
-	log.Root().SetHandler(h)
+	l.out.mtx.Lock()
+	defer l.out.mtx.Unlock()
+	l.out.out = h
 }
 
 func (l *logger) Trace(msg string, ctx ...interface{}) {
-	log.Root().Trace(fmt.Sprintf("[%s] %s", l.tag, msg), ctx...)
+	l.write(log.LvlTrace, msg, ctx)
 }
 
 func (l *logger) Debug(msg string, ctx ...interface{}) {
-	log.Root().Debug(fmt.Sprintf("[%s] %s", l.tag, msg), ctx...)
+	l.write(log.LvlDebug, msg, ctx)
 }
 
 func (l *logger) Info(msg string, ctx ...interface{}) {
-	log.Root().Info(fmt.Sprintf("[%s] %s", l.tag, msg), ctx...)
+	l.write(log.LvlInfo, msg, ctx)
 }
 
 func (l *logger) Warn(msg string, ctx ...interface{}) {
-	log.Root().Warn(fmt.Sprintf("[%s] %s", l.tag, msg), ctx...)
+	l.write(log.LvlWarn, msg, ctx)
 }
 
 func (l *logger) Error(msg string, ctx ...interface{}) {
-	log.Root().Error(fmt.Sprintf("[%s] %s", l.tag, msg), ctx...)
+	l.write(log.LvlError, msg, ctx)
 }
 
 func (l *logger) Crit(msg string, ctx ...interface{}) {
-	log.Root().Crit(fmt.Sprintf("[%s] %s", l.tag, msg), ctx...)
+	l.write(log.LvlCrit, msg, ctx)
+	os.Exit(1)
+}
+
+// NewLogger returns a logger of the plugin with the given name, all loggers of a
+// plugin share its level, log file and buffer of recent entries
+func NewLogger(name string) log.Logger {
+	return &logger{out: getPluginLog(name)}
+}
+
+// Logger returns the logger of the plugin
+func (ctx *PluginCtx) Logger() log.Logger {
+	return NewLogger(ctx.name)
+}
+
+// setupLog applies the configured log level of a plugin and opens its log file, it is
+// only called for plugins which passed the compatibility checks
+func (m *PluginManager) setupLog(name string) {
+	out := getPluginLog(name)
+	if lvlStr, exist := m.config.Log.Levels[name]; exist {
+		if lvl, err := log.LvlFromString(lvlStr); err == nil {
+			out.SetLevel(lvl)
+		} else {
+			log.Warn("Invalid plugin log level", "plugin", name, "level", lvlStr, "error", err)
+		}
+	}
+	if m.config.Log.File {
+		dir := filepath.Join(m.config.DataDir, name, "logs")
+		if err := out.openFile(dir, m.config.Log.RotateHours); err != nil {
+			log.Error("Could not open plugin log file", "plugin", name, "error", err)
+		}
+	}
+}
+
+// closeLogs closes the log files of all loaded plugins
+func (m *PluginManager) closeLogs() {
+	for name := range m.plugins {
+		getPluginLog(name).closeFile()
+	}
+}
+
+// SetLogLevel changes the log level of a loaded plugin
+func (m *PluginManager) SetLogLevel(name string, lvlStr string) error {
+	lvl, err := log.LvlFromString(lvlStr)
+	if err != nil {
+		return err
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, exist := m.plugins[name]; !exist {
+		return errNotFound
+	}
+	getPluginLog(name).SetLevel(lvl)
+	log.Info("Changed plugin log level", "plugin", name, "level", lvl)
+	return nil
 }
 
-func NewLogger(tag string) log.Logger {
-	return &logger{tag}
+// Logs returns the last limit log entries of a loaded plugin, all kept entries if limit <= 0
+func (m *PluginManager) Logs(name string, limit int) ([]*LogEntry, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, exist := m.plugins[name]; !exist {
+		return nil, errNotFound
+	}
+	return getPluginLog(name).ring.tail(limit), nil
 }
@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggerLevel(t *testing.T) {
+	var records []*log.Record
+	rootHandler := log.Root().GetHandler()
+	logger := NewLogger("test-level")
+	logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+	// the handler of a plugin logger does not replace the root handler
+	assert.Equal(t, rootHandler, log.Root().GetHandler())
+
+	logger.Debug("hidden")
+	logger.New("block", 1).Info("shown", "tx", 2)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "[test-level] shown", records[0].Msg)
+	assert.Equal(t, []interface{}{"block", 1, "tx", 2}, records[0].Ctx)
+
+	getPluginLog("test-level").SetLevel(log.LvlDebug)
+	logger.Debug("debug")
+	assert.Len(t, records, 2)
+
+	entries := getPluginLog("test-level").ring.tail(0)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "shown", entries[0].Message)
+	assert.Equal(t, map[string]string{"block": "1", "tx": "2"}, entries[0].Context)
+	assert.Equal(t, "debug", entries[1].Message)
+}
+
+func TestLogRing(t *testing.T) {
+	var ring logRing
+	for i := 0; i < logRingSize+10; i++ {
+		ring.add(&LogEntry{Message: string(rune('a' + i%26))})
+	}
+	entries := ring.tail(0)
+	assert.Len(t, entries, logRingSize)
+	assert.Equal(t, string(rune('a'+10%26)), entries[0].Message)
+	last := ring.tail(2)
+	assert.Equal(t, string(rune('a'+(logRingSize+9)%26)), last[1].Message)
+}
+
+func TestPluginLogsAPI(t *testing.T) {
+	events := []string{}
+	m := newTestManager(&events, map[string][]string{"test-api": nil})
+	m.config.DataDir = t.TempDir()
+	m.config.Log = LogConfig{Levels: map[string]string{"test-api": "warn"}, File: true}
+
+	// contexts of incompatible plugins are created without opening a log file
+	m.newPluginCtx("incompatible", func() Plugin { return nil })
+	assert.NoDirExists(t, filepath.Join(m.config.DataDir, "incompatible", "logs"))
+
+	m.setupLog("test-api")
+	defer getPluginLog("test-api").closeFile()
+
+	logger := NewLogger("test-api")
+	logger.SetHandler(log.DiscardHandler())
+	logger.Info("hidden")
+	logger.Warn("warning")
+	entries, err := m.Logs("test-api", 0)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.NoError(t, m.SetLogLevel("test-api", "info"))
+	logger.Info("info")
+	entries, _ = m.Logs("test-api", 1)
+	assert.Equal(t, "info", entries[0].Message)
+	assert.ErrorIs(t, m.SetLogLevel("unknown", "info"), errNotFound)
+	assert.Error(t, m.SetLogLevel("test-api", "loud"))
+
+	getPluginLog("test-api").closeFile()
+	data, err := os.ReadFile(filepath.Join(m.config.DataDir, "test-api", "logs", logFileName))
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(data), "msg=warning"), string(data))
+	assert.False(t, strings.Contains(string(data), "hidden"))
+}
@@ -16,7 +16,9 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/ethereum/go-ethereum/cmd/gethext/extdb"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/node"
 )
@@ -43,15 +45,38 @@ func init() {
 type loadedPlugin struct {
 	ctx      *PluginCtx
 	name     string
+	manifest Manifest
 	instance Plugin
 	enabled  bool
+	lastErr  error // Last error occurred when enabling or disabling the plugin
+
+	incompatible error // Reason the plugin can not run on this host, set if its manifest failed the checks
 }
 
 type PluginManager struct {
 	config  *Config
-	plugins map[string]loadedPlugin
+	plugins map[string]*loadedPlugin
+	enabled []string // Enabled plugins in the order they were enabled
 	ctx     *sharedCtx
 	mtx     sync.Mutex
+	wg      sync.WaitGroup
+	quitCh  chan struct{}
+}
+
+// newPluginCtx creates the context of a plugin, changed configs are passed to the plugin if it handles them
+func (m *PluginManager) newPluginCtx(plname string, instance func() Plugin) *PluginCtx {
+	ctx := &PluginCtx{
+		sharedCtx: m.ctx,
+		name:      plname,
+		DataDir:   filepath.Join(m.config.DataDir, plname),
+	}
+	ctx.configs.onChange = func(old, new interface{}) error {
+		if handler, ok := instance().(ConfigChangeHandler); ok {
+			return handler.OnConfigChanged(old, new)
+		}
+		return nil
+	}
+	return ctx
 }
 
 func (m *PluginManager) loadPlugin(filename string) (*loadedPlugin, error) {
@@ -65,64 +90,158 @@ func (m *PluginManager) loadPlugin(filename string) (*loadedPlugin, error) {
 	if _, err := os.Stat(fullpath); err != nil {
 		return nil, errNotFound
 	}
+	plname := strings.TrimSuffix(filepath.Base(fullpath), pluginExt)
 	plib, err := plugin.Open(fullpath)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", errIncompatiblePlugin, err)
 	}
 	ifunc, err := plib.Lookup(pluginOnLoadFunc)
 	if err != nil {
-		return nil, err
+		return nil, errNotPlugin
+	}
+	plOnload, ok := ifunc.(func(*PluginCtx) Plugin)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has type %T", errIncompatiblePlugin, pluginOnLoadFunc, ifunc)
 	}
-	if plOnload, ok := ifunc.(func(*PluginCtx) Plugin); ok {
-		plname := strings.ReplaceAll(filepath.Base(fullpath), pluginExt, "")
-		plctx := &PluginCtx{
-			sharedCtx: m.ctx,
-			DataDir:   filepath.Join(m.config.DataDir, plname),
+	manifest, err := lookupManifest(plib)
+	if err == nil {
+		err = manifest.CheckCompatibility()
+	}
+	if err != nil {
+		// keep the plugin listed with the reason, it is never loaded nor enabled
+		log.Error("Plugin is not compatible with this host", "plugin", plname, "error", err)
+		pl := &loadedPlugin{
+			ctx:          m.newPluginCtx(plname, func() Plugin { return nil }),
+			name:         plname,
+			manifest:     Manifest{Name: plname},
+			incompatible: err,
+			lastErr:      err,
 		}
-		plinstance := plOnload(plctx)
-		plugin := loadedPlugin{
-			ctx:      plctx,
-			name:     plname,
-			instance: plinstance,
-			enabled:  false,
+		if manifest != nil {
+			pl.manifest = *manifest
+		}
+		m.plugins[plname] = pl
+		return pl, nil
+	}
+	if manifest.Name != plname {
+		log.Warn("Plugin manifest name differs from file name", "plugin", plname, "manifest", manifest.Name)
+	}
+	m.setupLog(plname)
+	var plinstance Plugin
+	plctx := m.newPluginCtx(plname, func() Plugin { return plinstance })
+	plinstance = plOnload(plctx)
+	plugin := &loadedPlugin{
+		ctx:      plctx,
+		name:     plname,
+		manifest: *manifest,
+		instance: plinstance,
+		enabled:  false,
+	}
+	m.plugins[plname] = plugin
+	return plugin, nil
+}
+
+// loadProcessPlugin registers an executable plugin which runs as a child process
+func (m *PluginManager) loadProcessPlugin(filename string) (*loadedPlugin, error) {
+	fullpath := filepath.Join(m.config.BinaryDir, filename)
+	info, err := os.Stat(fullpath)
+	if err != nil {
+		return nil, errNotFound
+	}
+	if info.Mode()&0111 == 0 {
+		return nil, errNotPlugin
+	}
+	plname := strings.TrimSuffix(filename, processPluginExt)
+	m.setupLog(plname)
+	instance := newProcessPlugin(plname, fullpath, m.onProcessExit)
+	plugin := &loadedPlugin{
+		ctx:      m.newPluginCtx(plname, func() Plugin { return instance }),
+		name:     plname,
+		manifest: Manifest{Name: plname, APIVersion: APIVersion},
+		instance: instance,
+		enabled:  false,
+	}
+	m.plugins[plname] = plugin
+	return plugin, nil
+}
+
+// onProcessExit records the error of a crashed plugin process and disables the plugins depending on it
+func (m *PluginManager) onProcessExit(name string, err error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	pl, exist := m.plugins[name]
+	if !exist {
+		return
+	}
+	if pl.enabled {
+		if err := m.disablePlugin(pl); err != nil {
+			log.Error("Error occur when trying to stop plugin", "plugin", name, "error", err)
 		}
-		m.plugins[plname] = plugin
-		return &plugin, nil
 	}
-	return nil, errNotPlugin
+	pl.lastErr = fmt.Errorf("plugin process exited: %v", err)
 }
 
-func (m *PluginManager) loadPlugins() error {
+// loadPlugins loads plugins in BinaryDir which were not loaded yet, returns names of the loaded plugins.
+// Go plugins can not be unloaded, so a changed .so file of a loaded plugin is not reloaded.
+func (m *PluginManager) loadPlugins() ([]string, error) {
+	loaded := []string{}
 	if _, err := os.Stat(m.config.BinaryDir); os.IsNotExist(err) {
-		return nil
+		return loaded, nil
 	}
 	files, err := os.ReadDir(m.config.BinaryDir)
 	if err != nil {
 		log.Error("Failed to read plugins directory", "error", err)
-		return err
+		return nil, err
 	}
-	loaded := []string{}
 	for _, entry := range files {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), pluginExt) {
-			pl, err := m.loadPlugin(entry.Name())
-			if err != nil {
-				log.Error("Could not load plugin", "plugin", entry.Name(), "error", err)
+		if entry.IsDir() {
+			continue
+		}
+		var (
+			pl  *loadedPlugin
+			err error
+		)
+		switch {
+		case strings.HasSuffix(entry.Name(), pluginExt):
+			if _, exist := m.plugins[strings.TrimSuffix(entry.Name(), pluginExt)]; exist {
+				continue
+			}
+			pl, err = m.loadPlugin(entry.Name())
+		case strings.HasSuffix(entry.Name(), processPluginExt):
+			if _, exist := m.plugins[strings.TrimSuffix(entry.Name(), processPluginExt)]; exist {
 				continue
 			}
-			loaded = append(loaded, pl.name)
+			pl, err = m.loadProcessPlugin(entry.Name())
+		default:
+			continue
 		}
+		if err != nil {
+			log.Error("Could not load plugin", "plugin", entry.Name(), "error", err)
+			continue
+		}
+		loaded = append(loaded, pl.name)
 	}
 	log.Info(fmt.Sprintf("Loaded %d plugin(s).", len(loaded)), "plugins", loaded)
-	return nil
+	return loaded, nil
 }
 
-func (m *PluginManager) recoverPanic(plName string) {
-	if err := recover(); err != nil {
-		log.Error(fmt.Sprintf("Plugin %s crashed: %#v", plName, err))
+// Rescan loads new plugins dropped into BinaryDir, returns names of the new plugins
+func (m *PluginManager) Rescan() ([]string, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.loadPlugins()
+}
+
+func (m *PluginManager) recoverPanic(plName string, err *error) {
+	if r := recover(); r != nil {
+		log.Error(fmt.Sprintf("Plugin %s crashed: %#v", plName, r))
+		*err = fmt.Errorf("plugin %s crashed: %v", plName, r)
 	}
 }
 
 func (m *PluginManager) Status() ([]string, []string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
 	enabled := []string{}
 	disabled := []string{}
 	for name, pl := range m.plugins {
@@ -135,45 +254,184 @@ func (m *PluginManager) Status() ([]string, []string) {
 	return enabled, disabled
 }
 
-func (m *PluginManager) EnablePlugin(name string) error {
+func (m *PluginManager) enablePlugin(pl *loadedPlugin) (err error) {
+	defer m.recoverPanic(pl.name, &err)
+	if pl.incompatible != nil {
+		return pl.incompatible
+	}
+	if err := pl.manifest.checkConfig(m.ctx.config); err != nil {
+		return err
+	}
+	for _, dep := range pl.manifest.Dependencies {
+		if !m.plugins[dep].enabled {
+			return fmt.Errorf("dependency %s of plugin %s is not enabled", dep, pl.name)
+		}
+	}
+	if err := m.migrateData(pl.name); err != nil {
+		return err
+	}
+	if err := pl.instance.OnEnable(pl.ctx); err != nil {
+		m.ctx.router.detach(pl.name)
+		m.ctx.services.detach(pl.name)
+		pl.ctx.EventScope.Close()
+		pl.ctx.EventScope = event.SubscriptionScope{}
+		pl.ctx.configs.reset()
+		return err
+	}
+	pl.enabled = true
+	pl.lastErr = nil
+	m.enabled = append(m.enabled, pl.name)
+	return nil
+}
+
+// migrateData moves the data a plugin wrote before its keys were separated from its
+// name, keys of other loaded plugins sharing the name prefix are left to them
+func (m *PluginManager) migrateData(name string) error {
+	moved, err := extdb.MigratePluginData(m.ctx.db, name, func(owner string) bool {
+		_, exist := m.plugins[owner]
+		return exist
+	})
+	if err != nil {
+		return fmt.Errorf("could not migrate data of plugin %s: %v", name, err)
+	}
+	if moved > 0 {
+		log.Info("Migrated plugin data", "plugin", name, "count", moved)
+	}
+	return nil
+}
+
+// enableWithDependencies enables the plugin after its dependencies, plugins in the
+// failed set are not retried and fail their dependents
+func (m *PluginManager) enableWithDependencies(name string, failed map[string]error) error {
+	order, err := m.enableOrder([]string{name})
+	if err != nil {
+		return err
+	}
+	for _, plname := range order {
+		pl := m.plugins[plname]
+		if pl.enabled {
+			continue
+		}
+		if err, exist := failed[plname]; exist {
+			return fmt.Errorf("dependency %s failed: %w", plname, err)
+		}
+		if err := m.enablePlugin(pl); err != nil {
+			pl.lastErr = err
+			failed[plname] = err
+			if plname != name {
+				return fmt.Errorf("dependency %s failed: %w", plname, err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// enabledPlugins returns the enabled plugins in the order they were enabled
+func (m *PluginManager) enabledPlugins() []*loadedPlugin {
 	m.mtx.Lock()
-	defer m.recoverPanic(name)
 	defer m.mtx.Unlock()
-	pl, isExist := m.plugins[name]
-	if !isExist {
-		return errNotFound
+	ret := make([]*loadedPlugin, 0, len(m.enabled))
+	for _, name := range m.enabled {
+		ret = append(ret, m.plugins[name])
 	}
+	return ret
+}
 
-	if err := pl.instance.OnEnable(pl.ctx); err != nil {
+// EnablePlugin enables the plugin and the plugins it depends on
+func (m *PluginManager) EnablePlugin(name string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.enableWithDependencies(name, make(map[string]error))
+}
+
+func (m *PluginManager) disablePlugin(pl *loadedPlugin) (err error) {
+	defer m.recoverPanic(pl.name, &err)
+	dependents := m.dependents(pl.name)
+	for idx := len(dependents) - 1; idx >= 0; idx-- {
+		log.Warn("Disabling dependent plugin", "plugin", dependents[idx], "dependency", pl.name)
+		if err := m.disablePlugin(m.plugins[dependents[idx]]); err != nil {
+			log.Error("Error occur when trying to stop plugin", "plugin", dependents[idx], "error", err)
+		}
+	}
+	pl.enabled = false
+	if idx := indexOf(m.enabled, pl.name); idx >= 0 {
+		m.enabled = append(m.enabled[:idx], m.enabled[idx+1:]...)
+	}
+	m.ctx.router.detach(pl.name)
+	m.ctx.services.detach(pl.name)
+	pl.ctx.configs.reset()
+	pl.ctx.EventScope.Close()
+	// a closed scope can not track new subscriptions, reset it for the next enable
+	pl.ctx.EventScope = event.SubscriptionScope{}
+	if err := pl.instance.OnDisable(pl.ctx); err != nil {
+		pl.lastErr = err
 		return err
 	}
-	pl.enabled = true
 	return nil
 }
 
+// DisablePlugin disables the plugin, the plugins depending on it are disabled first
 func (m *PluginManager) DisablePlugin(name string) error {
 	m.mtx.Lock()
-	defer m.recoverPanic(name)
 	defer m.mtx.Unlock()
 	pl, isExist := m.plugins[name]
-	if !isExist {
+	if !isExist || !pl.enabled {
 		return nil
 	}
+	return m.disablePlugin(pl)
+}
 
-	pl.ctx.EventScope.Close()
-	if err := pl.instance.OnDisable(pl.ctx); err != nil {
+// RestartPlugin disables and enables the plugin again, the plugins depending on it
+// are disabled and enabled along with it
+func (m *PluginManager) RestartPlugin(name string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	pl, isExist := m.plugins[name]
+	if !isExist {
+		return errNotFound
+	}
+	// enabled plugins which were enabled after the plugin may depend on it
+	var restart []string
+	if idx := indexOf(m.enabled, name); idx >= 0 {
+		restart = append(restart, m.enabled[idx+1:]...)
+		if err := m.disablePlugin(pl); err != nil {
+			log.Error("Error occur when trying to stop plugin", "plugin", name, "error", err)
+		}
+	}
+	failed := make(map[string]error)
+	if err := m.enableWithDependencies(name, failed); err != nil {
 		return err
 	}
-	pl.enabled = false
+	for _, plname := range restart {
+		if m.plugins[plname].enabled {
+			continue
+		}
+		if err := m.enableWithDependencies(plname, failed); err != nil {
+			log.Error(fmt.Sprintf("Could not enable plugin %s", plname), "error", err)
+		}
+	}
 	return nil
 }
 
+// ReloadConfig reloads the plugins config file, plugins read the new config next time they load it
+func (m *PluginManager) ReloadConfig() error {
+	return m.ctx.config.Reload()
+}
+
 func (m *PluginManager) Start() error {
+	m.mtx.Lock()
+	failed := make(map[string]error)
 	for _, name := range m.config.Enabled {
-		if err := m.EnablePlugin(name); err != nil {
+		if err := m.enableWithDependencies(name, failed); err != nil {
+			failed[name] = err
 			log.Error(fmt.Sprintf("Could not enable plugin %s", name), "error", err)
 		}
 	}
+	m.mtx.Unlock()
+	m.wg.Add(2)
+	go m.watchConfigs()
+	go m.pruneStores()
 	enabled, disabled := m.Status()
 	if len(enabled) > 0 {
 		log.Info(fmt.Sprintf("Enabled %d/%d plugin(s).", len(enabled), len(m.plugins)), "enabled", enabled, "disabled", disabled)
@@ -181,30 +439,44 @@ func (m *PluginManager) Start() error {
 	return nil
 }
 
+// Stop disables plugins in the reverse order they were enabled
 func (m *PluginManager) Stop() error {
-	for name := range m.plugins {
-		if err := m.DisablePlugin(name); err != nil {
+	close(m.quitCh)
+	m.wg.Wait()
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for len(m.enabled) > 0 {
+		name := m.enabled[len(m.enabled)-1]
+		if err := m.disablePlugin(m.plugins[name]); err != nil {
 			log.Error("Error occur when trying to stop plugin", "plugin", name, "error", err)
 		}
 	}
+	m.closeLogs()
 	log.Info("PluginManager stopped")
 	return nil
 }
 
-func NewPluginManager(config *Config, db ethdb.Database, node *node.Node, ethBackend EthBackend, monitorBackend MonitorBackend, taskMgr TaskManager) (*PluginManager, error) {
+func NewPluginManager(config *Config, db ethdb.Database, stack *node.Node, ethBackend EthBackend, monitorBackend MonitorBackend, taskMgr TaskManager) (*PluginManager, error) {
+	nodeCfg := stack.Config()
 	pm := &PluginManager{
 		config:  config,
-		plugins: make(map[string]loadedPlugin),
+		plugins: make(map[string]*loadedPlugin),
+		quitCh:  make(chan struct{}),
 		ctx: &sharedCtx{
 			db:      db,
-			Node:    node,
+			Node:    stack,
 			Eth:     ethBackend,
 			Monitor: monitorBackend,
 			TaskMgr: taskMgr,
 			config:  NewConfigStore(pluginConfigPrefix, config.ConfigFile),
+			router:  newPluginRouter(nodeCfg.HTTPModules),
 		},
 	}
-	if err := pm.loadPlugins(); err != nil {
+	// plugins are enabled after the node started, their APIs are routed by a handler registered
+	// beforehand, which is guarded by the CORS and virtual host settings of the node HTTP server
+	handler := node.NewHTTPHandlerStack(pm.ctx.router, nodeCfg.HTTPCors, nodeCfg.HTTPVirtualHosts)
+	stack.RegisterHandler(pluginHandlerName, pluginHandlerPath, handler)
+	if _, err := pm.loadPlugins(); err != nil {
 		return nil, err
 	}
 	return pm, nil
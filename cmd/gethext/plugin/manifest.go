@@ -0,0 +1,180 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"reflect"
+	"strings"
+)
+
+const pluginManifestSymbol = "Manifest"
+
+// APIVersion is the version of the host API used by plugins: PluginCtx, the backends it
+// exposes and the Plugin interface. It is bumped on every incompatible change, plugins
+// built against another version are not enabled.
+const APIVersion = 2
+
+var (
+	errNoManifest         = errors.New("plugin does not declare a manifest")
+	errIncompatiblePlugin = errors.New("incompatible plugin")
+)
+
+// Manifest describes a plugin, plugins declare it as an exported variable:
+//
+//	var Manifest = plugin.Manifest{
+//		Name:         "whalemonitor",
+//		APIVersion:   plugin.APIVersion,
+//		Dependencies: []string{"discordbot"},
+//	}
+//
+// APIVersion records the host API version the plugin was built against. Dependencies
+// are names of the plugins which must be enabled before this plugin, a plugin is named
+// by its file name without the extension. Config is a pointer to the config struct of
+// the plugin, if ConfigSection is set the section of the plugins config file is decoded
+// into it before the plugin is enabled, so invalid configs fail early.
+type Manifest struct {
+	Name          string
+	Version       string
+	APIVersion    int
+	Dependencies  []string
+	ConfigSection string
+	Config        interface{}
+}
+
+// CheckCompatibility returns an error if the plugin can not run on this host
+func (m *Manifest) CheckCompatibility() error {
+	if m.APIVersion != APIVersion {
+		return fmt.Errorf("%w: built against host API version %d, host API version is %d", errIncompatiblePlugin, m.APIVersion, APIVersion)
+	}
+	if m.Config != nil && reflect.TypeOf(m.Config).Kind() != reflect.Ptr {
+		return fmt.Errorf("%w: config schema must be a pointer, got %T", errIncompatiblePlugin, m.Config)
+	}
+	return nil
+}
+
+// checkConfig decodes the config section of the plugin into a new config of the manifest
+// config type, unknown fields and configs failing validation are rejected
+func (m *Manifest) checkConfig(store *ConfigStore) error {
+	if m.Config == nil || m.ConfigSection == "" || store == nil {
+		return nil
+	}
+	cfg := reflect.New(reflect.TypeOf(m.Config).Elem()).Interface()
+	if err := store.LoadConfig(m.ConfigSection, cfg); err != nil {
+		return fmt.Errorf("invalid config section %s: %w", m.ConfigSection, err)
+	}
+	if validator, ok := cfg.(ConfigValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return fmt.Errorf("invalid config section %s: %w", m.ConfigSection, err)
+		}
+	}
+	return nil
+}
+
+// lookupManifest returns the manifest declared by a plugin library
+func lookupManifest(plib *plugin.Plugin) (*Manifest, error) {
+	sym, err := plib.Lookup(pluginManifestSymbol)
+	if err != nil {
+		return nil, errNoManifest
+	}
+	manifest, ok := sym.(*Manifest)
+	if !ok {
+		return nil, fmt.Errorf("%w: manifest has type %T", errIncompatiblePlugin, sym)
+	}
+	return manifest, nil
+}
+
+// InspectPlugin opens a plugin library and returns its manifest without loading the
+// plugin. The error is non-nil if the library is not a plugin or declares no manifest,
+// CheckCompatibility tells whether the plugin can run on this host.
+func InspectPlugin(filename string) (*Manifest, error) {
+	plib, err := plugin.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errIncompatiblePlugin, err)
+	}
+	if sym, err := plib.Lookup(pluginOnLoadFunc); err != nil {
+		return nil, errNotPlugin
+	} else if _, ok := sym.(func(*PluginCtx) Plugin); !ok {
+		return nil, fmt.Errorf("%w: %s has type %T", errIncompatiblePlugin, pluginOnLoadFunc, sym)
+	}
+	manifest, err := lookupManifest(plib)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Name == "" {
+		manifest.Name = strings.TrimSuffix(filepath.Base(filename), pluginExt)
+	}
+	return manifest, nil
+}
+
+// enableOrder returns the given plugins and their dependencies sorted so that every
+// plugin comes after its dependencies, returns an error on missing dependencies or cycles
+func (m *PluginManager) enableOrder(names []string) ([]string, error) {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	var (
+		order []string
+		state = make(map[string]int)
+		path  []string
+		visit func(name string) error
+	)
+	visit = func(name string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(path[indexOf(path, name):], name)
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(cycle, " -> "))
+		}
+		pl, exist := m.plugins[name]
+		if !exist {
+			if len(path) > 0 {
+				return fmt.Errorf("plugin %s depends on %s: %w", path[len(path)-1], name, errNotFound)
+			}
+			return fmt.Errorf("plugin %s: %w", name, errNotFound)
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dep := range pl.manifest.Dependencies {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// dependents returns the enabled plugins which directly depend on the given plugin
+func (m *PluginManager) dependents(name string) []string {
+	ret := []string{}
+	for _, plname := range m.enabled {
+		for _, dep := range m.plugins[plname].manifest.Dependencies {
+			if dep == name {
+				ret = append(ret, plname)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+func indexOf(list []string, item string) int {
+	for idx, val := range list {
+		if val == item {
+			return idx
+		}
+	}
+	return -1
+}
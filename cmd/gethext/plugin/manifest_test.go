@@ -0,0 +1,143 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPlugin struct {
+	name      string
+	enableErr error
+	events    *[]string
+}
+
+func (p *testPlugin) OnEnable(ctx *PluginCtx) error {
+	if p.enableErr != nil {
+		return p.enableErr
+	}
+	*p.events = append(*p.events, "enable "+p.name)
+	return nil
+}
+
+func (p *testPlugin) OnDisable(ctx *PluginCtx) error {
+	*p.events = append(*p.events, "disable "+p.name)
+	return nil
+}
+
+func newTestManager(events *[]string, deps map[string][]string) *PluginManager {
+	m := &PluginManager{
+		config:  &Config{},
+		plugins: make(map[string]*loadedPlugin),
+		ctx:     &sharedCtx{db: rawdb.NewMemoryDatabase()},
+		quitCh:  make(chan struct{}),
+	}
+	for name, plDeps := range deps {
+		m.plugins[name] = &loadedPlugin{
+			ctx:      &PluginCtx{sharedCtx: m.ctx},
+			name:     name,
+			manifest: Manifest{Name: name, APIVersion: APIVersion, Dependencies: plDeps},
+			instance: &testPlugin{name: name, events: events},
+		}
+	}
+	return m
+}
+
+func TestPluginEnableOrder(t *testing.T) {
+	events := []string{}
+	m := newTestManager(&events, map[string][]string{
+		"whalemonitor": {"discordbot"},
+		"discordbot":   nil,
+		"jeth":         nil,
+	})
+	m.config.Enabled = []string{"whalemonitor", "jeth", "discordbot"}
+	m.Start()
+	assert.Equal(t, []string{"enable discordbot", "enable whalemonitor", "enable jeth"}, events)
+
+	events = events[:0]
+	m.Stop()
+	assert.Equal(t, []string{"disable jeth", "disable whalemonitor", "disable discordbot"}, events)
+}
+
+func TestPluginDependencyCycle(t *testing.T) {
+	events := []string{}
+	m := newTestManager(&events, map[string][]string{
+		"a": {"b"},
+		"b": {"c"},
+		"c": {"a"},
+		"d": nil,
+	})
+	err := m.EnablePlugin("a")
+	assert.EqualError(t, err, "dependency cycle detected: a -> b -> c -> a")
+	assert.NoError(t, m.EnablePlugin("d"))
+	assert.Equal(t, []string{"enable d"}, events)
+}
+
+func TestPluginCascadeDisable(t *testing.T) {
+	events := []string{}
+	m := newTestManager(&events, map[string][]string{
+		"bot":     nil,
+		"monitor": {"bot"},
+		"alert":   {"monitor"},
+	})
+	assert.NoError(t, m.EnablePlugin("alert"))
+	events = events[:0]
+	assert.NoError(t, m.DisablePlugin("bot"))
+	assert.Equal(t, []string{"disable alert", "disable monitor", "disable bot"}, events)
+	enabled, _ := m.Status()
+	assert.Empty(t, enabled)
+}
+
+func TestPluginFailedDependency(t *testing.T) {
+	events := []string{}
+	m := newTestManager(&events, map[string][]string{
+		"bot":     nil,
+		"monitor": {"bot"},
+	})
+	m.plugins["bot"].instance.(*testPlugin).enableErr = errors.New("bot token not provided")
+	m.config.Enabled = []string{"bot", "monitor"}
+	m.Start()
+	assert.Empty(t, events)
+	assert.Error(t, m.EnablePlugin("monitor"))
+	assert.False(t, m.plugins["monitor"].enabled)
+}
+
+func TestManifestCompatibility(t *testing.T) {
+	manifest := &Manifest{Name: "bot", APIVersion: APIVersion}
+	assert.NoError(t, manifest.CheckCompatibility())
+	manifest.APIVersion = APIVersion - 1
+	assert.ErrorIs(t, manifest.CheckCompatibility(), errIncompatiblePlugin)
+	manifest = &Manifest{Name: "bot", APIVersion: APIVersion, Config: watchedTestConfig{}}
+	assert.ErrorIs(t, manifest.CheckCompatibility(), errIncompatiblePlugin)
+}
+
+func TestManifestCheckConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.toml")
+	store := NewConfigStore(pluginConfigPrefix, filename)
+	manifest := &Manifest{Name: "bot", ConfigSection: "Bot", Config: &watchedTestConfig{}}
+
+	os.WriteFile(filename, []byte("[Plugins.Bot]\nEndpoint = \"a\"\nLimit = 1\n"), 0644)
+	assert.NoError(t, manifest.checkConfig(store))
+
+	os.WriteFile(filename, []byte("[Plugins.Bot]\nEndpoint = \"a\"\nLimit = 0\n"), 0644)
+	assert.NoError(t, store.Reload())
+	assert.Error(t, manifest.checkConfig(store))
+
+	os.WriteFile(filename, []byte("[Plugins.Bot]\nEndpoint = \"a\"\nLimit = 1\nToken = \"x\"\n"), 0644)
+	assert.NoError(t, store.Reload())
+	assert.Error(t, manifest.checkConfig(store))
+}
+
+func TestIncompatiblePluginNotEnabled(t *testing.T) {
+	events := []string{}
+	m := newTestManager(&events, map[string][]string{"bot": nil})
+	err := fmt.Errorf("%w: built against host API version 0", errIncompatiblePlugin)
+	m.plugins["bot"].incompatible = err
+	assert.ErrorIs(t, m.EnablePlugin("bot"), errIncompatiblePlugin)
+	assert.Empty(t, events)
+}
@@ -9,7 +9,7 @@ package plugin
 import (
 	"context"
 	"math/big"
-	"sync"
+	"net/http"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
@@ -109,56 +109,60 @@ type TaskManager interface {
 	RunTask(name string, task task.Task) error
 	GetTask(name string) (task.Task, error)
 	KillTask(name string) error
+	RegisterProcessor(name string, proc task.ReExecProcessor) error
+	UnregisterProcessor(name string)
+	NewReExecTask(opts *task.ReExecOptions) (task.Task, error)
 }
 
 // sharedCtx exposes common useful modules for the plugin to
 // implement its own business
 type sharedCtx struct {
-	db      ethdb.Database
-	config  *ConfigStore
-	Node    *node.Node
-	Eth     EthBackend
-	Monitor MonitorBackend
-	TaskMgr TaskManager
-	Storage map[string]interface{}
-	mtx     sync.RWMutex
+	db       ethdb.Database
+	config   *ConfigStore
+	Node     *node.Node
+	Eth      EthBackend
+	Monitor  MonitorBackend
+	TaskMgr  TaskManager
+	router   *pluginRouter
+	services serviceRegistry // Services provided by plugins, see PluginCtx.RegisterService
+	bus      eventBus        // Topics plugins publish events to, see PluginCtx.Publish
 }
 
-func (ctx *sharedCtx) Database() ethdb.Database {
-	return ctx.db
+func (ctx *sharedCtx) LoadConfig(name string, cfg interface{}) error {
+	return ctx.config.LoadConfig(name, cfg)
 }
 
-func (ctx *sharedCtx) Set(key string, val interface{}) {
-	ctx.mtx.Lock()
-	defer ctx.mtx.Unlock()
-	if ctx.Storage == nil {
-		ctx.Storage = make(map[string]interface{})
-	}
-	ctx.Storage[key] = val
+// PluginCtx provides access to internal services for a plugin, each plugin has it own context
+type PluginCtx struct {
+	*sharedCtx
+	name       string
+	configs    configWatches
+	DataDir    string
+	EventScope event.SubscriptionScope
 }
 
-func (ctx *sharedCtx) Get(key string) (interface{}, bool) {
-	ctx.mtx.RLock()
-	defer ctx.mtx.RUnlock()
-	if ctx.Storage == nil {
-		return nil, false
-	}
-	val, ok := ctx.Storage[key]
-	return val, ok
+// OpenDatabase returns the raw key-value database of the plugin, keys are scoped to the
+// plugin name. Keys starting with "s/" are reserved for Store.
+func (ctx *PluginCtx) OpenDatabase() ethdb.Database {
+	return rawdb.NewTable(ctx.db, string(extdb.PluginDataPrefix(ctx.name)))
 }
 
-func (ctx *sharedCtx) LoadConfig(name string, cfg interface{}) error {
-	return ctx.config.LoadConfig(name, cfg)
+// Store returns the typed key-value storage of the plugin, its records are kept in their
+// own range of the plugin database so they can be used along with OpenDatabase.
+func (ctx *PluginCtx) Store() *Store {
+	return newStore(rawdb.NewTable(ctx.OpenDatabase(), storeKeyPrefix))
 }
 
-func (ctx *sharedCtx) OpenDatabase(prefix string) ethdb.Database {
-	plPrefix := extdb.PluginDataPrefix(prefix)
-	return rawdb.NewTable(ctx.db, string(plPrefix))
+// RegisterAPI serves the service as a JSON-RPC namespace at /plugins/rpc of the node
+// HTTP server while the plugin is enabled, if the namespace is allowed by --http.api.
+// The namespace is removed on disable.
+func (ctx *PluginCtx) RegisterAPI(namespace string, service interface{}) error {
+	return ctx.router.registerAPI(ctx.name, namespace, service)
 }
 
-// PluginCtx provides access to internal services for a plugin, each plugin has it own context
-type PluginCtx struct {
-	*sharedCtx
-	DataDir    string
-	EventScope event.SubscriptionScope
+// RegisterHandler serves the handler at /plugins/<plugin name>/<path> of the node HTTP
+// server while the plugin is enabled, a path ending with "/" matches all paths below it.
+// The handler is removed on disable.
+func (ctx *PluginCtx) RegisterHandler(path string, handler http.Handler) error {
+	return ctx.router.registerHandler(ctx.name, path, handler)
 }
@@ -0,0 +1,446 @@
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/gethext/plugin/procplugin"
+	"github.com/ethereum/go-ethereum/cmd/gethext/reexec"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	processPluginExt     = ".plugin"
+	processCallTimeout   = 10 * time.Second
+	processExitTimeout   = 5 * time.Second
+	processTxQueueLength = 1024
+	processHeadQueueSize = 16
+)
+
+var (
+	errProcessExited    = errors.New("plugin process exited")
+	errMethodNotAllowed = errors.New("method not allowed")
+
+	// processAllowedMethods are the node RPC methods plugin processes can call, only
+	// methods which do not sign, send or change anything are allowed
+	processAllowedMethods = map[string]bool{
+		"eth_blockNumber":                         true,
+		"eth_chainId":                             true,
+		"eth_syncing":                             true,
+		"eth_gasPrice":                            true,
+		"eth_maxPriorityFeePerGas":                true,
+		"eth_feeHistory":                          true,
+		"eth_getBalance":                          true,
+		"eth_getCode":                             true,
+		"eth_getStorageAt":                        true,
+		"eth_getTransactionCount":                 true,
+		"eth_getProof":                            true,
+		"eth_call":                                true,
+		"eth_estimateGas":                         true,
+		"eth_createAccessList":                    true,
+		"eth_getBlockByNumber":                    true,
+		"eth_getBlockByHash":                      true,
+		"eth_getHeaderByNumber":                   true,
+		"eth_getHeaderByHash":                     true,
+		"eth_getBlockTransactionCountByNumber":    true,
+		"eth_getBlockTransactionCountByHash":      true,
+		"eth_getTransactionByHash":                true,
+		"eth_getTransactionByBlockNumberAndIndex": true,
+		"eth_getTransactionByBlockHashAndIndex":   true,
+		"eth_getTransactionReceipt":               true,
+		"eth_getBlockReceipts":                    true,
+		"eth_getLogs":                             true,
+		"net_version":                             true,
+		"net_listening":                           true,
+		"net_peerCount":                           true,
+		"web3_clientVersion":                      true,
+		"web3_sha3":                               true,
+		"task_list":                               true,
+		"task_get":                                true,
+		"task_schedules":                          true,
+		"task_gasProfile":                         true,
+		"task_gasProfileFolded":                   true,
+	}
+)
+
+// hostService serves the host namespace to a plugin process
+type hostService struct {
+	name string
+	ctx  *PluginCtx
+}
+
+// Call proxies a call of the plugin to the node RPC, only read-only methods are allowed
+func (s *hostService) Call(ctx context.Context, method string, params []json.RawMessage) (json.RawMessage, error) {
+	if !processAllowedMethods[method] {
+		return nil, fmt.Errorf("%w: %s", errMethodNotAllowed, method)
+	}
+	client, err := s.ctx.Node.Attach()
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	args := make([]interface{}, len(params))
+	for idx, param := range params {
+		args[idx] = param
+	}
+	var result json.RawMessage
+	if err := client.CallContext(ctx, &result, method, args...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// LoadConfig returns the config section of the plugin
+func (s *hostService) LoadConfig() (procplugin.RawConfig, error) {
+	cfg := make(map[string]interface{})
+	if err := s.ctx.LoadConfig(s.name, &cfg); err != nil {
+		return nil, err
+	}
+	return json.Marshal(cfg)
+}
+
+// processPlugin runs a plugin executable as a child process and talks to it over
+// JSON-RPC on the stdin/stdout of the process. The process is started on enable
+// and stopped on disable, so it can be upgraded without restarting the node.
+type processPlugin struct {
+	name   string
+	path   string
+	onExit func(name string, err error) // Called when the process exited unexpectedly
+
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	client  *rpc.Client
+	info    procplugin.HandshakeResult
+	txQueue chan *procplugin.TransactionEvent
+	pending []*procplugin.TransactionEvent // Replayed transactions of the current block, sent once the block is committed
+	quitCh  chan struct{}
+	exitCh  chan struct{}
+	ctx     *PluginCtx
+	mtx     sync.Mutex
+}
+
+func (p *processPlugin) start(ctx *PluginCtx) error {
+	if err := os.MkdirAll(ctx.DataDir, 0755); err != nil {
+		return err
+	}
+	cmd := exec.Command(p.path)
+	cmd.Dir = ctx.DataDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	client, err := rpc.DialIO(context.Background(), stdout, stdin)
+	if err != nil {
+		cmd.Process.Kill()
+		return err
+	}
+	if err := client.RegisterName(procplugin.HostNamespace, &hostService{name: p.name, ctx: ctx}); err != nil {
+		cmd.Process.Kill()
+		return err
+	}
+	p.cmd = cmd
+	p.stdin = stdin
+	p.client = client
+	p.ctx = ctx
+	p.quitCh = make(chan struct{})
+	p.exitCh = make(chan struct{})
+	go p.forwardStderr(stderr)
+	go p.waitExit()
+	return nil
+}
+
+// forwardStderr writes the stderr output of the process to the plugin log
+func (p *processPlugin) forwardStderr(stderr io.Reader) {
+	var (
+		scanner = bufio.NewScanner(stderr)
+		logger  = NewLogger(p.name)
+	)
+	for scanner.Scan() {
+		logger.Info(scanner.Text())
+	}
+}
+
+func (p *processPlugin) waitExit() {
+	err := p.cmd.Wait()
+	close(p.exitCh)
+	select {
+	case <-p.quitCh:
+		log.Debug("Plugin process stopped", "plugin", p.name)
+	default:
+		log.Error("Plugin process exited unexpectedly", "plugin", p.name, "error", err)
+		p.ctx.Monitor.RemoveProcessor(p)
+		p.client.Close()
+		if p.onExit != nil {
+			go p.onExit(p.name, err)
+		}
+	}
+}
+
+func (p *processPlugin) call(result interface{}, method string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), processCallTimeout)
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() { errCh <- p.client.CallContext(ctx, result, method, args...) }()
+	select {
+	case err := <-errCh:
+		return err
+	case <-p.exitCh:
+		return errProcessExited
+	}
+}
+
+func (p *processPlugin) handshake() error {
+	args := procplugin.HandshakeArgs{
+		ProtocolVersion: procplugin.ProtocolVersion,
+		HostVersion:     params.VersionWithMeta,
+		DataDir:         p.ctx.DataDir,
+	}
+	if err := p.call(&p.info, procplugin.MethodHandshake, args); err != nil {
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+	if p.info.ProtocolVersion != procplugin.ProtocolVersion {
+		return fmt.Errorf("unsupported protocol version %d, expected %d", p.info.ProtocolVersion, procplugin.ProtocolVersion)
+	}
+	return nil
+}
+
+func (p *processPlugin) subscribe() error {
+	for _, event := range p.info.Events {
+		switch event {
+		case procplugin.EventChainHead:
+			chainHeadCh := make(chan core.ChainHeadEvent, processHeadQueueSize)
+			headQueue := make(chan *procplugin.ChainHeadEvent, processHeadQueueSize)
+			sub := p.ctx.EventScope.Track(p.ctx.Eth.SubscribeChainHeadEvent(chainHeadCh))
+			go p.chainHeadLoop(chainHeadCh, headQueue, sub.Err())
+			go p.headNotifyLoop(headQueue)
+		case procplugin.EventTransaction:
+			p.txQueue = make(chan *procplugin.TransactionEvent, processTxQueueLength)
+			go p.transactionLoop(p.txQueue)
+			p.ctx.Monitor.AddProcessor(p)
+		default:
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	return nil
+}
+
+func (p *processPlugin) notify(method string, args ...interface{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), processCallTimeout)
+	defer cancel()
+	if err := p.client.Notify(ctx, method, args...); err != nil {
+		log.Warn("Could not notify plugin", "plugin", p.name, "method", method, "error", err)
+	}
+}
+
+// chainHeadLoop queues new chain heads to be sent to the plugin, heads are dropped if
+// the plugin does not keep up so the chain event feed is never blocked
+func (p *processPlugin) chainHeadLoop(chainHeadCh chan core.ChainHeadEvent, headQueue chan *procplugin.ChainHeadEvent, errCh <-chan error) {
+	for {
+		select {
+		case ev := <-chainHeadCh:
+			block := ev.Block
+			head := &procplugin.ChainHeadEvent{
+				Number:     hexutil.Uint64(block.NumberU64()),
+				Hash:       block.Hash(),
+				ParentHash: block.ParentHash(),
+				Time:       hexutil.Uint64(block.Time()),
+				TxCount:    len(block.Transactions()),
+			}
+			select {
+			case headQueue <- head:
+			default:
+				log.Warn("Plugin chain head queue is full, dropping event", "plugin", p.name, "number", block.NumberU64())
+			}
+		case <-errCh:
+			return
+		case <-p.quitCh:
+			return
+		case <-p.exitCh:
+			return
+		}
+	}
+}
+
+func (p *processPlugin) headNotifyLoop(headQueue chan *procplugin.ChainHeadEvent) {
+	for {
+		select {
+		case ev := <-headQueue:
+			p.notify(procplugin.MethodChainHead, ev)
+		case <-p.quitCh:
+			return
+		case <-p.exitCh:
+			return
+		}
+	}
+}
+
+func (p *processPlugin) transactionLoop(txQueue chan *procplugin.TransactionEvent) {
+	for {
+		select {
+		case ev := <-txQueue:
+			p.notify(procplugin.MethodTransaction, ev)
+		case <-p.quitCh:
+			return
+		case <-p.exitCh:
+			return
+		}
+	}
+}
+
+func convertCallFrames(frames []reexec.CallFrame) []procplugin.CallFrame {
+	if len(frames) == 0 {
+		return nil
+	}
+	ret := make([]procplugin.CallFrame, len(frames))
+	for idx, frame := range frames {
+		ret[idx] = procplugin.CallFrame{
+			Type:    frame.Type.String(),
+			From:    frame.From,
+			To:      frame.To,
+			Gas:     hexutil.Uint64(frame.Gas),
+			GasUsed: hexutil.Uint64(frame.GasUsed),
+			Input:   frame.Input,
+			Output:  frame.Output,
+			Calls:   convertCallFrames(frame.Calls),
+		}
+		if frame.Value != nil {
+			ret[idx].Value = (*hexutil.Big)(frame.Value)
+		}
+		if frame.Error != nil {
+			ret[idx].Error = frame.Error.Error()
+		}
+	}
+	return ret
+}
+
+// Name names the chain monitor processor of the plugin
+func (p *processPlugin) Name() string {
+	return "plugin/" + p.name
+}
+
+func (p *processPlugin) OnTxStart(ctx *reexec.Context, gasLimit uint64) {}
+
+func (p *processPlugin) OnCallEnter(ctx *reexec.Context, call *reexec.CallFrame) {}
+
+func (p *processPlugin) OnCallExit(ctx *reexec.Context, call *reexec.CallFrame) {}
+
+// OnTxEnd holds the replayed transaction back until its block is committed
+func (p *processPlugin) OnTxEnd(ctx *reexec.Context, ret *reexec.TxResult, restGas uint64) {
+	block := ctx.Block()
+	_, tx := ctx.Transaction()
+	if len(p.pending) > 0 && p.pending[0].BlockHash != block.Hash() {
+		// the replay of the previous block failed before it was committed or discarded
+		p.pending = nil
+	}
+	p.pending = append(p.pending, &procplugin.TransactionEvent{
+		BlockNumber: hexutil.Uint64(block.NumberU64()),
+		BlockHash:   block.Hash(),
+		TxHash:      tx.Hash(),
+		TxIndex:     int(ret.TxIndex),
+		Reverted:    ret.Reverted,
+		CallStack:   convertCallFrames(ret.CallStack),
+	})
+}
+
+// OnBlockCommit queues the replayed transactions of the block to be sent to the plugin,
+// events are dropped if the plugin does not keep up
+func (p *processPlugin) OnBlockCommit(ctx *reexec.Context) {
+	for _, ev := range p.pending {
+		select {
+		case p.txQueue <- ev:
+		default:
+			log.Warn("Plugin transaction queue is full, dropping event", "plugin", p.name, "tx", ev.TxHash)
+		}
+	}
+	p.pending = nil
+}
+
+// OnBlockDiscard drops the replayed transactions of a divergent block
+func (p *processPlugin) OnBlockDiscard(ctx *reexec.Context, report *reexec.DivergenceReport) {
+	p.pending = nil
+}
+
+func (p *processPlugin) OnEnable(ctx *PluginCtx) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if err := p.start(ctx); err != nil {
+		return err
+	}
+	err := p.handshake()
+	if err == nil {
+		err = p.call(nil, procplugin.MethodEnable)
+	}
+	if err == nil {
+		err = p.subscribe()
+	}
+	if err != nil {
+		p.stop()
+		return err
+	}
+	log.Info("Started plugin process", "plugin", p.name, "version", p.info.Version, "pid", p.cmd.Process.Pid)
+	return nil
+}
+
+// stop closes the stdin of the process to let it exit, the process is killed if it does not exit in time
+func (p *processPlugin) stop() {
+	p.ctx.Monitor.RemoveProcessor(p)
+	close(p.quitCh)
+	p.stdin.Close()
+	select {
+	case <-p.exitCh:
+	case <-time.After(processExitTimeout):
+		log.Warn("Plugin process did not exit, killing", "plugin", p.name)
+		p.cmd.Process.Kill()
+		<-p.exitCh
+	}
+	p.client.Close()
+}
+
+func (p *processPlugin) OnDisable(ctx *PluginCtx) error {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.cmd == nil {
+		return nil
+	}
+	err := p.call(nil, procplugin.MethodDisable)
+	if errors.Is(err, errProcessExited) {
+		err = nil
+	}
+	p.stop()
+	p.cmd = nil
+	return err
+}
+
+// version returns the version the plugin reported in the handshake
+func (p *processPlugin) version() string {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return p.info.Version
+}
+
+func newProcessPlugin(name, path string, onExit func(name string, err error)) *processPlugin {
+	return &processPlugin{name: name, path: path, onExit: onExit}
+}
@@ -0,0 +1,143 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/gethext/monitor"
+	"github.com/ethereum/go-ethereum/cmd/gethext/plugin/procplugin"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProcessPluginEnv makes the test binary serve testProcessPlugin, so the binary
+// can be started as a plugin process
+const testProcessPluginEnv = "GETHEXT_TEST_PROCESS_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testProcessPluginEnv) != "" {
+		if err := procplugin.Serve(&testProcessPlugin{}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// testProcessPlugin writes the chain heads it receives to a file in its data directory
+type testProcessPlugin struct{}
+
+func (p *testProcessPlugin) Info() procplugin.HandshakeResult {
+	return procplugin.HandshakeResult{Name: "proc", Version: "1.2.3", Events: []string{procplugin.EventChainHead}}
+}
+
+func (p *testProcessPlugin) OnEnable(host *procplugin.Host) error {
+	var version string
+	return host.Call(context.Background(), &version, "web3_clientVersion")
+}
+
+func (p *testProcessPlugin) OnDisable(host *procplugin.Host) error {
+	return nil
+}
+
+func (p *testProcessPlugin) OnChainHead(host *procplugin.Host, ev *procplugin.ChainHeadEvent) {
+	os.WriteFile(filepath.Join(host.DataDir, "head"), []byte(fmt.Sprint(uint64(ev.Number))), 0644)
+}
+
+type testEthBackend struct {
+	EthBackend
+	headFeed event.Feed
+}
+
+func (b *testEthBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return b.headFeed.Subscribe(ch)
+}
+
+type testMonitorBackend struct{}
+
+func (b *testMonitorBackend) AddProcessor(proc monitor.Processor) {}
+
+func (b *testMonitorBackend) RemoveProcessor(proc monitor.Processor) {}
+
+func newTestNode(t *testing.T) *node.Node {
+	stack, err := node.New(&node.Config{P2P: p2p.Config{MaxPeers: 0, NoDiscovery: true}})
+	require.NoError(t, err)
+	require.NoError(t, stack.Start())
+	t.Cleanup(func() { stack.Close() })
+	return stack
+}
+
+func TestHostServiceCall(t *testing.T) {
+	service := &hostService{name: "proc", ctx: &PluginCtx{sharedCtx: &sharedCtx{Node: newTestNode(t)}}}
+	for _, method := range []string{"eth_sendTransaction", "eth_sendRawTransaction", "eth_sign", "personal_unlockAccount", "admin_addPeer", "task_kill", "task_start"} {
+		_, err := service.Call(context.Background(), method, nil)
+		assert.ErrorIs(t, err, errMethodNotAllowed, method)
+	}
+	ret, err := service.Call(context.Background(), "web3_clientVersion", nil)
+	require.NoError(t, err)
+	var version string
+	require.NoError(t, json.Unmarshal(ret, &version))
+	assert.NotEmpty(t, version)
+}
+
+func TestProcessPlugin(t *testing.T) {
+	t.Setenv(testProcessPluginEnv, "1")
+	eth := &testEthBackend{}
+	ctx := &PluginCtx{
+		sharedCtx: &sharedCtx{Node: newTestNode(t), Eth: eth, Monitor: &testMonitorBackend{}},
+		name:      "proc",
+		DataDir:   t.TempDir(),
+	}
+	exited := make(chan error, 1)
+	pl := newProcessPlugin("proc", os.Args[0], func(name string, err error) { exited <- err })
+	require.NoError(t, pl.OnEnable(ctx))
+	assert.Equal(t, "1.2.3", pl.version())
+
+	headFile := filepath.Join(ctx.DataDir, "head")
+	sendHead := func(number int64) {
+		eth.headFeed.Send(core.ChainHeadEvent{Block: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(number)})})
+	}
+	sendHead(1)
+	require.Eventually(t, func() bool {
+		data, _ := os.ReadFile(headFile)
+		return string(data) == "1"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// heads are dropped instead of blocking the chain feed if the plugin does not keep up
+	done := make(chan struct{})
+	go func() {
+		for number := int64(2); number <= 10*processHeadQueueSize; number++ {
+			sendHead(number)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("chain head feed blocked")
+	}
+
+	require.NoError(t, pl.OnDisable(ctx))
+	select {
+	case <-pl.exitCh:
+	default:
+		t.Fatal("plugin process did not exit")
+	}
+	select {
+	case err := <-exited:
+		t.Fatalf("plugin process stopped as an unexpected exit: %v", err)
+	default:
+	}
+}
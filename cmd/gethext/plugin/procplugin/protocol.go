@@ -0,0 +1,92 @@
+// Package procplugin defines the protocol between gethext and plugins running as
+// child processes, and provides the plugin side implementation.
+//
+// The host starts the plugin executable and talks JSON-RPC over the stdin/stdout
+// of the child process, the stderr of the child is forwarded to the host log.
+// Both sides serve requests: the host calls methods of the "plugin" namespace to
+// control the plugin and deliver events, the plugin calls methods of the "host"
+// namespace to query the node.
+package procplugin
+
+import (
+	"encoding/json"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// ProtocolVersion is the version of the protocol, the host refuses plugins that speak a different version
+const ProtocolVersion = 1
+
+const (
+	PluginNamespace = "plugin"
+	HostNamespace   = "host"
+
+	// Methods served by plugins
+	MethodHandshake   = "plugin_handshake"
+	MethodEnable      = "plugin_enable"
+	MethodDisable     = "plugin_disable"
+	MethodChainHead   = "plugin_chainHead"
+	MethodTransaction = "plugin_transaction"
+
+	// Methods served by the host
+	MethodHostCall       = "host_call"
+	MethodHostLoadConfig = "host_loadConfig"
+)
+
+// Event names a plugin can subscribe to in its handshake
+const (
+	EventChainHead   = "chainHead"   // New chain head blocks
+	EventTransaction = "transaction" // Transactions replayed by the chain monitor, with their call stack
+)
+
+// HandshakeArgs is sent by the host when the plugin process started
+type HandshakeArgs struct {
+	ProtocolVersion int    `json:"protocolVersion"`
+	HostVersion     string `json:"hostVersion"`
+	DataDir         string `json:"dataDir"` // Data directory of the plugin
+}
+
+// HandshakeResult describes the plugin to the host
+type HandshakeResult struct {
+	ProtocolVersion int      `json:"protocolVersion"`
+	Name            string   `json:"name"`
+	Version         string   `json:"version"`
+	Events          []string `json:"events"` // Events the plugin subscribes to
+}
+
+// ChainHeadEvent is sent to plugins subscribed to EventChainHead
+type ChainHeadEvent struct {
+	Number     hexutil.Uint64 `json:"number"`
+	Hash       common.Hash    `json:"hash"`
+	ParentHash common.Hash    `json:"parentHash"`
+	Time       hexutil.Uint64 `json:"timestamp"`
+	TxCount    int            `json:"txCount"`
+}
+
+// CallFrame is a call of a replayed transaction
+type CallFrame struct {
+	Type    string         `json:"type"`
+	From    common.Address `json:"from"`
+	To      common.Address `json:"to"`
+	Value   *hexutil.Big   `json:"value,omitempty"`
+	Gas     hexutil.Uint64 `json:"gas"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Input   hexutil.Bytes  `json:"input"`
+	Output  hexutil.Bytes  `json:"output,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	Calls   []CallFrame    `json:"calls,omitempty"`
+}
+
+// TransactionEvent is sent to plugins subscribed to EventTransaction once a transaction was replayed
+type TransactionEvent struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	BlockHash   common.Hash    `json:"blockHash"`
+	TxHash      common.Hash    `json:"txHash"`
+	TxIndex     int            `json:"txIndex"`
+	Reverted    bool           `json:"reverted"`
+	CallStack   []CallFrame    `json:"callStack"`
+}
+
+// RawConfig is the plugin config section as JSON
+type RawConfig = json.RawMessage
@@ -0,0 +1,153 @@
+package procplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var errNotEnabled = errors.New("plugin is not enabled")
+
+// Plugin is implemented by plugins running as a child process
+type Plugin interface {
+	// Info returns the name, version and subscribed events of the plugin
+	Info() HandshakeResult
+
+	OnEnable(host *Host) error
+	OnDisable(host *Host) error
+}
+
+// ChainHeadHandler is implemented by plugins subscribed to EventChainHead
+type ChainHeadHandler interface {
+	OnChainHead(host *Host, ev *ChainHeadEvent)
+}
+
+// TransactionHandler is implemented by plugins subscribed to EventTransaction
+type TransactionHandler interface {
+	OnTransaction(host *Host, ev *TransactionEvent)
+}
+
+// Host allows the plugin to call back into the node
+type Host struct {
+	client  *rpc.Client
+	DataDir string
+}
+
+// Call calls a JSON-RPC method of the node, e.g eth_getBlockByNumber
+func (h *Host) Call(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	params := make([]interface{}, 0, len(args))
+	params = append(params, args...)
+	return h.client.CallContext(ctx, result, MethodHostCall, method, params)
+}
+
+// LoadConfig reads the config section of the plugin into cfg
+func (h *Host) LoadConfig(ctx context.Context, cfg interface{}) error {
+	var raw RawConfig
+	if err := h.client.CallContext(ctx, &raw, MethodHostLoadConfig); err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, cfg)
+}
+
+// pluginService serves the plugin namespace
+type pluginService struct {
+	plugin  Plugin
+	host    *Host
+	enabled bool
+}
+
+func (s *pluginService) Handshake(args HandshakeArgs) (*HandshakeResult, error) {
+	if args.ProtocolVersion != ProtocolVersion {
+		return nil, fmt.Errorf("unsupported protocol version %d, expected %d", args.ProtocolVersion, ProtocolVersion)
+	}
+	s.host.DataDir = args.DataDir
+	info := s.plugin.Info()
+	info.ProtocolVersion = ProtocolVersion
+	return &info, nil
+}
+
+func (s *pluginService) Enable() error {
+	if err := s.plugin.OnEnable(s.host); err != nil {
+		return err
+	}
+	s.enabled = true
+	return nil
+}
+
+func (s *pluginService) Disable() error {
+	if !s.enabled {
+		return errNotEnabled
+	}
+	s.enabled = false
+	return s.plugin.OnDisable(s.host)
+}
+
+func (s *pluginService) ChainHead(ev ChainHeadEvent) {
+	if handler, ok := s.plugin.(ChainHeadHandler); ok && s.enabled {
+		handler.OnChainHead(s.host, &ev)
+	}
+}
+
+func (s *pluginService) Transaction(ev TransactionEvent) {
+	if handler, ok := s.plugin.(TransactionHandler); ok && s.enabled {
+		handler.OnTransaction(s.host, &ev)
+	}
+}
+
+// eofReader signals when the host closed the stdin of the plugin process
+type eofReader struct {
+	r     io.Reader
+	once  sync.Once
+	eofCh chan struct{}
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil {
+		r.once.Do(func() { close(r.eofCh) })
+	}
+	return n, err
+}
+
+// Serve runs the plugin over stdin/stdout until the host closed the stdin or
+// the process is interrupted. Logs of the plugin must be written to stderr.
+func Serve(plugin Plugin) error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	return serve(plugin, os.Stdin, os.Stdout, sigCh)
+}
+
+func serve(plugin Plugin, in io.Reader, out io.Writer, sigCh <-chan os.Signal) error {
+	stdin := &eofReader{r: in, eofCh: make(chan struct{})}
+	client, err := rpc.DialIO(context.Background(), stdin, out)
+	if err != nil {
+		return err
+	}
+	service := &pluginService{
+		plugin: plugin,
+		host:   &Host{client: client},
+	}
+	if err := client.RegisterName(PluginNamespace, service); err != nil {
+		client.Close()
+		return err
+	}
+	select {
+	case <-stdin.eofCh:
+		client.Close()
+	case <-sigCh:
+		// the client is left open, closing it waits for stdin which may never be closed
+		if service.enabled {
+			service.Disable()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package procplugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testPlugin struct {
+	events []string
+	heads  chan *ChainHeadEvent
+	config map[string]string
+	called string
+}
+
+func (p *testPlugin) Info() HandshakeResult {
+	return HandshakeResult{Name: "test", Version: "1.0.0", Events: []string{EventChainHead}}
+}
+
+func (p *testPlugin) OnEnable(host *Host) error {
+	p.events = append(p.events, "enable "+host.DataDir)
+	if err := host.Call(context.Background(), &p.called, "eth_blockNumber"); err != nil {
+		return err
+	}
+	return host.LoadConfig(context.Background(), &p.config)
+}
+
+func (p *testPlugin) OnDisable(host *Host) error {
+	p.events = append(p.events, "disable")
+	return nil
+}
+
+func (p *testPlugin) OnChainHead(host *Host, ev *ChainHeadEvent) {
+	p.heads <- ev
+}
+
+// testHost serves the host namespace to the plugin
+type testHost struct{}
+
+func (h *testHost) LoadConfig() (RawConfig, error) {
+	return json.Marshal(map[string]string{"key": "value"})
+}
+
+func (h *testHost) Call(method string, params []json.RawMessage) (json.RawMessage, error) {
+	return json.Marshal(method)
+}
+
+// startTestPlugin serves the plugin over pipes, returns the host client, the stdin of
+// the plugin and the channel receiving the result of serve
+func startTestPlugin(t *testing.T, plugin Plugin, sigCh chan os.Signal) (*rpc.Client, io.Closer, chan error) {
+	hostIn, pluginOut := io.Pipe()
+	pluginIn, hostOut := io.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serve(plugin, pluginIn, pluginOut, sigCh)
+		pluginOut.Close()
+	}()
+	client, err := rpc.DialIO(context.Background(), hostIn, hostOut)
+	require.NoError(t, err)
+	require.NoError(t, client.RegisterName(HostNamespace, &testHost{}))
+	t.Cleanup(client.Close)
+	return client, hostOut, errCh
+}
+
+func TestServeProtocol(t *testing.T) {
+	plugin := &testPlugin{heads: make(chan *ChainHeadEvent, 1)}
+	client, stdin, errCh := startTestPlugin(t, plugin, make(chan os.Signal))
+
+	var info HandshakeResult
+	err := client.Call(&info, MethodHandshake, HandshakeArgs{ProtocolVersion: ProtocolVersion + 1})
+	assert.ErrorContains(t, err, "unsupported protocol version")
+	require.NoError(t, client.Call(&info, MethodHandshake, HandshakeArgs{ProtocolVersion: ProtocolVersion, DataDir: "/data"}))
+	assert.Equal(t, HandshakeResult{ProtocolVersion: ProtocolVersion, Name: "test", Version: "1.0.0", Events: []string{EventChainHead}}, info)
+
+	// events are delivered to enabled plugins only
+	require.NoError(t, client.Notify(context.Background(), MethodChainHead, ChainHeadEvent{Number: 1}))
+	require.NoError(t, client.Call(nil, MethodEnable))
+	assert.Equal(t, map[string]string{"key": "value"}, plugin.config)
+	assert.Equal(t, "eth_blockNumber", plugin.called)
+	require.NoError(t, client.Notify(context.Background(), MethodChainHead, ChainHeadEvent{Number: 2}))
+	select {
+	case ev := <-plugin.heads:
+		assert.Equal(t, uint64(2), uint64(ev.Number))
+	case <-time.After(5 * time.Second):
+		t.Fatal("chain head event not delivered")
+	}
+
+	require.NoError(t, client.Call(nil, MethodDisable))
+	assert.ErrorContains(t, client.Call(nil, MethodDisable), errNotEnabled.Error())
+	assert.Equal(t, []string{"enable /data", "disable"}, plugin.events)
+
+	// the plugin exits when the host closes its stdin
+	stdin.Close()
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin did not exit")
+	}
+}
+
+func TestServeInterrupt(t *testing.T) {
+	plugin := &testPlugin{heads: make(chan *ChainHeadEvent, 1)}
+	sigCh := make(chan os.Signal, 1)
+	client, _, errCh := startTestPlugin(t, plugin, sigCh)
+	require.NoError(t, client.Call(nil, MethodEnable))
+
+	// an interrupted plugin is disabled before exiting
+	sigCh <- os.Interrupt
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("plugin did not exit")
+	}
+	assert.Equal(t, []string{"enable ", "disable"}, plugin.events)
+}
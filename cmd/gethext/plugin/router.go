@@ -0,0 +1,169 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	pluginHandlerName = "plugins"
+	pluginHandlerPath = "/plugins/"
+	pluginRPCPath     = "/plugins/rpc"
+)
+
+var (
+	errNamespaceExists = errors.New("namespace already registered")
+	errHandlerExists   = errors.New("handler already registered")
+)
+
+type pluginAPI struct {
+	plugin  string
+	service interface{}
+}
+
+type pluginHandler struct {
+	plugin  string
+	handler http.Handler
+}
+
+// pluginRouter serves the JSON-RPC namespaces and HTTP handlers of enabled plugins
+// under pluginHandlerPath of the node HTTP server. The node can not register APIs
+// once started, so plugin APIs are served over HTTP at pluginRPCPath by a separate
+// RPC server which is rebuilt every time a plugin attaches or detaches its APIs.
+type pluginRouter struct {
+	apis     map[string]pluginAPI     // Plugin APIs by namespace
+	handlers map[string]pluginHandler // Plugin handlers by path
+	server   *rpc.Server
+	modules  map[string]bool // Namespaces allowed by the HTTP API list, all if empty
+	mtx      sync.RWMutex
+}
+
+// allowed reports whether the namespace is exposed, like the node does for its own
+// APIs all namespaces are exposed if the HTTP API list is empty
+func (r *pluginRouter) allowed(namespace string) bool {
+	return len(r.modules) == 0 || r.modules[namespace]
+}
+
+func (r *pluginRouter) rebuildServer() {
+	server := rpc.NewServer()
+	for namespace, api := range r.apis {
+		if !r.allowed(namespace) {
+			continue
+		}
+		if err := server.RegisterName(namespace, api.service); err != nil {
+			log.Error("Could not register plugin API", "plugin", api.plugin, "namespace", namespace, "error", err)
+		}
+	}
+	// requests in flight on the old server are finished before it is stopped
+	if r.server != nil {
+		r.server.Stop()
+	}
+	r.server = server
+}
+
+func (r *pluginRouter) registerAPI(plugin, namespace string, service interface{}) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if api, exist := r.apis[namespace]; exist {
+		return fmt.Errorf("%w: %s by plugin %s", errNamespaceExists, namespace, api.plugin)
+	}
+	// validate the service before replacing the running server
+	if err := rpc.NewServer().RegisterName(namespace, service); err != nil {
+		return err
+	}
+	r.apis[namespace] = pluginAPI{plugin, service}
+	if !r.allowed(namespace) {
+		log.Warn("Plugin API is not in the HTTP API list, not exposing it", "plugin", plugin, "namespace", namespace)
+		return nil
+	}
+	r.rebuildServer()
+	log.Info("Registered plugin API", "plugin", plugin, "namespace", namespace, "path", pluginRPCPath)
+	return nil
+}
+
+func (r *pluginRouter) registerHandler(plugin, path string, handler http.Handler) error {
+	path = pluginHandlerPath + plugin + "/" + strings.TrimPrefix(path, "/")
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if h, exist := r.handlers[path]; exist {
+		return fmt.Errorf("%w: %s by plugin %s", errHandlerExists, path, h.plugin)
+	}
+	r.handlers[path] = pluginHandler{plugin, handler}
+	log.Info("Registered plugin HTTP handler", "plugin", plugin, "path", path)
+	return nil
+}
+
+// detach removes all APIs and handlers of the plugin
+func (r *pluginRouter) detach(plugin string) {
+	if r == nil {
+		return
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	removed := false
+	for namespace, api := range r.apis {
+		if api.plugin == plugin {
+			delete(r.apis, namespace)
+			removed = true
+		}
+	}
+	if removed {
+		r.rebuildServer()
+	}
+	for path, h := range r.handlers {
+		if h.plugin == plugin {
+			delete(r.handlers, path)
+		}
+	}
+}
+
+// match returns the handler with the longest path matching the request path
+func (r *pluginRouter) match(path string) (string, http.Handler) {
+	var (
+		pattern string
+		handler http.Handler
+	)
+	for p, h := range r.handlers {
+		matched := path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p))
+		if matched && len(p) > len(pattern) {
+			pattern, handler = p, h.handler
+		}
+	}
+	return pattern, handler
+}
+
+func (r *pluginRouter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mtx.RLock()
+	if req.URL.Path == pluginRPCPath {
+		server := r.server
+		r.mtx.RUnlock()
+		server.ServeHTTP(w, req)
+		return
+	}
+	_, handler := r.match(req.URL.Path)
+	r.mtx.RUnlock()
+	if handler == nil {
+		http.NotFound(w, req)
+		return
+	}
+	handler.ServeHTTP(w, req)
+}
+
+func newPluginRouter(modules []string) *pluginRouter {
+	r := &pluginRouter{
+		apis:     make(map[string]pluginAPI),
+		handlers: make(map[string]pluginHandler),
+		modules:  make(map[string]bool),
+	}
+	for _, module := range modules {
+		r.modules[module] = true
+	}
+	r.rebuildServer()
+	return r
+}
@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/stretchr/testify/assert"
+)
+
+type echoAPI struct{}
+
+func (echoAPI) Hello(name string) string {
+	return "hello " + name
+}
+
+func postRPC(t *testing.T, url, body string) string {
+	resp, err := http.Post(url+pluginRPCPath, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return strings.TrimSpace(string(data))
+}
+
+func TestPluginRouter(t *testing.T) {
+	router := newPluginRouter(nil)
+	ctx := &PluginCtx{sharedCtx: &sharedCtx{router: router}, name: "whalemonitor"}
+	assert.NoError(t, ctx.RegisterAPI("whale", echoAPI{}))
+	assert.ErrorIs(t, ctx.RegisterAPI("whale", echoAPI{}), errNamespaceExists)
+	assert.NoError(t, ctx.RegisterHandler("/stats", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})))
+
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	req := `{"jsonrpc":"2.0","id":1,"method":"whale_hello","params":["bob"]}`
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"hello bob"}`, postRPC(t, srv.URL, req))
+	resp, err := http.Get(srv.URL + "/plugins/whalemonitor/stats")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	router.detach("whalemonitor")
+	assert.Contains(t, postRPC(t, srv.URL, req), "does not exist")
+	resp, err = http.Get(srv.URL + "/plugins/whalemonitor/stats")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestPluginRouterModules(t *testing.T) {
+	router := newPluginRouter([]string{"eth", "whale"})
+	ctx := &PluginCtx{sharedCtx: &sharedCtx{router: router}, name: "whalemonitor"}
+	assert.NoError(t, ctx.RegisterAPI("whale", echoAPI{}))
+	assert.NoError(t, ctx.RegisterAPI("hidden", echoAPI{}))
+	assert.ErrorIs(t, ctx.RegisterAPI("hidden", echoAPI{}), errNamespaceExists)
+
+	// only namespaces in the HTTP API list are served
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+	assert.Contains(t, postRPC(t, srv.URL, `{"jsonrpc":"2.0","id":1,"method":"whale_hello","params":["bob"]}`), "hello bob")
+	assert.Contains(t, postRPC(t, srv.URL, `{"jsonrpc":"2.0","id":1,"method":"hidden_hello","params":["bob"]}`), "does not exist")
+}
+
+func TestPluginHandlerStack(t *testing.T) {
+	router := newPluginRouter(nil)
+	ctx := &PluginCtx{sharedCtx: &sharedCtx{router: router}, name: "whalemonitor"}
+	assert.NoError(t, ctx.RegisterAPI("whale", echoAPI{}))
+	srv := httptest.NewServer(node.NewHTTPHandlerStack(router, nil, []string{"localhost"}))
+	defer srv.Close()
+
+	// requests for hosts which are not allowed are rejected
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+pluginRPCPath, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"whale_hello","params":["bob"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Host = "example.com"
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	req.Host = "localhost"
+	req.Body = io.NopCloser(strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"whale_hello","params":["bob"]}`))
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,193 @@
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	ErrServiceUnknown    = errors.New("unknown service")
+	errServiceExists     = errors.New("service already registered")
+	errInvalidService    = errors.New("invalid service")
+	errTopicTypeMismatch = errors.New("event type mismatch")
+)
+
+type registeredService struct {
+	plugin  string
+	service interface{}
+}
+
+// serviceRegistry holds the services provided by enabled plugins keyed by interface type
+type serviceRegistry struct {
+	services map[reflect.Type]registeredService
+	mtx      sync.RWMutex
+}
+
+// interfaceType returns the interface type pointed to by iface, e.g. (*discordbot.DiscordBot)(nil)
+func interfaceType(iface interface{}) (reflect.Type, error) {
+	typ := reflect.TypeOf(iface)
+	if typ == nil || typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Interface {
+		return nil, fmt.Errorf("%w: expected a pointer to an interface, got %T", errInvalidService, iface)
+	}
+	return typ.Elem(), nil
+}
+
+func (r *serviceRegistry) register(plugin string, iface interface{}, service interface{}) error {
+	typ, err := interfaceType(iface)
+	if err != nil {
+		return err
+	}
+	if service == nil || !reflect.TypeOf(service).Implements(typ) {
+		return fmt.Errorf("%w: %T does not implement %v", errInvalidService, service, typ)
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if svc, exist := r.services[typ]; exist {
+		return fmt.Errorf("%w: %v by plugin %s", errServiceExists, typ, svc.plugin)
+	}
+	if r.services == nil {
+		r.services = make(map[reflect.Type]registeredService)
+	}
+	r.services[typ] = registeredService{plugin, service}
+	log.Info("Registered plugin service", "plugin", plugin, "service", typ)
+	return nil
+}
+
+func (r *serviceRegistry) unregister(plugin string, iface interface{}) error {
+	typ, err := interfaceType(iface)
+	if err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	if svc, exist := r.services[typ]; !exist || svc.plugin != plugin {
+		return fmt.Errorf("%w: %v", ErrServiceUnknown, typ)
+	}
+	delete(r.services, typ)
+	return nil
+}
+
+// lookup stores the service registered for the interface type target points to into target
+func (r *serviceRegistry) lookup(target interface{}) error {
+	typ, err := interfaceType(target)
+	if err != nil {
+		return err
+	}
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	svc, exist := r.services[typ]
+	if !exist {
+		return fmt.Errorf("%w: %v", ErrServiceUnknown, typ)
+	}
+	reflect.ValueOf(target).Elem().Set(reflect.ValueOf(svc.service))
+	return nil
+}
+
+// detach removes all services of the plugin
+func (r *serviceRegistry) detach(plugin string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for typ, svc := range r.services {
+		if svc.plugin == plugin {
+			delete(r.services, typ)
+		}
+	}
+}
+
+// busTopic is a topic of the event bus, all events of a topic have the same type
+type busTopic struct {
+	typ  reflect.Type
+	feed event.Feed
+}
+
+// eventBus delivers events between plugins by topic name
+type eventBus struct {
+	topics map[string]*busTopic
+	mtx    sync.Mutex
+}
+
+// topic returns the topic of the given name, the topic event type is set by its first user
+func (b *eventBus) topic(name string, typ reflect.Type) (*busTopic, error) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if topic, exist := b.topics[name]; exist {
+		if topic.typ != typ {
+			return nil, fmt.Errorf("%w: topic %s has events of type %v, got %v", errTopicTypeMismatch, name, topic.typ, typ)
+		}
+		return topic, nil
+	}
+	if b.topics == nil {
+		b.topics = make(map[string]*busTopic)
+	}
+	topic := &busTopic{typ: typ}
+	b.topics[name] = topic
+	return topic, nil
+}
+
+func (b *eventBus) subscribe(name string, channel interface{}) (event.Subscription, error) {
+	chanType := reflect.TypeOf(channel)
+	if chanType == nil || chanType.Kind() != reflect.Chan || chanType.ChanDir()&reflect.SendDir == 0 {
+		return nil, fmt.Errorf("%w: expected a sendable channel, got %T", errTopicTypeMismatch, channel)
+	}
+	topic, err := b.topic(name, chanType.Elem())
+	if err != nil {
+		return nil, err
+	}
+	return topic.feed.Subscribe(channel), nil
+}
+
+func (b *eventBus) publish(name string, ev interface{}) (int, error) {
+	if ev == nil {
+		return 0, fmt.Errorf("%w: nil event", errTopicTypeMismatch)
+	}
+	topic, err := b.topic(name, reflect.TypeOf(ev))
+	if err != nil {
+		return 0, err
+	}
+	return topic.feed.Send(ev), nil
+}
+
+// RegisterService makes the service available to other plugins under the interface
+// type iface points to, e.g. (*discordbot.DiscordBot)(nil). The service is removed
+// when the plugin is disabled.
+func (ctx *PluginCtx) RegisterService(iface interface{}, service interface{}) error {
+	return ctx.services.register(ctx.name, iface, service)
+}
+
+// UnregisterService removes a service registered by the plugin
+func (ctx *PluginCtx) UnregisterService(iface interface{}) error {
+	return ctx.services.unregister(ctx.name, iface)
+}
+
+// Service retrieves the service registered under the interface type target points to:
+//
+//	var bot discordbot.DiscordBot
+//	err := ctx.Service(&bot)
+//
+// Returns ErrServiceUnknown if no enabled plugin provides it. The service must not be
+// used after its plugin was disabled, which is guaranteed by declaring the plugin
+// as a dependency in the Manifest.
+func (ctx *PluginCtx) Service(target interface{}) error {
+	return ctx.services.lookup(target)
+}
+
+// Subscribe delivers the events published to the topic into channel until the plugin
+// is disabled, the channel element type must match the events of the topic.
+func (ctx *PluginCtx) Subscribe(topic string, channel interface{}) (event.Subscription, error) {
+	sub, err := ctx.bus.subscribe(topic, channel)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.EventScope.Track(sub), nil
+}
+
+// Publish sends the event to all subscribers of the topic and blocks until they
+// received it, returns the number of subscribers the event was sent to
+func (ctx *PluginCtx) Publish(topic string, ev interface{}) (int, error) {
+	return ctx.bus.publish(topic, ev)
+}
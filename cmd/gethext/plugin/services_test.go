@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testGreeter interface {
+	Greet() string
+}
+
+type testGreeterImpl struct{}
+
+func (g *testGreeterImpl) Greet() string { return "hello" }
+
+type testEvent struct {
+	Value int
+}
+
+type testServicePlugin struct {
+	testPlugin
+	events chan testEvent
+}
+
+func (p *testServicePlugin) OnEnable(ctx *PluginCtx) error {
+	if err := ctx.RegisterService((*testGreeter)(nil), &testGreeterImpl{}); err != nil {
+		return err
+	}
+	_, err := ctx.Subscribe("test/events", p.events)
+	return err
+}
+
+func TestServiceRegistry(t *testing.T) {
+	events := []string{}
+	m := newTestManager(&events, map[string][]string{"provider": nil, "consumer": {"provider"}})
+	provider := &testServicePlugin{testPlugin{name: "provider", events: &events}, make(chan testEvent, 1)}
+	m.plugins["provider"].instance = provider
+	m.plugins["provider"].ctx.name = "provider"
+	m.plugins["consumer"].ctx.name = "consumer"
+	consumer := m.plugins["consumer"].ctx
+
+	var greeter testGreeter
+	assert.ErrorIs(t, consumer.Service(&greeter), ErrServiceUnknown)
+	assert.NoError(t, m.EnablePlugin("consumer"))
+	assert.NoError(t, consumer.Service(&greeter))
+	assert.Equal(t, "hello", greeter.Greet())
+
+	// only one plugin can provide a service, and services must implement the interface
+	assert.ErrorIs(t, consumer.RegisterService((*testGreeter)(nil), &testGreeterImpl{}), errServiceExists)
+	assert.ErrorIs(t, consumer.RegisterService((*testGreeter)(nil), "greeter"), errInvalidService)
+	assert.ErrorIs(t, consumer.Service(greeter), errInvalidService)
+
+	// services and subscriptions are removed when the provider is disabled
+	assert.NoError(t, m.DisablePlugin("provider"))
+	assert.ErrorIs(t, consumer.Service(&greeter), ErrServiceUnknown)
+	sent, err := consumer.Publish("test/events", testEvent{1})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+}
+
+func TestEventBus(t *testing.T) {
+	ctx := &PluginCtx{sharedCtx: &sharedCtx{}, name: "test"}
+	ch := make(chan testEvent, 1)
+	sub, err := ctx.Subscribe("test/events", ch)
+	assert.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	sent, err := ctx.Publish("test/events", testEvent{42})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, testEvent{42}, <-ch)
+
+	// the event type of a topic is fixed
+	_, err = ctx.Publish("test/events", 42)
+	assert.ErrorIs(t, err, errTopicTypeMismatch)
+	_, err = ctx.Subscribe("test/events", make(chan int))
+	assert.ErrorIs(t, err, errTopicTypeMismatch)
+	_, err = ctx.Subscribe("test/other", testEvent{})
+	assert.ErrorIs(t, err, errTopicTypeMismatch)
+}
@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	storeExpiryLength  = 8 // Values are prefixed by the big endian unix time they expire at, 0 if never
+	storePruneInterval = 10 * time.Minute
+	storeKeyPrefix     = "s/" // Store records are kept apart from the raw data of OpenDatabase
+)
+
+var (
+	ErrKeyNotFound   = errors.New("key not found")
+	errInvalidRecord = errors.New("invalid store record")
+)
+
+// Store is the key-value storage of a plugin, keys are scoped to the plugin name in
+// the extended database and kept under storeKeyPrefix. Values can be written with a time-to-live, expired values
+// are not returned and are deleted periodically while the plugin is enabled.
+type Store struct {
+	db    ethdb.Database
+	ttl   time.Duration
+	clock func() time.Time
+}
+
+// WithTTL returns a view of the store which writes values expiring after ttl
+func (s *Store) WithTTL(ttl time.Duration) *Store {
+	return &Store{db: s.db, ttl: ttl, clock: s.clock}
+}
+
+func (s *Store) encode(val []byte) []byte {
+	ret := make([]byte, storeExpiryLength+len(val))
+	if s.ttl > 0 {
+		binary.BigEndian.PutUint64(ret, uint64(s.clock().Add(s.ttl).Unix()))
+	}
+	copy(ret[storeExpiryLength:], val)
+	return ret
+}
+
+// decode returns the value of a stored record, or false if the record expired
+func (s *Store) decode(record []byte) ([]byte, bool, error) {
+	if len(record) < storeExpiryLength {
+		return nil, false, errInvalidRecord
+	}
+	expiry := binary.BigEndian.Uint64(record)
+	if expiry != 0 && s.clock().Unix() >= int64(expiry) {
+		return nil, false, nil
+	}
+	return record[storeExpiryLength:], true, nil
+}
+
+func (s *Store) Has(key []byte) (bool, error) {
+	_, err := s.Get(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Get returns the value of the key, or ErrKeyNotFound if it does not exist or expired
+func (s *Store) Get(key []byte) ([]byte, error) {
+	record, err := s.db.Get(key)
+	if err != nil {
+		// database backends report missing keys with their own errors
+		if has, hasErr := s.db.Has(key); hasErr == nil && !has {
+			return nil, ErrKeyNotFound
+		}
+		return nil, err
+	}
+	val, alive, err := s.decode(record)
+	if err != nil {
+		return nil, err
+	}
+	if !alive {
+		return nil, ErrKeyNotFound
+	}
+	return val, nil
+}
+
+func (s *Store) Put(key []byte, val []byte) error {
+	return s.db.Put(key, s.encode(val))
+}
+
+func (s *Store) Delete(key []byte) error {
+	return s.db.Delete(key)
+}
+
+// GetRLP decodes the RLP encoded value of the key into val
+func (s *Store) GetRLP(key []byte, val interface{}) error {
+	data, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	return rlp.DecodeBytes(data, val)
+}
+
+// PutRLP writes the RLP encoding of val
+func (s *Store) PutRLP(key []byte, val interface{}) error {
+	data, err := rlp.EncodeToBytes(val)
+	if err != nil {
+		return err
+	}
+	return s.Put(key, data)
+}
+
+// GetJSON decodes the JSON encoded value of the key into val
+func (s *Store) GetJSON(key []byte, val interface{}) error {
+	data, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, val)
+}
+
+// PutJSON writes the JSON encoding of val
+func (s *Store) PutJSON(key []byte, val interface{}) error {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return s.Put(key, data)
+}
+
+// Iterate calls fn for every key starting with prefix in key order until fn returns
+// false, expired values are skipped. The key and value are only valid during the call.
+func (s *Store) Iterate(prefix []byte, fn func(key, val []byte) bool) error {
+	it := s.db.NewIterator(prefix, nil)
+	defer it.Release()
+	for it.Next() {
+		val, alive, err := s.decode(it.Value())
+		if err != nil {
+			return err
+		}
+		if alive && !fn(it.Key(), val) {
+			break
+		}
+	}
+	return it.Error()
+}
+
+// Prune deletes expired values, returns the number of deleted values. Only the store
+// records are visited, raw data of OpenDatabase is left untouched.
+func (s *Store) Prune() (int, error) {
+	var (
+		pruned int
+		batch  = s.db.NewBatch()
+		it     = s.db.NewIterator(nil, nil)
+	)
+	defer it.Release()
+	for it.Next() {
+		if _, alive, err := s.decode(it.Value()); err == nil && !alive {
+			batch.Delete(it.Key())
+			pruned++
+		}
+		if batch.ValueSize() >= ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return pruned, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := it.Error(); err != nil {
+		return pruned, err
+	}
+	return pruned, batch.Write()
+}
+
+func newStore(db ethdb.Database) *Store {
+	return &Store{db: db, clock: time.Now}
+}
+
+// pruneStores deletes expired values of enabled plugins periodically
+func (m *PluginManager) pruneStores() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(storePruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, pl := range m.enabledPlugins() {
+				pruned, err := pl.ctx.Store().Prune()
+				if err != nil {
+					log.Error("Could not prune plugin store", "plugin", pl.name, "error", err)
+				} else if pruned > 0 {
+					log.Debug("Pruned expired plugin data", "plugin", pl.name, "count", pruned)
+				}
+			}
+		case <-m.quitCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/gethext/extdb"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/stretchr/testify/assert"
+)
+
+type storeItem struct {
+	Name  string
+	Value uint64
+}
+
+func TestStore(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	ctx := &PluginCtx{sharedCtx: &sharedCtx{db: db}, name: "whalemonitor"}
+	store := ctx.Store()
+
+	assert.NoError(t, store.PutJSON([]byte("json"), &storeItem{"a", 1}))
+	assert.NoError(t, store.PutRLP([]byte("rlp"), &storeItem{"b", 2}))
+	var item storeItem
+	assert.NoError(t, store.GetJSON([]byte("json"), &item))
+	assert.Equal(t, storeItem{"a", 1}, item)
+	assert.NoError(t, store.GetRLP([]byte("rlp"), &item))
+	assert.Equal(t, storeItem{"b", 2}, item)
+	assert.ErrorIs(t, store.GetJSON([]byte("missing"), &item), ErrKeyNotFound)
+
+	// keys are scoped to the plugin name
+	key := append(extdb.PluginDataPrefix("whalemonitor"), storeKeyPrefix+"json"...)
+	has, _ := db.Has(key)
+	assert.True(t, has)
+	owner, ok := extdb.PluginDataOwner(key)
+	assert.True(t, ok)
+	assert.Equal(t, "whalemonitor", owner)
+
+	// database failures are not reported as missing keys
+	db.Close()
+	_, err := store.Get([]byte("json"))
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestStoreIterateTTL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := newStore(rawdb.NewMemoryDatabase())
+	store.clock = func() time.Time { return now }
+
+	store.Put([]byte("tx/1"), []byte("a"))
+	store.WithTTL(time.Minute).Put([]byte("tx/2"), []byte("b"))
+	store.Put([]byte("tx/3"), []byte("c"))
+	store.Put([]byte("other"), []byte("d"))
+
+	iterate := func() []string {
+		ret := []string{}
+		store.Iterate([]byte("tx/"), func(key, val []byte) bool {
+			ret = append(ret, string(key)+"="+string(val))
+			return true
+		})
+		return ret
+	}
+	assert.Equal(t, []string{"tx/1=a", "tx/2=b", "tx/3=c"}, iterate())
+
+	now = now.Add(time.Minute)
+	assert.Equal(t, []string{"tx/1=a", "tx/3=c"}, iterate())
+	has, err := store.Has([]byte("tx/2"))
+	assert.NoError(t, err)
+	assert.False(t, has)
+
+	pruned, err := store.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+	exist, _ := store.db.Has([]byte("tx/2"))
+	assert.False(t, exist)
+}
+
+func TestStorePruneRawData(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ctx := &PluginCtx{sharedCtx: &sharedCtx{db: rawdb.NewMemoryDatabase()}, name: "whalemonitor"}
+	store := ctx.Store()
+	store.clock = func() time.Time { return now }
+	raw := ctx.OpenDatabase()
+
+	// raw values shorter than an expiry or looking expired must survive
+	assert.NoError(t, raw.Put([]byte("raw/1"), []byte{0x01}))
+	assert.NoError(t, raw.Put([]byte("raw/2"), []byte{0, 0, 0, 0, 0, 0, 0, 1, 0xff}))
+	assert.NoError(t, store.WithTTL(time.Minute).Put([]byte("tx/1"), []byte("a")))
+
+	now = now.Add(time.Minute)
+	pruned, err := store.Prune()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pruned)
+	val, err := raw.Get([]byte("raw/1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x01}, val)
+	val, err = raw.Get([]byte("raw/2"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 0, 0, 1, 0xff}, val)
+}
+
+func TestMigratePluginData(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	db.Put([]byte("pwhalemonitorlast"), []byte("1"))
+	db.Put([]byte("pwhalemonitor2/x"), []byte("2"))
+	db.Put([]byte("pwhalemonitor/new"), []byte("3"))
+
+	// whalemonitor2 is loaded, its keys are not taken by whalemonitor
+	isOther := func(owner string) bool { return owner == "whalemonitor2" }
+	moved, err := extdb.MigratePluginData(db, "whalemonitor", isOther)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, moved)
+
+	raw := rawdb.NewTable(db, string(extdb.PluginDataPrefix("whalemonitor")))
+	val, _ := raw.Get([]byte("last"))
+	assert.Equal(t, []byte("1"), val)
+	val, _ = raw.Get([]byte("new"))
+	assert.Equal(t, []byte("3"), val)
+	has, _ := db.Has([]byte("pwhalemonitor2/x"))
+	assert.True(t, has)
+
+	// the migration runs once
+	db.Put([]byte("pwhalemonitorlast"), []byte("1"))
+	moved, err = extdb.MigratePluginData(db, "whalemonitor", isOther)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, moved)
+}
@@ -0,0 +1,223 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const configWatchInterval = 2 * time.Second
+
+var errConfigNotWatched = errors.New("config is not watched")
+
+// ConfigChangeHandler is an optional interface of Plugin to get notified when a watched
+// config changed. Returning an error rejects the new config and keeps the old one.
+type ConfigChangeHandler interface {
+	OnConfigChanged(old, new interface{}) error
+}
+
+// ConfigValidator is an optional interface of config structs, invalid configs are rejected
+type ConfigValidator interface {
+	Validate() error
+}
+
+// watchedConfig is a config file, or a plugin section of the plugins config file,
+// which is decoded into a new config every time the file changed
+type watchedConfig struct {
+	name      string
+	filename  string
+	decode    func(cfg interface{}) error
+	newConfig func() interface{}
+	current   interface{}
+	modTime   time.Time
+	size      int64
+}
+
+// changed returns whether the file changed since the config was last applied, the
+// returned file info is recorded by applied once the changed file was loaded
+func (w *watchedConfig) changed() (bool, os.FileInfo, error) {
+	info, err := os.Stat(w.filename)
+	if err != nil {
+		return false, nil, err
+	}
+	return !info.ModTime().Equal(w.modTime) || info.Size() != w.size, info, nil
+}
+
+// applied records the config loaded from the file with the given info as current
+func (w *watchedConfig) applied(cfg interface{}, info os.FileInfo) {
+	w.current = cfg
+	w.modTime, w.size = info.ModTime(), info.Size()
+}
+
+// load decodes the config file into a new config and validates it
+func (w *watchedConfig) load() (interface{}, error) {
+	cfg := w.newConfig()
+	if err := w.decode(cfg); err != nil {
+		return nil, err
+	}
+	if validator, ok := cfg.(ConfigValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// decodeConfigFile decodes a JSON or TOML file, fields not declared in the config struct are rejected
+func decodeConfigFile(filename string, cfg interface{}) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	switch filepath.Ext(filename) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(cfg)
+	case ".toml":
+		return tomlSettings.Unmarshal(data, cfg)
+	}
+	return fmt.Errorf("unsupported config file %s", filename)
+}
+
+// configWatches holds the configs watched by a plugin while it is enabled
+type configWatches struct {
+	configs  map[string]*watchedConfig
+	onChange func(old, new interface{}) error
+	mtx      sync.Mutex
+}
+
+func (c *configWatches) watch(w *watchedConfig) (interface{}, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	_, info, err := w.changed()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := w.load()
+	if err != nil {
+		return nil, err
+	}
+	w.applied(cfg, info)
+	if c.configs == nil {
+		c.configs = make(map[string]*watchedConfig)
+	}
+	c.configs[w.name] = w
+	return cfg, nil
+}
+
+// reload loads changed configs, or all configs if force is set, and applies the valid ones
+func (c *configWatches) reload(plugin string, force bool) error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	var errs []error
+	for name, w := range c.configs {
+		changed, info, err := w.changed()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("config %s: %w", name, err))
+			continue
+		}
+		if !changed && !force {
+			continue
+		}
+		cfg, err := w.load()
+		if err == nil && c.onChange != nil {
+			err = c.onChange(w.current, cfg)
+		}
+		if err != nil {
+			log.Error("Rejected invalid plugin config, keeping the previous one", "plugin", plugin, "config", name, "error", err)
+			errs = append(errs, fmt.Errorf("config %s: %w", name, err))
+			continue
+		}
+		w.applied(cfg, info)
+		log.Info("Applied changed plugin config", "plugin", plugin, "config", name)
+	}
+	return joinErrors(errs)
+}
+
+func joinErrors(errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(errs))
+	for idx, err := range errs {
+		msgs[idx] = err.Error()
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+func (c *configWatches) reset() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.configs = nil
+}
+
+// WatchConfig loads the plugin section name of the plugins config file into a new
+// config returned by newConfig, the section is reloaded when the file changed.
+// The returned config is never modified, the plugin receives changed configs in
+// OnConfigChanged. Watches are removed when the plugin is disabled.
+func (ctx *PluginCtx) WatchConfig(name string, newConfig func() interface{}) (interface{}, error) {
+	store := ctx.config
+	return ctx.configs.watch(&watchedConfig{
+		name:     name,
+		filename: store.fileName,
+		decode: func(cfg interface{}) error {
+			if err := store.Reload(); err != nil {
+				return err
+			}
+			return store.GetConfig(name, cfg)
+		},
+		newConfig: newConfig,
+	})
+}
+
+// WatchConfigFile loads a JSON or TOML config file into a new config returned by
+// newConfig, the file is reloaded when it changed, see WatchConfig.
+func (ctx *PluginCtx) WatchConfigFile(filename string, newConfig func() interface{}) (interface{}, error) {
+	return ctx.configs.watch(&watchedConfig{
+		name:      filename,
+		filename:  filename,
+		decode:    func(cfg interface{}) error { return decodeConfigFile(filename, cfg) },
+		newConfig: newConfig,
+	})
+}
+
+// CurrentConfig returns the last valid config of a watched config
+func (ctx *PluginCtx) CurrentConfig(name string) (interface{}, error) {
+	ctx.configs.mtx.Lock()
+	defer ctx.configs.mtx.Unlock()
+	if w, exist := ctx.configs.configs[name]; exist {
+		return w.current, nil
+	}
+	return nil, errConfigNotWatched
+}
+
+// ReloadConfigs reloads all watched configs of the plugin even if they did not change
+func (ctx *PluginCtx) ReloadConfigs() error {
+	return ctx.configs.reload(ctx.name, true)
+}
+
+// watchConfigs reloads changed configs of enabled plugins periodically
+func (m *PluginManager) watchConfigs() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, pl := range m.enabledPlugins() {
+				pl.ctx.configs.reload(pl.name, false)
+			}
+		case <-m.quitCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type watchedTestConfig struct {
+	Endpoint string
+	Limit    int
+}
+
+func (c *watchedTestConfig) Validate() error {
+	if c.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	return nil
+}
+
+func writeConfigFile(t *testing.T, filename, content string, modTime time.Time) {
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filename, modTime, modTime)
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.json")
+	now := time.Now()
+	writeConfigFile(t, filename, `{"Endpoint": "a", "Limit": 1}`, now)
+
+	var changes [][2]*watchedTestConfig
+	ctx := &PluginCtx{name: "test"}
+	ctx.configs.onChange = func(old, new interface{}) error {
+		changes = append(changes, [2]*watchedTestConfig{old.(*watchedTestConfig), new.(*watchedTestConfig)})
+		return nil
+	}
+	cfg, err := ctx.WatchConfigFile(filename, func() interface{} { return &watchedTestConfig{} })
+	assert.NoError(t, err)
+	assert.Equal(t, &watchedTestConfig{"a", 1}, cfg)
+
+	// unchanged file is not reloaded
+	assert.NoError(t, ctx.configs.reload("test", false))
+	assert.Empty(t, changes)
+
+	writeConfigFile(t, filename, `{"Endpoint": "b", "Limit": 2}`, now.Add(time.Second))
+	assert.NoError(t, ctx.configs.reload("test", false))
+	assert.Equal(t, [][2]*watchedTestConfig{{{"a", 1}, {"b", 2}}}, changes)
+
+	// invalid edits are rejected and the previous config is kept
+	writeConfigFile(t, filename, `{"Endpoint": "c", "Limit": 0}`, now.Add(2*time.Second))
+	assert.Error(t, ctx.configs.reload("test", false))
+	writeConfigFile(t, filename, `{"Endpoint": "c", "Limit": 3, "Unknown": true}`, now.Add(3*time.Second))
+	assert.Error(t, ctx.configs.reload("test", false))
+	assert.Len(t, changes, 1)
+	current, err := ctx.CurrentConfig(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, &watchedTestConfig{"b", 2}, current)
+
+	// a rejected file is loaded again until it is valid, even if the fixed file has the
+	// same size and modification time, e.g. if it was read while being written
+	assert.Error(t, ctx.configs.reload("test", false))
+	writeConfigFile(t, filename, `{"Endpoint": "d", "Limit": 4}                 `, now.Add(3*time.Second))
+	assert.NoError(t, ctx.configs.reload("test", false))
+	assert.Equal(t, [][2]*watchedTestConfig{{{"a", 1}, {"b", 2}}, {{"b", 2}, {"d", 4}}}, changes)
+	assert.NoError(t, ctx.configs.reload("test", false))
+	assert.Len(t, changes, 2)
+}
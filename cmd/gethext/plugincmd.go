@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/cmd/gethext/plugin"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	pluginCommand = cli.Command{
+		Name:      "plugin",
+		Usage:     "Manage gethext plugins",
+		ArgsUsage: "",
+		Category:  "PLUGIN COMMANDS",
+		Subcommands: []cli.Command{
+			pluginInspectCmd,
+		},
+	}
+	pluginInspectCmd = cli.Command{
+		Action:      inspectPlugin,
+		Name:        "inspect",
+		ArgsUsage:   "<file.so>",
+		Usage:       "Print the manifest of a plugin and whether it is compatible with this host",
+		Description: `This command opens the plugin library without starting the node, the plugin is not loaded nor enabled. It exits with an error if the plugin is not compatible.`,
+	}
+)
+
+func inspectPlugin(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("invalid number of arguments: %v", ctx.Command.ArgsUsage)
+	}
+	manifest, err := plugin.InspectPlugin(ctx.Args().Get(0))
+	if err != nil {
+		fmt.Println("Compatible:    no")
+		return err
+	}
+	fmt.Println("Name:         ", manifest.Name)
+	fmt.Println("Version:      ", manifest.Version)
+	fmt.Println("API version:  ", manifest.APIVersion)
+	fmt.Println("Dependencies: ", strings.Join(manifest.Dependencies, ", "))
+	if manifest.Config != nil {
+		section := manifest.ConfigSection
+		if section == "" {
+			section = "(plugin config file)"
+		}
+		fmt.Println("Config:       ", section)
+		if out, err := tomlSettings.Marshal(manifest.Config); err == nil {
+			fmt.Println(strings.TrimSpace(string(out)))
+		}
+	}
+	if err := manifest.CheckCompatibility(); err != nil {
+		fmt.Println("Compatible:    no")
+		return err
+	}
+	fmt.Printf("Compatible:    yes (host API version %d)\n", plugin.APIVersion)
+	return nil
+}
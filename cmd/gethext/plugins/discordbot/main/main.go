@@ -5,13 +5,24 @@ import (
 	"errors"
 
 	"github.com/ethereum/go-ethereum/cmd/gethext/plugin"
-	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/cmd/gethext/plugins/discordbot"
 )
 
 const (
 	pluginName = "DiscordBot"
 )
 
+var (
+	log = plugin.NewLogger("discordbot")
+)
+
+var Manifest = plugin.Manifest{
+	Name:          "discordbot",
+	APIVersion:    plugin.APIVersion,
+	ConfigSection: pluginName,
+	Config:        &DiscordConfig{},
+}
+
 type DiscordConfig struct {
 	BotToken     string   `json:"botToken"`
 	CmdPrefix    string   `json:"cmdPrefix"`
@@ -51,8 +62,7 @@ func (p *DiscordPlugin) OnEnable(ctx *plugin.PluginCtx) error {
 	botCtx, cancel := context.WithCancel(context.Background())
 	p.quit = cancel
 	go p.bot.Run(botCtx)
-	ctx.Set(pluginName, p.bot)
-	return nil
+	return ctx.RegisterService((*discordbot.DiscordBot)(nil), p.bot)
 }
 
 func (p *DiscordPlugin) OnDisable(ctx *plugin.PluginCtx) error {
@@ -13,13 +13,18 @@ import (
 )
 
 const (
-	pluginName = "JETH"
+	pluginName = "jeth" // Plugin file name, also names its logger
 )
 
 var (
 	logger = plugin.NewLogger(pluginName)
 )
 
+var Manifest = plugin.Manifest{
+	Name:       pluginName,
+	APIVersion: plugin.APIVersion,
+}
+
 type JETH struct {
 	ctx      *plugin.PluginCtx    // JETH plugin context
 	rootDir  string               // Root directory where JavaScript files are located
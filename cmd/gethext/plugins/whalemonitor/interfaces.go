@@ -4,9 +4,11 @@ import (
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/event"
 )
 
+// WhaleEventTopic is the plugin event bus topic the whale monitor publishes WhaleEvent to
+const WhaleEventTopic = "whalemonitor/whale"
+
 type WhaleEventType int
 
 const (
@@ -35,7 +37,3 @@ type WhaleEvent struct {
 	TxHash    common.Hash
 	Transfers []TokenTransfer
 }
-
-type WhaleMonitor interface {
-	SubscribeWhaleEvent(ch chan<- WhaleEvent) event.Subscription
-}
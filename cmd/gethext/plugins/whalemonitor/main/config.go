@@ -3,7 +3,7 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"net/url"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -63,14 +63,20 @@ func (c *Config) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-func loadConfig(filename string, cfg interface{}) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		return fmt.Errorf("failed to open config file: %w", err)
+// Validate is called by the plugin config watcher, invalid edits of the config file are rejected
+func (c *Config) Validate() error {
+	if u, err := url.Parse(c.ExplorerUrl); err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("invalid explorer url %q", c.ExplorerUrl)
 	}
-	defer file.Close()
-	if err := json.NewDecoder(file).Decode(cfg); err != nil {
-		return fmt.Errorf("failed to decode config file: %w", err)
+	for token, threshold := range c.Thresholds {
+		if threshold < 0 {
+			return fmt.Errorf("negative threshold of token %s", token)
+		}
 	}
 	return nil
 }
+
+func newConfig() interface{} {
+	config := defaultConfig
+	return &config
+}
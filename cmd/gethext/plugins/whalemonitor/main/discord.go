@@ -2,9 +2,7 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
-	"path"
 	"strings"
 	"time"
 
@@ -15,10 +13,6 @@ import (
 	"github.com/lus/dgc"
 )
 
-const (
-	discordInstance = "DiscordBot"
-)
-
 var (
 	msgConfigReloadFail = &discordgo.MessageSend{
 		Content: "❌ Failed to reload config file.",
@@ -37,28 +31,28 @@ type WhaleBot struct {
 
 func (bot *WhaleBot) Stop() {
 	bot.sub.Unsubscribe()
-	close(bot.whaleCh)
 }
 
 func (bot *WhaleBot) renderWhaleTokenTransferMessage(event *whalemonitor.WhaleEvent) *discordgo.MessageSend {
 	title := "Whale Transfer Detected!"
+	config := bot.getConfig()
 	var desc strings.Builder
-	desc.WriteString(fmt.Sprintf("**TxHash**\n [%s](%s/tx/%s)\n", event.TxHash, bot.config.ExplorerUrl, event.TxHash))
+	desc.WriteString(fmt.Sprintf("**TxHash**\n [%s](%s/tx/%s)\n", event.TxHash, config.ExplorerUrl, event.TxHash))
 	desc.WriteString("\n**Transfers**\n")
 	for idx, transfer := range event.Transfers {
 		var tokenAmount string
 		if transfer.Token != nil {
 			amount := AmountString(transfer.Value, transfer.Token.Decimals)
-			tokenAmount = fmt.Sprintf("%s [%s](%s/address/%s)", amount, transfer.Token.Symbol, bot.config.ExplorerUrl, transfer.Token.Address)
+			tokenAmount = fmt.Sprintf("%s [%s](%s/address/%s)", amount, transfer.Token.Symbol, config.ExplorerUrl, transfer.Token.Address)
 		} else {
 			amount := AmountString(transfer.Value, 18)
-			tokenAmount = fmt.Sprintf("%s %s", amount, bot.config.NativeToken)
+			tokenAmount = fmt.Sprintf("%s %s", amount, config.NativeToken)
 		}
 		desc.WriteString(fmt.Sprintf(
 			"%d. [%s](%s) => [%s](%s): %s\n",
 			idx+1,
-			transfer.From, fmt.Sprintf("%s/address/%s", bot.config.ExplorerUrl, transfer.From),
-			transfer.To, fmt.Sprintf("%s/address/%s", bot.config.ExplorerUrl, transfer.To),
+			transfer.From, fmt.Sprintf("%s/address/%s", config.ExplorerUrl, transfer.From),
+			transfer.To, fmt.Sprintf("%s/address/%s", config.ExplorerUrl, transfer.To),
 			tokenAmount,
 		))
 	}
@@ -110,7 +104,7 @@ func (bot *WhaleBot) registerBotCommands() {
 }
 
 func (bot *WhaleBot) sendChannelMessage(msg *discordgo.MessageSend) error {
-	if err := bot.SendChannelMessage(bot.config.ChannelId, msg); err != nil {
+	if err := bot.SendChannelMessage(bot.getConfig().ChannelId, msg); err != nil {
 		msgJson, _ := json.Marshal(msg)
 		log.Error("Could not send discord message", "msg", string(msgJson), "error", err)
 		return err
@@ -119,13 +113,12 @@ func (bot *WhaleBot) sendChannelMessage(msg *discordgo.MessageSend) error {
 }
 
 func (bot *WhaleBot) handleReload(ctx *dgc.Ctx) {
-	configFile := path.Join(bot.handler.DataDir, defaultConfigFile)
 	msg := msgConfigReloadOK
-	if err := loadConfig(configFile, bot.config); err != nil {
+	if err := bot.handler.ReloadConfigs(); err != nil {
 		log.Error("Failed to reload config file", "error", err)
 		msg = msgConfigReloadFail
 	}
-	buf, _ := json.MarshalIndent(bot.config, "", " ")
+	buf, _ := json.MarshalIndent(bot.getConfig(), "", " ")
 	bot.sendChannelMessage(&discordgo.MessageSend{
 		Content: fmt.Sprintf("```json\n%s\n```", string(buf)),
 	})
@@ -133,7 +126,7 @@ func (bot *WhaleBot) handleReload(ctx *dgc.Ctx) {
 }
 
 func (bot *WhaleBot) handleShowConfig(ctx *dgc.Ctx) {
-	buf, _ := json.MarshalIndent(bot.config, "", "  ")
+	buf, _ := json.MarshalIndent(bot.getConfig(), "", "  ")
 	msg := &discordgo.MessageSend{
 		Content: fmt.Sprintf("```json\n%s\n```", string(buf)),
 	}
@@ -145,13 +138,15 @@ func NewWhaleBot(handler *handler) (*WhaleBot, error) {
 		handler: handler,
 		whaleCh: make(chan whalemonitor.WhaleEvent),
 	}
-	if instance, exist := handler.Get(discordInstance); exist {
-		bot.DiscordBot = instance.(discordbot.DiscordBot)
-	} else {
-		return nil, errors.New("discord bot plugin not enabled")
+	if err := handler.Service(&bot.DiscordBot); err != nil {
+		return nil, fmt.Errorf("discord bot plugin not enabled: %w", err)
+	}
+	sub, err := handler.Subscribe(whalemonitor.WhaleEventTopic, bot.whaleCh)
+	if err != nil {
+		return nil, err
 	}
+	bot.sub = sub
 	bot.registerBotCommands()
-	bot.sub = handler.SubscribeWhaleEvent(bot.whaleCh)
 	go bot.notifyLoop()
 	return bot, nil
 }
@@ -1,26 +1,27 @@
 package main
 
 import (
+	"sync/atomic"
+
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/cmd/gethext/plugin"
 	"github.com/ethereum/go-ethereum/cmd/gethext/plugins/whalemonitor"
 	"github.com/ethereum/go-ethereum/cmd/gethext/plugins/whalemonitor/contracts"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
-	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
 // handler serves as a base type for monitor processors.
 type handler struct {
 	*plugin.PluginCtx
-	config *Config
+	config atomic.Value // *Config, swapped as a whole when the config file changes
 	client *rpc.Client
-	feed   event.Feed
 }
 
-func (p *handler) SubscribeWhaleEvent(ch chan whalemonitor.WhaleEvent) event.Subscription {
-	return p.EventScope.Track(p.feed.Subscribe(ch))
+// getConfig returns the current plugin config, the returned config is never modified
+func (t *handler) getConfig() *Config {
+	return t.config.Load().(*Config)
 }
 
 func (t *handler) getERC20Info(addr common.Address) (*whalemonitor.ERC20Token, error) {
@@ -7,22 +7,31 @@ import (
 )
 
 const (
-	pluginNamespace   = "WhaleMonitor"
+	pluginName        = "whalemonitor"
 	defaultConfigFile = "config.json"
 )
 
 var (
-	log = plugin.NewLogger(pluginNamespace)
+	log = plugin.NewLogger(pluginName)
 )
 
+// Manifest declares the discord bot plugin as a dependency, so it is enabled first
+var Manifest = plugin.Manifest{
+	Name:         pluginName,
+	APIVersion:   plugin.APIVersion,
+	Dependencies: []string{"discordbot"},
+	Config:       newConfig(),
+}
+
 type WhaleMonitorPlugin struct {
 	*handler
-	bot *WhaleBot
+	bot     *WhaleBot
+	monitor *TokenTransferMonitor
 }
 
 func (p *WhaleMonitorPlugin) OnEnable(ctx *plugin.PluginCtx) error {
-	config := defaultConfig
-	if err := loadConfig(path.Join(ctx.DataDir, defaultConfigFile), &config); err != nil {
+	config, err := ctx.WatchConfigFile(path.Join(ctx.DataDir, defaultConfigFile), newConfig)
+	if err != nil {
 		return err
 	}
 
@@ -33,19 +42,27 @@ func (p *WhaleMonitorPlugin) OnEnable(ctx *plugin.PluginCtx) error {
 	p.handler = &handler{
 		PluginCtx: ctx,
 		client:    client,
-		config:    &config,
 	}
+	p.handler.config.Store(config.(*Config))
 
 	p.bot, err = NewWhaleBot(p.handler)
 	if err != nil {
 		return err
 	}
 
-	ctx.Monitor.AddProcessor(NewTokenTransferMonitor(p.handler))
+	p.monitor = NewTokenTransferMonitor(p.handler)
+	ctx.Monitor.AddProcessor(p.monitor)
+	return nil
+}
+
+// OnConfigChanged applies the config file once it was edited
+func (p *WhaleMonitorPlugin) OnConfigChanged(old, new interface{}) error {
+	p.config.Store(new.(*Config))
 	return nil
 }
 
 func (p *WhaleMonitorPlugin) OnDisable(ctx *plugin.PluginCtx) error {
+	ctx.Monitor.RemoveProcessor(p.monitor)
 	p.bot.Stop()
 	return nil
 }
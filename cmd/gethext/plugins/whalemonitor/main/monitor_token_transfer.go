@@ -13,6 +13,8 @@ import (
 type TokenTransferMonitor struct {
 	*handler
 	transfers []whalemonitor.TokenTransfer
+	block     common.Hash               // Block of the pending events
+	pending   []whalemonitor.WhaleEvent // Whale events of the current block, published once the block is committed
 }
 
 func (m *TokenTransferMonitor) OnTxStart(ctx *reexec.Context, gasLimit uint64) {
@@ -56,7 +58,7 @@ func (m *TokenTransferMonitor) OnCallExit(ctx *reexec.Context, call *reexec.Call
 		})
 	}
 
-	contract, err := abiutils.DefaultParser().ParseContract(ctx.State().GetCode(call.To))
+	contract, err := abiutils.DefaultParser().ParseContractAt(abiutils.NewStateCaller(ctx.EVM()), call.To)
 	if err != nil {
 		return
 	}
@@ -87,16 +89,19 @@ func (m *TokenTransferMonitor) OnTxEnd(ctx *reexec.Context, ret *reexec.TxResult
 	}
 
 	// Check if any token transfer meet the whale threshold
+	config := m.getConfig()
 	for _, transfer := range m.transfers {
 		var threshold *big.Int = nil
 		if transfer.Token == nil {
-			threshold = ParseAmount(m.config.Thresholds[nilAddress], 18)
-		} else if thrsVal, exist := m.config.Thresholds[transfer.Token.Address]; exist {
+			threshold = ParseAmount(config.Thresholds[nilAddress], 18)
+		} else if thrsVal, exist := config.Thresholds[transfer.Token.Address]; exist {
 			threshold = ParseAmount(thrsVal, transfer.Token.Decimals)
 		}
 		if threshold != nil && transfer.Value.Cmp(threshold) >= 0 {
-			log.Warn("Whale transfer detected!", "tx", tx.Hash().Hex())
-			m.feed.Send(whalemonitor.WhaleEvent{
+			if hash := ctx.Block().Hash(); hash != m.block {
+				m.block, m.pending = hash, nil
+			}
+			m.pending = append(m.pending, whalemonitor.WhaleEvent{
 				Type:      whalemonitor.TypeTokenTransfer,
 				TxHash:    tx.Hash(),
 				Transfers: m.transfers,
@@ -106,6 +111,23 @@ func (m *TokenTransferMonitor) OnTxEnd(ctx *reexec.Context, ret *reexec.TxResult
 	}
 }
 
+// OnBlockCommit publishes the whale events of the block once it was replayed
+func (m *TokenTransferMonitor) OnBlockCommit(ctx *reexec.Context) {
+	if ctx.Block().Hash() != m.block {
+		return
+	}
+	for _, ev := range m.pending {
+		log.Warn("Whale transfer detected!", "tx", ev.TxHash.Hex())
+		m.Publish(whalemonitor.WhaleEventTopic, ev)
+	}
+	m.pending = nil
+}
+
+// OnBlockDiscard drops the whale events of a divergent block
+func (m *TokenTransferMonitor) OnBlockDiscard(ctx *reexec.Context, report *reexec.DivergenceReport) {
+	m.pending = nil
+}
+
 func NewTokenTransferMonitor(handler *handler) *TokenTransferMonitor {
 	return &TokenTransferMonitor{
 		handler: handler,
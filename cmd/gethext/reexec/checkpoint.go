@@ -0,0 +1,473 @@
+package reexec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var errCheckpointAborted = errors.New("checkpoint write aborted")
+
+var (
+	checkpointIndexKey    = []byte("CheckpointIndex") // checkpointIndexKey tracks the list of checkpoints stored in database
+	checkpointNodesPrefix = []byte("n")               // checkpointNodesPrefix + block number + block hash + node key -> trie node or contract code
+
+	emptyCodeHash = crypto.Keccak256Hash(nil)
+)
+
+var DefaultCheckpointConfig = CheckpointConfig{
+	Interval: 0,
+	MaxSize:  32 * 1024 * 1024 * 1024,
+}
+
+// CheckpointConfig controls how regenerated historical states are persisted
+type CheckpointConfig struct {
+	Interval uint64             // Write a checkpoint every Interval regenerated blocks, 0 disables checkpointing
+	MaxSize  common.StorageSize // Disk budget of all checkpoints, least recently used checkpoints are evicted first
+}
+
+func (cfg *CheckpointConfig) Sanitize() error {
+	if cfg.Interval > 0 && cfg.MaxSize <= 0 {
+		return errors.New("checkpoint size budget must be greater than zero")
+	}
+	return nil
+}
+
+// checkpoint is an index entry of a state persisted in the checkpoint database
+type checkpoint struct {
+	Number   uint64      // Block number of the checkpointed state
+	Hash     common.Hash // Block hash of the checkpointed state
+	Root     common.Hash // State root of the block
+	Size     uint64      // Total size of trie nodes and contract codes stored for this checkpoint
+	LastUsed uint64      // Unix timestamp of the last time the checkpoint was used as a base state
+}
+
+func (cp *checkpoint) prefix() []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(checkpointNodesPrefix)
+	binary.Write(buf, binary.BigEndian, cp.Number)
+	buf.Write(cp.Hash.Bytes())
+	return buf.Bytes()
+}
+
+// CheckpointStore keeps regenerated states in a dedicated database. Every checkpoint
+// stores all trie nodes and codes of its state under its own key space, so it can be
+// opened after the chain database was pruned and evicted without affecting the others.
+// The store is shared by replayers, see NewChainReplayerWithCheckpoints.
+type CheckpointStore struct {
+	config  *CheckpointConfig
+	diskdb  ethdb.Database              // Dedicated database that checkpoints are written to
+	chaindb ethdb.Database              // Chain database the states are regenerated from
+	index   map[common.Hash]*checkpoint // Block hash to checkpoint
+	dirty   bool                        // Whether the index changed since it was persisted
+	refs    map[common.Hash]int         // Number of replayers using the checkpoint as a base state
+	size    common.StorageSize
+	mtx     sync.RWMutex
+
+	writeCh chan *checkpointWrite // States handed over to the writer
+	quitCh  chan struct{}
+	wg      sync.WaitGroup
+}
+
+// checkpointWrite is a state waiting to be checkpointed by the writer
+type checkpointWrite struct {
+	block      *types.Block
+	stateCache state.Database // State cache holding the state, its root is referenced until written
+	done       func()         // Called once the checkpoint was written or failed
+}
+
+func (s *CheckpointStore) loadIndex() {
+	data, _ := s.diskdb.Get(checkpointIndexKey)
+	if len(data) == 0 {
+		return
+	}
+	var list []*checkpoint
+	if err := rlp.DecodeBytes(data, &list); err != nil {
+		log.Error("Invalid checkpoint index", "error", err)
+		return
+	}
+	for _, cp := range list {
+		s.index[cp.Hash] = cp
+		s.size += common.StorageSize(cp.Size)
+	}
+}
+
+func (s *CheckpointStore) writeIndex(db ethdb.KeyValueWriter) {
+	s.dirty = false
+	list := make([]*checkpoint, 0, len(s.index))
+	for _, cp := range s.index {
+		list = append(list, cp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Number < list[j].Number })
+	enc, _ := rlp.EncodeToBytes(list)
+	if err := db.Put(checkpointIndexKey, enc); err != nil {
+		log.Crit("Failed to write checkpoint index", "err", err)
+	}
+}
+
+// Has returns whether the state of the given block was checkpointed
+func (s *CheckpointStore) Has(blockHash common.Hash) bool {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	_, exist := s.index[blockHash]
+	return exist
+}
+
+// acquire returns the database of the checkpoint at the given block, the checkpoint is
+// not evicted until it is released. Returns false if there is no such checkpoint.
+func (s *CheckpointStore) acquire(blockHash common.Hash) (ethdb.Database, bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	cp, exist := s.index[blockHash]
+	if !exist {
+		return nil, false
+	}
+	s.refs[blockHash]++
+	// the usage time is persisted with the next change of the index
+	cp.LastUsed = uint64(time.Now().Unix())
+	s.dirty = true
+	return rawdb.NewTable(s.diskdb, string(cp.prefix())), true
+}
+
+// release marks the checkpoint as no longer used by a replayer
+func (s *CheckpointStore) release(blockHash common.Hash) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.refs[blockHash]--; s.refs[blockHash] <= 0 {
+		delete(s.refs, blockHash)
+	}
+}
+
+// schedule hands the state of the block over to the writer, the state root is referenced
+// in the trie database of the state cache so the state is not garbage collected before
+// it was written. Returns false if the writer is still busy with the previous checkpoint.
+func (s *CheckpointStore) schedule(block *types.Block, stateCache state.Database, done func()) bool {
+	if s.Has(block.Hash()) {
+		return false
+	}
+	// a root which is not held in memory was committed to disk with all its nodes,
+	// then the reference is a noop and removing it later does not affect the cache
+	triedb := stateCache.TrieDB()
+	triedb.Reference(block.Root(), common.Hash{})
+	select {
+	case s.writeCh <- &checkpointWrite{block: block, stateCache: stateCache, done: done}:
+		return true
+	case <-s.quitCh:
+	default:
+	}
+	triedb.Dereference(block.Root())
+	return false
+}
+
+// writeLoop writes scheduled checkpoints one at a time, away from the replay
+func (s *CheckpointStore) writeLoop() {
+	defer s.wg.Done()
+	for {
+		select {
+		case req := <-s.writeCh:
+			if err := s.Write(req.block, req.stateCache); err != nil {
+				log.Warn("Could not write state checkpoint", "number", req.block.NumberU64(), "error", err)
+			}
+			req.stateCache.TrieDB().Dereference(req.block.Root())
+			if req.done != nil {
+				req.done()
+			}
+		case <-s.quitCh:
+			return
+		}
+	}
+}
+
+// Close stops the writer, aborting the checkpoint being written, and persists the index
+func (s *CheckpointStore) Close() {
+	select {
+	case <-s.quitCh:
+		return
+	default:
+		close(s.quitCh)
+	}
+	s.wg.Wait()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.dirty {
+		s.writeIndex(s.diskdb)
+	}
+}
+
+// Write copies all trie nodes and codes of the given state into a new checkpoint, then
+// evicts old checkpoints if needed. Nodes are copied even if they are available in the
+// chain database, which may be pruned later on.
+func (s *CheckpointStore) Write(block *types.Block, stateCache state.Database) error {
+	if s.Has(block.Hash()) {
+		return nil
+	}
+	var (
+		start = time.Now()
+		cp    = &checkpoint{Number: block.NumberU64(), Hash: block.Hash(), Root: block.Root()}
+		table = rawdb.NewTable(s.diskdb, string(cp.prefix()))
+		batch = table.NewBatch()
+	)
+	writeTrie := func(tr state.Trie, onLeaf func(key, blob []byte) error) error {
+		it := tr.NodeIterator(nil)
+		for it.Next(true) {
+			if hash := it.Hash(); hash != (common.Hash{}) {
+				blob, err := stateCache.TrieDB().Node(hash)
+				if err != nil {
+					return err
+				}
+				batch.Put(hash.Bytes(), blob)
+				cp.Size += uint64(len(hash) + len(blob))
+			}
+			if it.Leaf() && onLeaf != nil {
+				if err := onLeaf(it.LeafKey(), it.LeafBlob()); err != nil {
+					return err
+				}
+			}
+			if batch.ValueSize() > ethdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					return err
+				}
+				batch.Reset()
+				select {
+				case <-s.quitCh:
+					return errCheckpointAborted
+				default:
+				}
+			}
+		}
+		return it.Error()
+	}
+	accTrie, err := stateCache.OpenTrie(block.Root())
+	if err != nil {
+		return err
+	}
+	err = writeTrie(accTrie, func(key, blob []byte) error {
+		var acc types.StateAccount
+		if err := rlp.DecodeBytes(blob, &acc); err != nil {
+			return err
+		}
+		if acc.Root != types.EmptyRootHash {
+			storageTrie, err := stateCache.OpenStorageTrie(common.BytesToHash(key), acc.Root)
+			if err != nil {
+				return err
+			}
+			if err := writeTrie(storageTrie, nil); err != nil {
+				return err
+			}
+		}
+		codeHash := common.BytesToHash(acc.CodeHash)
+		if codeHash != emptyCodeHash {
+			code, err := stateCache.ContractCode(common.BytesToHash(key), codeHash)
+			if err != nil {
+				return err
+			}
+			rawdb.WriteCode(batch, codeHash, code)
+			cp.Size += uint64(len(codeHash) + len(code))
+		}
+		return nil
+	})
+	if err == nil {
+		err = batch.Write()
+	}
+	if err != nil {
+		s.deleteNodes(cp)
+		return err
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	cp.LastUsed = uint64(time.Now().Unix())
+	s.index[cp.Hash] = cp
+	s.size += common.StorageSize(cp.Size)
+	s.evict()
+	s.writeIndex(s.diskdb)
+	log.Info("Wrote state checkpoint", "number", cp.Number, "hash", cp.Hash, "size", common.StorageSize(cp.Size), "total", s.size, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// evict removes least recently used checkpoints until the total size fits the budget.
+// Checkpoints that are in use as base states are never evicted.
+func (s *CheckpointStore) evict() {
+	if s.size <= s.config.MaxSize {
+		return
+	}
+	s.dirty = true
+	list := make([]*checkpoint, 0, len(s.index))
+	for _, cp := range s.index {
+		if s.refs[cp.Hash] == 0 {
+			list = append(list, cp)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastUsed < list[j].LastUsed })
+	for _, cp := range list {
+		if s.size <= s.config.MaxSize {
+			break
+		}
+		s.deleteNodes(cp)
+		delete(s.index, cp.Hash)
+		s.size -= common.StorageSize(cp.Size)
+		log.Info("Evicted state checkpoint", "number", cp.Number, "hash", cp.Hash, "size", common.StorageSize(cp.Size))
+	}
+}
+
+func (s *CheckpointStore) deleteNodes(cp *checkpoint) {
+	it := s.diskdb.NewIterator(cp.prefix(), nil)
+	defer it.Release()
+	batch := s.diskdb.NewBatch()
+	for it.Next() {
+		batch.Delete(it.Key())
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			batch.Write()
+			batch.Reset()
+		}
+	}
+	if err := batch.Write(); err != nil {
+		log.Error("Failed to delete checkpoint", "number", cp.Number, "error", err)
+	}
+}
+
+// NewCheckpointStore opens the checkpoints persisted in diskdb and starts the writer,
+// replayers using the store regenerate states from chaindb. The store must be closed.
+func NewCheckpointStore(config *CheckpointConfig, diskdb ethdb.Database, chaindb ethdb.Database) (*CheckpointStore, error) {
+	if err := config.Sanitize(); err != nil {
+		return nil, err
+	}
+	store := &CheckpointStore{
+		config:  config,
+		diskdb:  diskdb,
+		chaindb: chaindb,
+		index:   make(map[common.Hash]*checkpoint),
+		refs:    make(map[common.Hash]int),
+		writeCh: make(chan *checkpointWrite),
+		quitCh:  make(chan struct{}),
+	}
+	store.loadIndex()
+	store.wg.Add(1)
+	go store.writeLoop()
+	log.Info("Loaded state checkpoints", "count", len(store.index), "size", store.size, "interval", config.Interval, "budget", config.MaxSize)
+	return store, nil
+}
+
+// checkpointLayer is the database that state cache of a replayer reads from, it looks
+// up the checkpoints activated by the replayer before falling back to the chain database.
+// Writes are passed through to the chain database.
+type checkpointLayer struct {
+	ethdb.Database
+	store   *CheckpointStore
+	active  map[common.Hash]ethdb.Database // Checkpoints that are currently used as base states
+	retired map[common.Hash]ethdb.Database // Deactivated checkpoints kept readable for pending writes
+	writes  int                            // Number of checkpoint writes pending on states read through the layer
+	mtx     sync.RWMutex
+}
+
+// Activate makes trie nodes of the checkpoint at the given block readable through the
+// layered database. Returns false if there is no such checkpoint or it is already active.
+func (l *checkpointLayer) Activate(blockHash common.Hash) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if _, active := l.active[blockHash]; active {
+		return false
+	}
+	if table, retired := l.retired[blockHash]; retired {
+		delete(l.retired, blockHash)
+		l.active[blockHash] = table
+		return true
+	}
+	table, exist := l.store.acquire(blockHash)
+	if exist {
+		l.active[blockHash] = table
+	}
+	return exist
+}
+
+// Release deactivates the checkpoint at the given block
+func (l *checkpointLayer) Release(blockHash common.Hash) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if table, active := l.active[blockHash]; active {
+		delete(l.active, blockHash)
+		l.retire(blockHash, table)
+	}
+}
+
+// Deactivate releases all checkpoints that are used as base states
+func (l *checkpointLayer) Deactivate() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	for blockHash, table := range l.active {
+		l.retire(blockHash, table)
+	}
+	l.active = make(map[common.Hash]ethdb.Database)
+}
+
+// retire releases a deactivated checkpoint, or keeps it readable until the pending
+// checkpoint writes finished since they may read the state on top of it
+func (l *checkpointLayer) retire(blockHash common.Hash, table ethdb.Database) {
+	if _, retired := l.retired[blockHash]; l.writes > 0 && !retired {
+		l.retired[blockHash] = table
+		return
+	}
+	l.store.release(blockHash)
+}
+
+// beginWrite marks a checkpoint write of a state read through the layer as pending
+func (l *checkpointLayer) beginWrite() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.writes++
+}
+
+// endWrite releases the retired checkpoints once no checkpoint write is pending
+func (l *checkpointLayer) endWrite() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.writes--; l.writes > 0 {
+		return
+	}
+	for blockHash := range l.retired {
+		l.store.release(blockHash)
+	}
+	l.retired = make(map[common.Hash]ethdb.Database)
+}
+
+func (l *checkpointLayer) get(key []byte) ([]byte, bool) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	for _, table := range l.active {
+		if data, err := table.Get(key); err == nil {
+			return data, true
+		}
+	}
+	for _, table := range l.retired {
+		if data, err := table.Get(key); err == nil {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+func (l *checkpointLayer) Has(key []byte) (bool, error) {
+	if _, ok := l.get(key); ok {
+		return true, nil
+	}
+	return l.Database.Has(key)
+}
+
+func (l *checkpointLayer) Get(key []byte) ([]byte, error) {
+	if data, ok := l.get(key); ok {
+		return data, nil
+	}
+	return l.Database.Get(key)
+}
@@ -0,0 +1,120 @@
+package reexec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pruneState deletes all trie nodes from the chain database like the state pruner does
+func pruneState(t *testing.T, db ethdb.Database) {
+	it := db.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		if len(it.Key()) == common.HashLength {
+			require.NoError(t, db.Delete(it.Key()))
+		}
+	}
+}
+
+func TestCheckpointActivation(t *testing.T) {
+	db, chain := newTestChain(t, 4)
+	diskdb := rawdb.NewMemoryDatabase()
+	store, err := NewCheckpointStore(&CheckpointConfig{Interval: 3, MaxSize: DefaultCheckpointConfig.MaxSize}, diskdb, db)
+	require.NoError(t, err)
+
+	// replayed states are checkpointed in the background
+	block := chain.GetBlockByNumber(3)
+	writer := NewChainReplayer(state.NewDatabase(db), chain)
+	writer.SetCheckpoints(store)
+	_, err = writer.ReplayBlock(context.Background(), chain.GetBlockByNumber(2), nil, &testHook{})
+	require.NoError(t, err)
+	_, err = writer.ReplayBlock(context.Background(), block, nil, &testHook{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return store.Has(block.Hash()) }, 10*time.Second, 10*time.Millisecond)
+	assert.False(t, store.Has(chain.GetBlockByNumber(2).Hash()))
+	store.Close()
+
+	// checkpoints hold the whole state, they are opened after the chain state was pruned
+	pruneState(t, db)
+	_, _, err = NewChainReplayer(state.NewDatabase(db), chain).openState(block)
+	require.Error(t, err)
+	store, err = NewCheckpointStore(store.config, diskdb, db)
+	require.NoError(t, err)
+	defer store.Close()
+	replayer := NewChainReplayerWithCheckpoints(store, chain)
+	statedb, err := replayer.StateAtBlock(context.Background(), block)
+	require.NoError(t, err)
+	assert.Equal(t, block.Root(), statedb.IntermediateRoot(true))
+	assert.Empty(t, replayer.triesInMemory)
+	assert.Equal(t, 1, store.refs[block.Hash()])
+
+	// the block after the checkpoint is replayed on top of it
+	hook := &testHook{}
+	_, err = replayer.ReplayBlock(context.Background(), chain.GetBlockByNumber(4), nil, hook)
+	require.NoError(t, err)
+	assert.Len(t, hook.results, 1)
+
+	// the checkpoint is released if the state can not be regenerated from it
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewChainReplayerWithCheckpoints(store, chain).StateAtBlock(ctx, chain.GetBlockByNumber(4))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, store.refs[block.Hash()])
+
+	// deactivated checkpoints stay readable while a checkpoint write reads through the layer
+	layer := replayer.checkpointDB
+	layer.beginWrite()
+	replayer.Reset()
+	assert.Equal(t, 1, store.refs[block.Hash()])
+	_, err = layer.Get(block.Root().Bytes())
+	assert.NoError(t, err)
+	layer.endWrite()
+	assert.Empty(t, store.refs)
+	_, err = layer.Get(block.Root().Bytes())
+	assert.Error(t, err)
+
+	// unused checkpoints are evicted
+	store.config.MaxSize = 1
+	require.True(t, layer.Activate(block.Hash()))
+	store.evict()
+	assert.True(t, store.Has(block.Hash()))
+	layer.Deactivate()
+	store.evict()
+	assert.False(t, store.Has(block.Hash()))
+}
+
+func TestCheckpointIndex(t *testing.T) {
+	db, chain := newTestChain(t, 2)
+	diskdb := rawdb.NewMemoryDatabase()
+	store, err := NewCheckpointStore(&CheckpointConfig{Interval: 2, MaxSize: DefaultCheckpointConfig.MaxSize}, diskdb, db)
+	require.NoError(t, err)
+	block := chain.GetBlockByNumber(2)
+	require.NoError(t, store.Write(block, state.NewDatabase(db)))
+	store.index[block.Hash()].LastUsed = 0
+	store.writeIndex(diskdb)
+	index, _ := diskdb.Get(checkpointIndexKey)
+
+	// using a checkpoint only changes the index in memory until the store is closed
+	_, ok := store.acquire(block.Hash())
+	require.True(t, ok)
+	store.release(block.Hash())
+	persisted, _ := diskdb.Get(checkpointIndexKey)
+	assert.Equal(t, index, persisted)
+	lastUsed := store.index[block.Hash()].LastUsed
+	assert.NotZero(t, lastUsed)
+	store.Close()
+
+	store, err = NewCheckpointStore(store.config, diskdb, db)
+	require.NoError(t, err)
+	defer store.Close()
+	require.True(t, store.Has(block.Hash()))
+	assert.Equal(t, lastUsed, store.index[block.Hash()].LastUsed)
+}
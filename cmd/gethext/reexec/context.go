@@ -3,15 +3,18 @@ package reexec
 import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
 )
 
 type Context struct {
 	block   *types.Block   // The block that chain replayer is executing
 	signer  types.Signer   // Signer used for transaction signature handling
 	state   *state.StateDB // State at the point of replaying the block for the current transaction
+	evm     *vm.EVM        // EVM executing the current transaction
 	results []TxResult     // Results from executing the transactions within the block
 
 	txIndex     int         // Index of the transaction currently being executed within the block
+	txDone      int         // Number of transactions whose results are complete, they are not modified anymore
 	txCallStack []CallFrame // Call stack illustrating the execution flow of the current transaction
 }
 
@@ -30,10 +33,33 @@ func (c *Context) Transaction() (int, *types.Transaction) {
 	return c.txIndex, c.block.Transactions()[c.txIndex]
 }
 
+// State returns the state of the replay, nil if the context is detached
 func (c *Context) State() *state.StateDB {
 	return c.state
 }
 
+// EVM returns the EVM executing the current transaction, nil if the context is detached.
+// It must not be used to run calls which modify the state, see abiutils.StateCaller
+func (c *Context) EVM() *vm.EVM {
+	return c.evm
+}
+
+// Results returns the results of the transactions within the block. A detached context
+// only holds the results of the transactions which completed when it was detached.
 func (c *Context) Results() []TxResult {
 	return c.results
 }
+
+// Detached returns a copy of the context for hooks called after the replay moved on.
+// The state and the EVM of the replay are not available in the copy. Results of completed
+// transactions are shared with the replay since they are not modified anymore.
+func (c *Context) Detached() *Context {
+	return &Context{
+		block:       c.block,
+		signer:      c.signer,
+		results:     c.results[:c.txDone:c.txDone],
+		txIndex:     c.txIndex,
+		txDone:      c.txDone,
+		txCallStack: c.txCallStack,
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"math/big"
 	"sync/atomic"
 
+	"github.com/ethereum/go-ethereum/cmd/gethext/abiutils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -16,7 +17,22 @@ type CallTracerWithHook struct {
 	*Context
 	handler  *callTracer
 	hook     TransactionHook
-	txResult *TxResult // The execution result of the current transaction
+	decoder  *abiutils.CallDecoder // Optional decoder annotates call frames with ABI decoded data
+	txResult *TxResult             // The execution result of the current transaction
+}
+
+func (t *CallTracerWithHook) decodeInput(frame *CallFrame) {
+	if t.decoder == nil || frame.Type == vm.CREATE || frame.Type == vm.CREATE2 || frame.Type == vm.SELFDESTRUCT {
+		return
+	}
+	frame.Decoded = t.decoder.DecodeInput(t.state.GetCodeHash(frame.To), t.state.GetCode(frame.To), frame.Input)
+}
+
+func (t *CallTracerWithHook) decodeOutput(frame *CallFrame) {
+	if frame.Decoded == nil {
+		return
+	}
+	t.decoder.DecodeOutput(t.state.GetCodeHash(frame.To), t.state.GetCode(frame.To), frame.Decoded, frame.Output, frame.Error != nil)
 }
 
 func (t *CallTracerWithHook) CaptureTxStart(gasLimit uint64) {
@@ -28,6 +44,9 @@ func (t *CallTracerWithHook) CaptureTxStart(gasLimit uint64) {
 
 func (t *CallTracerWithHook) CaptureTxEnd(restGas uint64) {
 	t.handler.CaptureTxEnd(restGas)
+	t.txResult.TxIndex = uint64(t.txIndex)
+	t.txResult.CallStack = t.handler.GetCallStack()
+	t.txDone = t.txIndex + 1
 	t.hook.OnTxEnd(t.Context, t.txResult, restGas)
 	if t.txIndex+1 < t.block.Transactions().Len() {
 		t.txIndex += 1
@@ -35,11 +54,14 @@ func (t *CallTracerWithHook) CaptureTxEnd(restGas uint64) {
 }
 
 func (t *CallTracerWithHook) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.evm = env
 	t.handler.CaptureStart(env, from, to, create, input, gas, value)
+	t.decodeInput(&t.handler.callstack[0])
 }
 
 func (t *CallTracerWithHook) CaptureEnd(output []byte, gasUsed uint64, err error) {
 	t.handler.CaptureEnd(output, gasUsed, err)
+	t.decodeOutput(&t.handler.callstack[0])
 	if err != nil {
 		t.txResult.Reverted = true
 	}
@@ -50,13 +72,22 @@ func (t *CallTracerWithHook) CaptureEnter(typ vm.OpCode, from common.Address, to
 	if atomic.LoadUint32(&t.handler.interrupt) > 0 {
 		return
 	}
+	t.decodeInput(&t.handler.callstack[len(t.handler.callstack)-1])
 	frame := t.handler.callstack[len(t.handler.callstack)-1]
 	t.hook.OnCallEnter(t.Context, &frame)
 }
 
 func (t *CallTracerWithHook) CaptureExit(output []byte, gasUsed uint64, err error) {
-	frame := t.handler.callstack[len(t.handler.callstack)-1]
+	size := len(t.handler.callstack)
+	frame := t.handler.callstack[size-1]
 	t.handler.CaptureExit(output, gasUsed, err)
+	if size > 1 {
+		// the exited frame was popped and appended to its parent with the call results
+		parent := &t.handler.callstack[size-2]
+		exited := &parent.Calls[len(parent.Calls)-1]
+		t.decodeOutput(exited)
+		frame = *exited
+	}
 	t.hook.OnCallExit(t.Context, &frame)
 }
 
@@ -78,6 +109,10 @@ func (t *CallTracerWithHook) Stop(err error) {
 }
 
 func NewCallTracerWithHook(block *types.Block, signer types.Signer, state *state.StateDB, hook TransactionHook) tracers.Tracer {
+	return newCallTracerWithHook(block, signer, state, hook)
+}
+
+func newCallTracerWithHook(block *types.Block, signer types.Signer, state *state.StateDB, hook TransactionHook) *CallTracerWithHook {
 	return &CallTracerWithHook{
 		Context: &Context{
 			block:   block,
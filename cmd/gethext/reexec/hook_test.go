@@ -0,0 +1,102 @@
+package reexec
+
+import (
+	"encoding/hex"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/cmd/gethext/abiutils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testHook records the results of the transactions passed to the hook
+type testHook struct {
+	results []*TxResult
+}
+
+func (h *testHook) OnTxStart(ctx *Context, gasLimit uint64) {}
+
+func (h *testHook) OnCallEnter(ctx *Context, call *CallFrame) {}
+
+func (h *testHook) OnCallExit(ctx *Context, call *CallFrame) {}
+
+func (h *testHook) OnTxEnd(ctx *Context, ret *TxResult, restGas uint64) {
+	h.results = append(h.results, ret)
+}
+
+func TestCallTracerWithHookDecodeRootFrame(t *testing.T) {
+	data, err := os.ReadFile("../abiutils/tests/erc20.bin")
+	require.NoError(t, err)
+	code, err := hex.DecodeString(string(data))
+	require.NoError(t, err)
+
+	var (
+		token    = common.HexToAddress("0x55d398326f99059fF775485246999027B3197955")
+		from     = common.HexToAddress("0x64108bbDe14CC327EBba159e1937A9791Ce0e8a9")
+		to       = common.HexToAddress("0xA73BC58956dC002Ab777452aa0b60d37B4f6d637")
+		input, _ = hex.DecodeString("a9059cbb000000000000000000000000a73bc58956dc002ab777452aa0b60d37b4f6d6370000000000000000000000000000000000000000000000000de0b6b3a7640000")
+	)
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	require.NoError(t, err)
+	statedb.SetCode(token, code)
+
+	tx := types.NewTransaction(0, token, new(big.Int), 100000, new(big.Int), input)
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1)}, []*types.Transaction{tx}, nil, nil, trie.NewStackTrie(nil))
+	hook := &testHook{}
+	tracer := newCallTracerWithHook(block, types.HomesteadSigner{}, statedb, hook)
+	tracer.decoder = abiutils.NewCallDecoder(abiutils.NewParser(rawdb.NewMemoryDatabase()))
+
+	// the transaction calls the token directly, so the call is only traced as the root frame
+	tracer.CaptureTxStart(tx.Gas())
+	tracer.CaptureStart(nil, from, token, false, input, tx.Gas(), tx.Value())
+	tracer.CaptureEnd(common.LeftPadBytes([]byte{1}, 32), 30000, nil)
+	tracer.CaptureTxEnd(tx.Gas() - 30000)
+
+	require.Len(t, hook.results, 1)
+	require.Len(t, hook.results[0].CallStack, 1)
+	root := hook.results[0].CallStack[0]
+	require.NotNil(t, root.Decoded)
+	assert.Equal(t, "transfer(address,uint256)", root.Decoded.Signature)
+	assert.Equal(t, to, root.Decoded.Inputs["to"])
+	assert.Equal(t, true, root.Decoded.Outputs["arg0"])
+	assert.False(t, hook.results[0].Reverted)
+}
+
+func TestContextDetached(t *testing.T) {
+	var (
+		from = common.Address{0x01}
+		to   = common.Address{0x02}
+		txs  = []*types.Transaction{
+			types.NewTransaction(0, to, new(big.Int), 21000, new(big.Int), nil),
+			types.NewTransaction(1, to, new(big.Int), 21000, new(big.Int), nil),
+		}
+	)
+	block := types.NewBlock(&types.Header{Number: big.NewInt(1)}, txs, nil, nil, trie.NewStackTrie(nil))
+	tracer := newCallTracerWithHook(block, types.HomesteadSigner{}, nil, &testHook{})
+	replayTx := func(tx *types.Transaction) {
+		tracer.CaptureTxStart(tx.Gas())
+		tracer.CaptureStart(nil, from, to, false, nil, tx.Gas(), tx.Value())
+		tracer.CaptureEnd(nil, 0, nil)
+		tracer.CaptureTxEnd(0)
+	}
+
+	// detached contexts share the results of the completed transactions only
+	assert.Empty(t, tracer.Detached().Results())
+	replayTx(txs[0])
+	detached := tracer.Detached()
+	require.Len(t, detached.Results(), 1)
+	assert.Same(t, &tracer.results[0], &detached.Results()[0])
+	assert.Nil(t, detached.State())
+
+	replayTx(txs[1])
+	assert.Len(t, detached.Results(), 1)
+	assert.Len(t, tracer.Detached().Results(), 2)
+	assert.Equal(t, uint64(1), tracer.Detached().Results()[1].TxIndex)
+}
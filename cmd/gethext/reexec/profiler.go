@@ -0,0 +1,356 @@
+package reexec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+const (
+	defaultProfileWindow    = 1200 // About one hour of BSC blocks
+	defaultProfileRetention = 168  // Number of windows kept, about one week of default windows
+
+	truncatedStack = "[truncated]" // Call stacks beyond the limit of a profile are folded into this one
+)
+
+var profileStacksLimit = 100000 // Maximum number of distinct call stacks of a profile
+
+// gasProfileKey identifies a contract method that gas is attributed to
+type gasProfileKey struct {
+	Contract common.Address
+	Selector string
+}
+
+// GasProfileEntry is the gas usage attributed to a contract method
+type GasProfileEntry struct {
+	Contract  common.Address `json:"contract"`
+	Selector  string         `json:"selector"`            // Hex encoded 4-byte selector, "fallback" for calls without selector or "constructor" for contract creations
+	Signature string         `json:"signature,omitempty"` // Method signature if the call was decoded
+	Calls     uint64         `json:"calls"`               // Number of calls to the method
+	Inclusive uint64         `json:"inclusive"`           // Gas used by the method including nested calls
+	Exclusive uint64         `json:"exclusive"`           // Gas used by the method itself, excluding nested calls
+}
+
+// GasProfile is the gas usage aggregated over a block range
+type GasProfile struct {
+	From    uint64             `json:"from"`
+	To      uint64             `json:"to"`
+	Blocks  uint64             `json:"blocks"` // Number of profiled blocks within the range
+	Entries []*GasProfileEntry `json:"entries"`
+
+	stacks map[string]uint64 // Folded call stack to exclusive gas
+}
+
+// WriteJSON writes the profile entries as JSON, entries are sorted by inclusive gas
+func (p *GasProfile) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// WriteFolded writes the profile in folded stack format which is accepted by
+// flamegraph tools, each line is a semicolon separated call stack followed by
+// the exclusive gas used by the last frame.
+func (p *GasProfile) WriteFolded(w io.Writer) error {
+	stacks := make([]string, 0, len(p.stacks))
+	for stack := range p.stacks {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(w, "%s %d\n", stack, p.stacks[stack]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gasProfileData accumulates gas usage of a block or a block range
+type gasProfileData struct {
+	from, to uint64
+	blocks   uint64
+	entries  map[gasProfileKey]*GasProfileEntry
+	stacks   map[string]uint64
+}
+
+func (d *gasProfileData) entry(key gasProfileKey, signature string) *GasProfileEntry {
+	entry, exist := d.entries[key]
+	if !exist {
+		entry = &GasProfileEntry{Contract: key.Contract, Selector: key.Selector}
+		d.entries[key] = entry
+	}
+	if entry.Signature == "" {
+		entry.Signature = signature
+	}
+	return entry
+}
+
+// addFrame attributes gas used by the call frame and its nested calls. Inclusive
+// gas of recursive calls is only counted at the outermost frame of the method.
+func (d *gasProfileData) addFrame(frame *CallFrame, stack []string, onPath map[gasProfileKey]int) {
+	key, signature := frameProfileKey(frame)
+	label := frameLabel(key, signature)
+	stack = append(stack, label)
+
+	entry := d.entry(key, signature)
+	entry.Calls += 1
+	if onPath[key] == 0 {
+		entry.Inclusive += frame.GasUsed
+	}
+	onPath[key] += 1
+
+	exclusive := frame.GasUsed
+	for idx := range frame.Calls {
+		child := &frame.Calls[idx]
+		if child.GasUsed < exclusive {
+			exclusive -= child.GasUsed
+		} else {
+			exclusive = 0
+		}
+		d.addFrame(child, stack, onPath)
+	}
+	onPath[key] -= 1
+
+	entry.Exclusive += exclusive
+	if exclusive > 0 {
+		d.addStack(strings.Join(stack, ";"), exclusive)
+	}
+}
+
+// addStack adds gas to the folded call stack, new stacks are counted as truncated once
+// the profile holds profileStacksLimit stacks
+func (d *gasProfileData) addStack(stack string, gas uint64) {
+	if _, exist := d.stacks[stack]; !exist && len(d.stacks) >= profileStacksLimit {
+		stack = truncatedStack
+	}
+	d.stacks[stack] += gas
+}
+
+func (d *gasProfileData) merge(other *gasProfileData) {
+	if d.blocks == 0 {
+		d.from, d.to = other.from, other.to
+	}
+	if other.from < d.from {
+		d.from = other.from
+	}
+	if other.to > d.to {
+		d.to = other.to
+	}
+	d.blocks += other.blocks
+	for key, src := range other.entries {
+		entry := d.entry(key, src.Signature)
+		entry.Calls += src.Calls
+		entry.Inclusive += src.Inclusive
+		entry.Exclusive += src.Exclusive
+	}
+	for stack, gas := range other.stacks {
+		d.addStack(stack, gas)
+	}
+}
+
+func (d *gasProfileData) profile() *GasProfile {
+	ret := &GasProfile{
+		From:    d.from,
+		To:      d.to,
+		Blocks:  d.blocks,
+		Entries: make([]*GasProfileEntry, 0, len(d.entries)),
+		stacks:  make(map[string]uint64, len(d.stacks)),
+	}
+	for _, entry := range d.entries {
+		copied := *entry
+		ret.Entries = append(ret.Entries, &copied)
+	}
+	sort.Slice(ret.Entries, func(i, j int) bool {
+		if ret.Entries[i].Inclusive != ret.Entries[j].Inclusive {
+			return ret.Entries[i].Inclusive > ret.Entries[j].Inclusive
+		}
+		return ret.Entries[i].Exclusive > ret.Entries[j].Exclusive
+	})
+	for stack, gas := range d.stacks {
+		ret.stacks[stack] = gas
+	}
+	return ret
+}
+
+func newGasProfileData(from, to uint64) *gasProfileData {
+	return &gasProfileData{
+		from:    from,
+		to:      to,
+		entries: make(map[gasProfileKey]*GasProfileEntry),
+		stacks:  make(map[string]uint64),
+	}
+}
+
+func frameProfileKey(frame *CallFrame) (gasProfileKey, string) {
+	key := gasProfileKey{Contract: frame.To}
+	switch {
+	case frame.Type == vm.CREATE || frame.Type == vm.CREATE2:
+		key.Selector = "constructor"
+	case len(frame.Input) < 4:
+		key.Selector = "fallback"
+	default:
+		key.Selector = bytesToHex(frame.Input[:4])
+	}
+	var signature string
+	if frame.Decoded != nil {
+		signature = frame.Decoded.Signature
+	}
+	return key, signature
+}
+
+func frameLabel(key gasProfileKey, signature string) string {
+	if signature != "" {
+		return addrToHex(key.Contract) + ":" + signature
+	}
+	return addrToHex(key.Contract) + ":" + key.Selector
+}
+
+// GasProfiler is a transaction hook that attributes gas used by replayed
+// transactions to the called contract methods. Gas usage is aggregated into
+// windows of consecutive blocks, only committed blocks are counted. Only the
+// most recent windows are kept.
+type GasProfiler struct {
+	window       uint64
+	retention    int                        // Maximum number of windows kept
+	ranges       map[uint64]*gasProfileData // Start block of the window to the aggregated data
+	pending      *gasProfileData            // Data of the block being replayed
+	pendingBlock common.Hash
+	txGasLimit   uint64 // Gas limit of the transaction being replayed
+	mtx          sync.Mutex
+}
+
+func (p *GasProfiler) OnTxStart(ctx *Context, gasLimit uint64) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	block := ctx.Block()
+	if p.pending == nil || p.pendingBlock != block.Hash() {
+		p.pending = newGasProfileData(block.NumberU64(), block.NumberU64())
+		p.pendingBlock = block.Hash()
+	}
+	p.txGasLimit = gasLimit
+}
+
+func (p *GasProfiler) OnCallEnter(ctx *Context, call *CallFrame) {
+}
+
+func (p *GasProfiler) OnCallExit(ctx *Context, call *CallFrame) {
+}
+
+func (p *GasProfiler) OnTxEnd(ctx *Context, ret *TxResult, restGas uint64) {
+	if len(ret.CallStack) == 0 {
+		return
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.pending != nil {
+		// the root frame is charged with the gas used by the transaction, including intrinsic gas
+		root := ret.CallStack[0]
+		if used := p.txGasLimit - restGas; restGas <= p.txGasLimit && used > root.GasUsed {
+			root.GasUsed = used
+		}
+		p.pending.addFrame(&root, nil, make(map[gasProfileKey]int))
+	}
+}
+
+func (p *GasProfiler) OnBlockCommit(ctx *Context) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	block := ctx.Block()
+	if p.pending == nil || p.pendingBlock != block.Hash() {
+		// block without transactions
+		p.pending = newGasProfileData(block.NumberU64(), block.NumberU64())
+	}
+	p.pending.blocks = 1
+	start := block.NumberU64() / p.window * p.window
+	data, exist := p.ranges[start]
+	if !exist {
+		data = newGasProfileData(start, start+p.window-1)
+		p.ranges[start] = data
+		p.evict()
+	}
+	data.merge(p.pending)
+	data.from, data.to = start, start+p.window-1
+	p.pending = nil
+	p.pendingBlock = common.Hash{}
+}
+
+func (p *GasProfiler) OnBlockDiscard(ctx *Context, report *DivergenceReport) {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.pending = nil
+	p.pendingBlock = common.Hash{}
+}
+
+// evict drops the oldest windows exceeding the retention
+func (p *GasProfiler) evict() {
+	if len(p.ranges) <= p.retention {
+		return
+	}
+	starts := make([]uint64, 0, len(p.ranges))
+	for start := range p.ranges {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	for _, start := range starts[:len(starts)-p.retention] {
+		delete(p.ranges, start)
+	}
+}
+
+// Profiles returns the aggregated gas profile of every profiled block window, ordered by block number
+func (p *GasProfiler) Profiles() []*GasProfile {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	ret := make([]*GasProfile, 0, len(p.ranges))
+	for _, data := range p.ranges {
+		ret = append(ret, data.profile())
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].From < ret[j].From })
+	return ret
+}
+
+// Profile returns the gas profile aggregated over all windows overlapping the given block
+// range, the profile spans the merged windows which may extend beyond the range. If no
+// window overlaps the range, the profile of the range has no blocks.
+func (p *GasProfiler) Profile(from, to uint64) *GasProfile {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	total := newGasProfileData(from, to)
+	for start, data := range p.ranges {
+		if start <= to && data.to >= from {
+			total.merge(data)
+		}
+	}
+	return total.profile()
+}
+
+// Reset drops all collected data
+func (p *GasProfiler) Reset() {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.ranges = make(map[uint64]*gasProfileData)
+	p.pending = nil
+	p.pendingBlock = common.Hash{}
+}
+
+// NewGasProfiler creates a gas profiler aggregating gas usage into windows of
+// `window` blocks and keeping the last `retention` windows, defaults are used
+// if zero is given
+func NewGasProfiler(window uint64, retention int) *GasProfiler {
+	if window == 0 {
+		window = defaultProfileWindow
+	}
+	if retention <= 0 {
+		retention = defaultProfileRetention
+	}
+	return &GasProfiler{
+		window:    window,
+		retention: retention,
+		ranges:    make(map[uint64]*gasProfileData),
+	}
+}
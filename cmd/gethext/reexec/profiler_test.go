@@ -0,0 +1,131 @@
+package reexec
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	profiledA = common.Address{0xaa}
+	profiledB = common.Address{0xbb}
+)
+
+// profiledTx returns the call stack of a transaction calling A, which calls B that
+// calls back into A, then calls the fallback of B
+func profiledTx() *TxResult {
+	return &TxResult{CallStack: []CallFrame{{
+		To: profiledA, Input: common.FromHex("0x11111111"), GasUsed: 100,
+		Calls: []CallFrame{
+			{To: profiledB, Input: common.FromHex("0x22222222"), GasUsed: 30, Calls: []CallFrame{
+				{To: profiledA, Input: common.FromHex("0x11111111"), GasUsed: 10},
+			}},
+			{To: profiledB, GasUsed: 20},
+		},
+	}}}
+}
+
+func profileBlock(profiler *GasProfiler, number int64, commit bool) {
+	ctx := &Context{block: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(number)})}
+	profiler.OnTxStart(ctx, 0)
+	profiler.OnTxEnd(ctx, profiledTx(), 0)
+	if commit {
+		profiler.OnBlockCommit(ctx)
+	} else {
+		profiler.OnBlockDiscard(ctx, &DivergenceReport{})
+	}
+}
+
+func TestGasProfiler(t *testing.T) {
+	profiler := NewGasProfiler(10, 0)
+	profileBlock(profiler, 1, true)
+	profileBlock(profiler, 2, false)
+	profileBlock(profiler, 12, true)
+
+	// discarded blocks are not counted, blocks are aggregated per window
+	profiles := profiler.Profiles()
+	require.Len(t, profiles, 2)
+	assert.Equal(t, []uint64{0, 9, 1}, []uint64{profiles[0].From, profiles[0].To, profiles[0].Blocks})
+	assert.Equal(t, []uint64{10, 19, 1}, []uint64{profiles[1].From, profiles[1].To, profiles[1].Blocks})
+
+	// recursive calls only count the inclusive gas of the outermost frame
+	profile := profiler.Profile(0, 9)
+	assert.Equal(t, []*GasProfileEntry{
+		{Contract: profiledA, Selector: "0x11111111", Calls: 2, Inclusive: 100, Exclusive: 60},
+		{Contract: profiledB, Selector: "0x22222222", Calls: 1, Inclusive: 30, Exclusive: 20},
+		{Contract: profiledB, Selector: "fallback", Calls: 1, Inclusive: 20, Exclusive: 20},
+	}, profile.Entries)
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, profile.WriteJSON(buf))
+	var decoded GasProfile
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, profile.Entries, decoded.Entries)
+
+	var (
+		a = strings.ToLower(profiledA.Hex()) + ":0x11111111"
+		b = strings.ToLower(profiledB.Hex()) + ":0x22222222"
+	)
+	buf.Reset()
+	require.NoError(t, profile.WriteFolded(buf))
+	assert.Equal(t, strings.Join([]string{
+		a + " 50",
+		a + ";" + b + " 20",
+		a + ";" + b + ";" + a + " 10",
+		a + ";" + strings.ToLower(profiledB.Hex()) + ":fallback 20",
+	}, "\n")+"\n", buf.String())
+
+	// profiles of ranges are merged from all overlapping windows and span them
+	profile = profiler.Profile(5, 15)
+	assert.Equal(t, []uint64{0, 19, 2}, []uint64{profile.From, profile.To, profile.Blocks})
+	assert.Equal(t, uint64(200), profile.Entries[0].Inclusive)
+	profile = profiler.Profile(30, 40)
+	assert.Equal(t, []uint64{30, 40, 0}, []uint64{profile.From, profile.To, profile.Blocks})
+
+	profiler.Reset()
+	assert.Empty(t, profiler.Profiles())
+}
+
+func TestGasProfilerLimits(t *testing.T) {
+	// only the most recent windows are kept
+	profiler := NewGasProfiler(10, 2)
+	profileBlock(profiler, 1, true)
+	profileBlock(profiler, 12, true)
+	profileBlock(profiler, 25, true)
+	profiles := profiler.Profiles()
+	require.Len(t, profiles, 2)
+	assert.Equal(t, []uint64{10, 20}, []uint64{profiles[0].From, profiles[1].From})
+	profile := profiler.Profile(0, 9)
+	assert.Equal(t, []uint64{0, 9, 0}, []uint64{profile.From, profile.To, profile.Blocks})
+
+	// call stacks beyond the limit are folded together
+	defer func(limit int) { profileStacksLimit = limit }(profileStacksLimit)
+	profileStacksLimit = 2
+	profiler.Reset()
+	profileBlock(profiler, 1, true)
+	buf := new(bytes.Buffer)
+	require.NoError(t, profiler.Profile(0, 9).WriteFolded(buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.LessOrEqual(t, len(lines), 3)
+	var (
+		total     uint64
+		truncated bool
+	)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		gas, err := strconv.ParseUint(fields[1], 10, 64)
+		require.NoError(t, err)
+		total += gas
+		truncated = truncated || fields[0] == truncatedStack
+	}
+	assert.True(t, truncated)
+	assert.Equal(t, uint64(100), total)
+}
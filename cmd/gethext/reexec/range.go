@@ -0,0 +1,117 @@
+package reexec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	defaultRangeTriesInMemory    = 128
+	defaultRangeProgressInterval = 8 * time.Second
+)
+
+// ReplayProgress reports the progress of replaying a block range
+type ReplayProgress struct {
+	From     uint64        `json:"from"`     // First block of the range
+	To       uint64        `json:"to"`       // Last block of the range
+	Current  uint64        `json:"current"`  // Last replayed block
+	Replayed uint64        `json:"replayed"` // Number of replayed blocks
+	Speed    float64       `json:"speed"`    // Average replayed blocks per second
+	Elapsed  time.Duration `json:"elapsed"`  // Time since the replay started
+	ETA      time.Duration `json:"eta"`      // Estimated time to replay the remaining blocks
+}
+
+// ReplayRangeOptions controls the behavior of ChainReplayer.ReplayRange
+type ReplayRangeOptions struct {
+	TriesInMemory    int                   // Number of replayed block tries kept in memory, older ones are dereferenced
+	ProgressInterval time.Duration         // Minimum interval between two progress reports
+	OnProgress       func(ReplayProgress)  // Optional callback receives progress reports
+	ProgressCh       chan<- ReplayProgress // Optional channel receives progress reports, reports are dropped if the channel is full
+}
+
+func (opts *ReplayRangeOptions) sanitize() *ReplayRangeOptions {
+	ret := ReplayRangeOptions{}
+	if opts != nil {
+		ret = *opts
+	}
+	if ret.TriesInMemory <= 0 {
+		ret.TriesInMemory = defaultRangeTriesInMemory
+	}
+	if ret.ProgressInterval <= 0 {
+		ret.ProgressInterval = defaultRangeProgressInterval
+	}
+	return &ret
+}
+
+func (opts *ReplayRangeOptions) report(progress ReplayProgress) {
+	if opts.OnProgress != nil {
+		opts.OnProgress(progress)
+	}
+	if opts.ProgressCh != nil {
+		select {
+		case opts.ProgressCh <- progress:
+		default:
+		}
+	}
+}
+
+// ReplayRange re-executes all blocks from `from` to `to` inclusively. The output state of
+// each block is used as the base state of the next one, in-memory tries are capped as the
+// replay goes. Returns the state after the last block was replayed.
+func (re *ChainReplayer) ReplayRange(ctx context.Context, from, to uint64, hook TransactionHook, opts *ReplayRangeOptions) (*state.StateDB, error) {
+	if from == 0 {
+		return nil, errors.New("cannot replay genesis block")
+	}
+	if from > to {
+		return nil, fmt.Errorf("invalid block range [%d,%d]", from, to)
+	}
+	opts = opts.sanitize()
+
+	var (
+		statedb  *state.StateDB
+		err      error
+		start    = time.Now()
+		reported = time.Now()
+		progress = ReplayProgress{From: from, To: to}
+	)
+	updateProgress := func(current uint64) {
+		progress.Current = current
+		progress.Replayed = current - from + 1
+		progress.Elapsed = time.Since(start)
+		progress.Speed = float64(progress.Replayed) / progress.Elapsed.Seconds()
+		if progress.Speed > 0 {
+			progress.ETA = time.Duration(float64(to-current) / progress.Speed * float64(time.Second))
+		}
+	}
+	for number := from; number <= to; number++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		block := re.blockchain.GetBlockByNumber(number)
+		if block == nil {
+			return nil, fmt.Errorf("block #%d not found", number)
+		}
+		statedb, err = re.ReplayBlock(ctx, block, statedb, hook)
+		if err != nil {
+			return nil, fmt.Errorf("replay block #%d failed: %w", number, err)
+		}
+		re.CapTrieDB(opts.TriesInMemory)
+
+		updateProgress(number)
+		if time.Since(reported) > opts.ProgressInterval {
+			log.Info("Replaying block range", "current", number, "to", to, "speed", fmt.Sprintf("%.2f blocks/s", progress.Speed), "eta", common.PrettyDuration(progress.ETA))
+			opts.report(progress)
+			reported = time.Now()
+		}
+	}
+	opts.report(progress)
+	return statedb, nil
+}
@@ -0,0 +1,88 @@
+package reexec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayRange(t *testing.T) {
+	db, chain := newTestChain(t, 4)
+	replayer := NewChainReplayer(state.NewDatabase(db), chain)
+
+	var reports []ReplayProgress
+	progressCh := make(chan ReplayProgress, 1)
+	hook := &testBlockHook{}
+	statedb, err := replayer.ReplayRange(context.Background(), 1, 4, hook, &ReplayRangeOptions{
+		TriesInMemory:    2,
+		ProgressInterval: time.Nanosecond,
+		OnProgress:       func(progress ReplayProgress) { reports = append(reports, progress) },
+		ProgressCh:       progressCh,
+	})
+	require.NoError(t, err)
+
+	// every block is replayed on top of the output state of the previous one
+	assert.Equal(t, chain.GetBlockByNumber(4).Root(), statedb.IntermediateRoot(true))
+	assert.Equal(t, []uint64{1, 2, 3, 4}, hook.committed)
+	assert.Len(t, hook.results, 4)
+	assert.Len(t, replayer.triesInMemory, 2)
+
+	// every block is reported, then the final progress once more
+	require.Len(t, reports, 5)
+	for idx, progress := range reports[:4] {
+		assert.Equal(t, uint64(idx+1), progress.Current)
+		assert.Equal(t, uint64(idx+1), progress.Replayed)
+	}
+	last := reports[4]
+	assert.Equal(t, []uint64{1, 4, 4, 4}, []uint64{last.From, last.To, last.Current, last.Replayed})
+	assert.Zero(t, last.ETA)
+	assert.Positive(t, last.Speed)
+
+	// reports are dropped instead of blocking if the channel is full
+	assert.Equal(t, reports[0], <-progressCh)
+	assert.Empty(t, progressCh)
+}
+
+func TestReplayRangeErrors(t *testing.T) {
+	db, chain := newTestChain(t, 2)
+	replayer := NewChainReplayer(state.NewDatabase(db), chain)
+
+	_, err := replayer.ReplayRange(context.Background(), 0, 2, &testHook{}, nil)
+	assert.EqualError(t, err, "cannot replay genesis block")
+	_, err = replayer.ReplayRange(context.Background(), 2, 1, &testHook{}, nil)
+	assert.EqualError(t, err, "invalid block range [2,1]")
+
+	// the range stops at the first block which is not available
+	hook := &testBlockHook{}
+	_, err = replayer.ReplayRange(context.Background(), 1, 3, hook, nil)
+	assert.EqualError(t, err, "block #3 not found")
+	assert.Equal(t, []uint64{1, 2}, hook.committed)
+
+	replayer.SetVerify(true)
+	_, err = replayer.ReplayRange(context.Background(), 1, 2, &testHook{}, nil)
+	assert.ErrorIs(t, err, ErrBlockHookRequired)
+	assert.ErrorContains(t, err, "replay block #1 failed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	hook = &testBlockHook{}
+	_, err = replayer.ReplayRange(ctx, 1, 2, hook, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, hook.committed)
+}
+
+func TestReplayRangeOptionsDefaults(t *testing.T) {
+	var opts *ReplayRangeOptions
+	sanitized := opts.sanitize()
+	assert.Equal(t, defaultRangeTriesInMemory, sanitized.TriesInMemory)
+	assert.Equal(t, defaultRangeProgressInterval, sanitized.ProgressInterval)
+
+	opts = &ReplayRangeOptions{TriesInMemory: 4}
+	sanitized = opts.sanitize()
+	assert.Equal(t, 4, sanitized.TriesInMemory)
+	assert.NotSame(t, opts, sanitized)
+}
@@ -13,6 +13,7 @@ import (
 	"math/big"
 	"time"
 
+	"github.com/ethereum/go-ethereum/cmd/gethext/abiutils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/consensus"
@@ -20,16 +21,29 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/trie"
 )
 
+const checkpointTrieCache = 256 // Memory allowance (MB) for trie nodes cache of the checkpointed state cache
+
+// ErrBlockHookRequired is returned if a block is replayed with verification enabled by
+// a hook which can not be told whether the block diverged
+var ErrBlockHookRequired = errors.New("hook must implement BlockHook to replay verified blocks")
+
 type ChainReplayer struct {
-	stateCache    state.Database   // Isolated memory state cache for chain re-execution
-	blockchain    *core.BlockChain // Ethereum blockchain provide blocks to be replayed
-	processor     core.Processor   // State processor for replaying blockchain
-	triesInMemory []common.Hash    // Keep track of which tries that still alive in memory
-	maxReExec     uint64           // Max re-execution blocks to regenerate statedb
+	stateCache    state.Database        // Isolated memory state cache for chain re-execution
+	blockchain    *core.BlockChain      // Ethereum blockchain provide blocks to be replayed
+	processor     core.Processor        // State processor for replaying blockchain
+	triesInMemory []common.Hash         // Keep track of which tries that still alive in memory
+	maxReExec     uint64                // Max re-execution blocks to regenerate statedb
+	checkpoints   *CheckpointStore      // Store replayed states are persisted to, nil if checkpointing is disabled
+	checkpointDB  *checkpointLayer      // Database of the state cache reading activated checkpoints, nil if not layered
+	verify        bool                  // Compare replayed blocks with the canonical blocks
+	divergeFeed   event.Feed            // Feed of divergence reports of replayed blocks
+	decoder       *abiutils.CallDecoder // Optional decoder annotates call frames passed to hooks
 }
 
 func (re *ChainReplayer) StateCache() state.Database {
@@ -40,6 +54,32 @@ func (re *ChainReplayer) SetReExecBlocks(maxReExec uint64) {
 	re.maxReExec = maxReExec
 }
 
+// SetVerify enables comparing state root, receipts root, gas used and logs bloom of
+// every replayed block with the canonical block. Transaction hooks are called while the
+// block is replayed, before it is verified, so the hook of a verified replay must be a
+// BlockHook and only commit its results in OnBlockCommit
+func (re *ChainReplayer) SetVerify(verify bool) {
+	re.verify = verify
+}
+
+// SetCallDecoder enables annotating call frames passed to hooks with ABI decoded data,
+// pass nil to disable decoding
+func (re *ChainReplayer) SetCallDecoder(decoder *abiutils.CallDecoder) {
+	re.decoder = decoder
+}
+
+// SubscribeDivergence subscribes to reports of replayed blocks which diverged from the canonical chain
+func (re *ChainReplayer) SubscribeDivergence(ch chan<- *DivergenceReport) event.Subscription {
+	return re.divergeFeed.Subscribe(ch)
+}
+
+// SetCheckpoints persists replayed states to the store every checkpoint interval, so
+// that replayers created by NewChainReplayerWithCheckpoints can start from them. The
+// state cache of the replayer is not layered on the store
+func (re *ChainReplayer) SetCheckpoints(store *CheckpointStore) {
+	re.checkpoints = store
+}
+
 func (re *ChainReplayer) CapTrieDB(limit int) {
 	if len(re.triesInMemory) > limit {
 		capOffset := len(re.triesInMemory) - limit
@@ -54,16 +94,54 @@ func (re *ChainReplayer) CapTrieDB(limit int) {
 func (re *ChainReplayer) Reset() {
 	re.triesInMemory = make([]common.Hash, 0)
 	re.stateCache.Purge()
+	if re.checkpointDB != nil {
+		re.checkpointDB.Deactivate()
+	}
+}
+
+// openState opens the state of the given block, making the block's checkpoint
+// available to the state cache if there is one. Returns whether the checkpoint was
+// activated, it is released again if the state can not be opened from it
+func (re *ChainReplayer) openState(block *types.Block) (*state.StateDB, bool, error) {
+	activated := re.checkpointDB != nil && re.checkpointDB.Activate(block.Hash())
+	statedb, err := state.New(block.Root(), re.stateCache, nil)
+	if activated {
+		if err != nil {
+			re.checkpointDB.Release(block.Hash())
+			return nil, false, err
+		}
+		log.Debug("Using state checkpoint", "number", block.NumberU64(), "hash", block.Hash())
+	}
+	return statedb, activated, err
+}
+
+// writeCheckpoint hands the state of the given block over to the checkpoint writer if
+// it is at a checkpoint interval
+func (re *ChainReplayer) writeCheckpoint(block *types.Block) {
+	if re.checkpoints == nil || re.checkpoints.config.Interval == 0 || block.NumberU64()%re.checkpoints.config.Interval != 0 {
+		return
+	}
+	var done func()
+	if re.checkpointDB != nil {
+		re.checkpointDB.beginWrite()
+		done = re.checkpointDB.endWrite
+	}
+	if !re.checkpoints.schedule(block, re.stateCache, done) {
+		if done != nil {
+			done()
+		}
+		log.Debug("Skipped state checkpoint", "number", block.NumberU64())
+	}
 }
 
 // StateAtBlock returns statedb after all transactions in block was executed
 func (re *ChainReplayer) StateAtBlock(ctx context.Context, block *types.Block) (statedb *state.StateDB, err error) {
-	statedb, err = state.New(block.Root(), re.stateCache, nil)
+	statedb, _, err = re.openState(block)
 	if err == nil {
 		return statedb, nil
 	}
 	// State was available at historical point, regenerate
-	// retrieve nearest historical state snapshot
+	// retrieve nearest historical state snapshot or checkpoint
 	current := block
 	for i := uint64(0); i < re.maxReExec; i++ {
 		if current.NumberU64() == 0 {
@@ -74,8 +152,16 @@ func (re *ChainReplayer) StateAtBlock(ctx context.Context, block *types.Block) (
 			return nil, fmt.Errorf("missing block %#x %d", current.ParentHash(), current.NumberU64()-1)
 		}
 		current = parent
-		statedb, err = state.New(parent.Root(), re.stateCache, nil)
-		if err == nil {
+		var activated bool
+		if statedb, activated, err = re.openState(parent); err == nil {
+			// the checkpoint is not used if the state can not be regenerated from it
+			if activated {
+				defer func() {
+					if err != nil {
+						re.checkpointDB.Release(parent.Hash())
+					}
+				}()
+			}
 			break
 		}
 	}
@@ -125,6 +211,7 @@ func (re *ChainReplayer) StateAtBlock(ctx context.Context, block *types.Block) (
 			return nil, fmt.Errorf("commit state failed: %v", err)
 		}
 		re.triesInMemory = append(re.triesInMemory, root)
+		re.writeCheckpoint(current)
 	}
 	nodes, imgs := re.stateCache.TrieDB().Size()
 	log.Info("Historical state regenerated", "block", current.NumberU64(), "elapsed", time.Since(start), "nodes", nodes, "preimages", imgs)
@@ -187,6 +274,10 @@ func (re *ChainReplayer) ReplayBlock(ctx context.Context, block *types.Block, ba
 	if block.NumberU64() == 0 {
 		return nil, errors.New("cannot replay genesis block")
 	}
+	blockHook, _ := hook.(BlockHook)
+	if re.verify && blockHook == nil {
+		return nil, ErrBlockHookRequired
+	}
 	var err error
 	if base == nil {
 		parent := re.blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
@@ -199,20 +290,37 @@ func (re *ChainReplayer) ReplayBlock(ctx context.Context, block *types.Block, ba
 		}
 	}
 	signer := types.MakeSigner(re.blockchain.Config(), block.Number())
-	tracer := NewCallTracerWithHook(block, signer, base, hook)
-	statedb, _, _, _, err := re.processor.Process(block, base, vm.Config{Debug: true, Tracer: tracer})
+	tracer := newCallTracerWithHook(block, signer, base, hook)
+	tracer.decoder = re.decoder
+	statedb, receipts, _, usedGas, err := re.processor.Process(block, base, vm.Config{Debug: true, Tracer: tracer})
 	if err != nil {
 		return nil, err
 	}
+	if re.verify {
+		root := statedb.IntermediateRoot(re.blockchain.Config().IsEIP158(block.Number()))
+		if report := re.verifyBlock(block, root, receipts, usedGas); report != nil {
+			log.Error("Replayed block diverged from canonical chain", "number", report.BlockNumber, "hash", report.BlockHash, "firstTx", report.FirstTx, "mismatches", report.Mismatches)
+			re.divergeFeed.Send(report)
+			if blockHook != nil {
+				blockHook.OnBlockDiscard(tracer.Context, report)
+			}
+			return nil, report
+		}
+	} else {
+		statedb.Finalise(re.blockchain.Config().IsEIP158(block.Number()))
+		statedb.AccountsIntermediateRoot()
+	}
 	statedb.SetExpectedStateRoot(block.Root())
-	statedb.Finalise(re.blockchain.Config().IsEIP158(block.Number()))
-	statedb.AccountsIntermediateRoot()
 	// commit to cache the state to database
 	root, _, err := statedb.Commit(nil)
 	if err != nil {
 		return nil, fmt.Errorf("commit state failed: %v", err)
 	}
 	re.triesInMemory = append(re.triesInMemory, root)
+	re.writeCheckpoint(block)
+	if blockHook != nil {
+		blockHook.OnBlockCommit(tracer.Context)
+	}
 	return statedb, nil
 }
 
@@ -229,7 +337,8 @@ func (re *ChainReplayer) ReplayTransaction(ctx context.Context, block *types.Blo
 	}
 	txCtx := core.NewEVMTxContext(msg)
 	signer := types.MakeSigner(re.blockchain.Config(), block.Number())
-	tracer := NewCallTracerWithHook(block, signer, statedb, hook)
+	tracer := newCallTracerWithHook(block, signer, statedb, hook)
+	tracer.decoder = re.decoder
 	vmenv := vm.NewEVM(blkCtx, txCtx, statedb, re.blockchain.Config(), vm.Config{Debug: true, Tracer: tracer})
 	if posa, ok := re.blockchain.Engine().(consensus.PoSA); ok && msg.From() == blkCtx.Coinbase &&
 		posa.IsSystemContract(msg.To()) && msg.GasPrice().Cmp(big.NewInt(0)) == 0 {
@@ -255,3 +364,19 @@ func NewChainReplayer(db state.Database, bc *core.BlockChain) *ChainReplayer {
 		maxReExec:  math.MaxUint64,
 	}
 }
+
+// NewChainReplayerWithCheckpoints creates a replayer with its own state cache on top of
+// the chain database of the store, regenerated states are periodically persisted to the
+// store so that later replays can start from the nearest checkpoint instead of the last
+// state available in the chain database
+func NewChainReplayerWithCheckpoints(store *CheckpointStore, bc *core.BlockChain) *ChainReplayer {
+	layer := &checkpointLayer{
+		Database: store.chaindb,
+		store:    store,
+		active:   make(map[common.Hash]ethdb.Database),
+		retired:  make(map[common.Hash]ethdb.Database),
+	}
+	replayer := NewChainReplayer(state.NewDatabaseWithConfig(layer, &trie.Config{Cache: checkpointTrieCache}), bc)
+	replayer.checkpoints, replayer.checkpointDB = store, layer
+	return replayer
+}
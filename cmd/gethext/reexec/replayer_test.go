@@ -0,0 +1,119 @@
+package reexec
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress = crypto.PubkeyToAddress(testKey.PublicKey)
+)
+
+// newTestChain returns an archive chain of n blocks with a transfer in every block
+func newTestChain(t *testing.T, n int) (ethdb.Database, *core.BlockChain) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+		gspec  = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{testAddress: {Balance: big.NewInt(params.Ether)}},
+		}
+		genesis = gspec.MustCommit(db)
+		signer  = types.HomesteadSigner{}
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, engine, db, n, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(testAddress), common.Address{0x01}, big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, testKey)
+		require.NoError(t, err)
+		b.AddTx(tx)
+	})
+	cacheConfig := &core.CacheConfig{
+		TrieCleanLimit:    256,
+		TrieDirtyLimit:    256,
+		TrieTimeLimit:     5 * time.Minute,
+		TriesInMemory:     128,
+		TrieDirtyDisabled: true,
+	}
+	chain, err := core.NewBlockChain(db, cacheConfig, gspec.Config, engine, vm.Config{}, nil, nil)
+	require.NoError(t, err)
+	_, err = chain.InsertChain(blocks)
+	require.NoError(t, err)
+	t.Cleanup(chain.Stop)
+	return db, chain
+}
+
+// testBlockHook records the blocks committed and discarded after they were replayed
+type testBlockHook struct {
+	testHook
+	committed []uint64
+	discarded []*DivergenceReport
+}
+
+func (h *testBlockHook) OnBlockCommit(ctx *Context) {
+	h.committed = append(h.committed, ctx.Block().NumberU64())
+}
+
+func (h *testBlockHook) OnBlockDiscard(ctx *Context, report *DivergenceReport) {
+	h.discarded = append(h.discarded, report)
+}
+
+func TestReplayBlockVerify(t *testing.T) {
+	db, chain := newTestChain(t, 2)
+	replayer := NewChainReplayer(state.NewDatabase(db), chain)
+	replayer.SetVerify(true)
+	block := chain.GetBlockByNumber(2)
+
+	// the hook must be told whether the block diverged
+	txHook := &testHook{}
+	_, err := replayer.ReplayBlock(context.Background(), block, nil, txHook)
+	assert.ErrorIs(t, err, ErrBlockHookRequired)
+	assert.Empty(t, txHook.results)
+
+	hook := &testBlockHook{}
+	statedb, err := replayer.ReplayBlock(context.Background(), block, nil, hook)
+	require.NoError(t, err)
+	assert.Equal(t, block.Root(), statedb.IntermediateRoot(true))
+	assert.Len(t, hook.results, 1)
+	assert.Equal(t, []uint64{2}, hook.committed)
+	assert.Empty(t, hook.discarded)
+
+	// replaying on top of a wrong base state diverges from the canonical block
+	base, err := replayer.StateAtBlock(context.Background(), chain.GetBlockByNumber(1))
+	require.NoError(t, err)
+	base.AddBalance(common.Address{0x02}, big.NewInt(1))
+	hook = &testBlockHook{}
+	divergeCh := make(chan *DivergenceReport, 1)
+	sub := replayer.SubscribeDivergence(divergeCh)
+	defer sub.Unsubscribe()
+	_, err = replayer.ReplayBlock(context.Background(), block, base, hook)
+	var report *DivergenceReport
+	require.True(t, errors.As(err, &report))
+	assert.Equal(t, uint64(2), report.BlockNumber)
+	assert.Equal(t, block.Hash(), report.BlockHash)
+	require.Len(t, report.Mismatches, 1)
+	assert.Equal(t, "stateRoot", report.Mismatches[0].Field)
+	assert.Equal(t, block.Root().Hex(), report.Mismatches[0].Expected)
+	assert.Equal(t, -1, report.FirstTx)
+
+	// the transactions were replayed, but the block is discarded instead of committed
+	assert.Len(t, hook.results, 1)
+	assert.Empty(t, hook.committed)
+	assert.Equal(t, []*DivergenceReport{report}, hook.discarded)
+	assert.Equal(t, report, <-divergeCh)
+}
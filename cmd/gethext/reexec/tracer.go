@@ -14,6 +14,7 @@ import (
 	"strings"
 	"sync/atomic"
 
+	"github.com/ethereum/go-ethereum/cmd/gethext/abiutils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/vm"
 )
@@ -29,6 +30,8 @@ type CallFrame struct {
 	Output  []byte         `json:"output,omitempty"`
 	Error   error          `json:"error,omitempty"`
 	Calls   []CallFrame    `json:"calls,omitempty"`
+
+	Decoded *abiutils.DecodedCall `json:"decoded,omitempty"` // ABI decoded call data, only available if call decoding is enabled
 }
 
 type callTracer struct {
@@ -21,3 +21,15 @@ type TransactionHook interface {
 	// OnTxEnd is called when transaction execution ends
 	OnTxEnd(ctx *Context, ret *TxResult, restGas uint64)
 }
+
+// BlockHook is an optional interface of TransactionHook for processors which commit
+// their results once all transactions in the block were replayed. It is required if
+// the replayer verifies blocks, since the transaction hooks of a divergent block are
+// called before it is known to diverge
+type BlockHook interface {
+	// OnBlockCommit is called after the block was replayed, and verified if verification is enabled
+	OnBlockCommit(ctx *Context)
+
+	// OnBlockDiscard is called instead of OnBlockCommit when the replayed block diverged from the canonical block
+	OnBlockDiscard(ctx *Context, report *DivergenceReport)
+}
@@ -0,0 +1,89 @@
+package reexec
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Mismatch is a single value of the replayed block which differs from the canonical block
+type Mismatch struct {
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
+
+// DivergenceReport describes how the result of replaying a block differs from the canonical block
+type DivergenceReport struct {
+	BlockNumber uint64      `json:"blockNumber"`
+	BlockHash   common.Hash `json:"blockHash"`
+	Mismatches  []Mismatch  `json:"mismatches"`
+	FirstTx     int         `json:"firstDivergentTx"` // Index of the first transaction whose receipt differs, -1 if unknown
+}
+
+func (r *DivergenceReport) add(field string, expected, actual interface{}) {
+	r.Mismatches = append(r.Mismatches, Mismatch{
+		Field:    field,
+		Expected: fmt.Sprintf("%v", expected),
+		Actual:   fmt.Sprintf("%v", actual),
+	})
+}
+
+// Error implements error interface so the report can be returned as a replay error
+func (r *DivergenceReport) Error() string {
+	fields := make([]string, 0, len(r.Mismatches))
+	for _, m := range r.Mismatches {
+		fields = append(fields, fmt.Sprintf("%s (remote: %s local: %s)", m.Field, m.Expected, m.Actual))
+	}
+	return fmt.Sprintf("replayed block #%d diverged: %s", r.BlockNumber, strings.Join(fields, ", "))
+}
+
+// findDivergentReceipt returns the index of the first replayed receipt which does not match the canonical one
+func findDivergentReceipt(canonical, replayed types.Receipts) int {
+	for idx := 0; idx < len(canonical) && idx < len(replayed); idx++ {
+		if canonical[idx].Status != replayed[idx].Status ||
+			canonical[idx].CumulativeGasUsed != replayed[idx].CumulativeGasUsed ||
+			canonical[idx].Bloom != replayed[idx].Bloom ||
+			len(canonical[idx].Logs) != len(replayed[idx].Logs) {
+			return idx
+		}
+	}
+	if len(canonical) != len(replayed) {
+		if len(canonical) < len(replayed) {
+			return len(canonical)
+		}
+		return len(replayed)
+	}
+	return -1
+}
+
+// verifyBlock compares the replayed results with the canonical block header, returns nil if all values match
+func (re *ChainReplayer) verifyBlock(block *types.Block, root common.Hash, receipts types.Receipts, usedGas uint64) *DivergenceReport {
+	report := &DivergenceReport{
+		BlockNumber: block.NumberU64(),
+		BlockHash:   block.Hash(),
+		FirstTx:     -1,
+	}
+	if root != block.Root() {
+		report.add("stateRoot", block.Root().Hex(), root.Hex())
+	}
+	if usedGas != block.GasUsed() {
+		report.add("gasUsed", block.GasUsed(), usedGas)
+	}
+	if bloom := types.CreateBloom(receipts); bloom != block.Bloom() {
+		report.add("logsBloom", common.Bytes2Hex(block.Bloom().Bytes()), common.Bytes2Hex(bloom.Bytes()))
+	}
+	if receiptSha := types.DeriveSha(receipts, trie.NewStackTrie(nil)); receiptSha != block.ReceiptHash() {
+		report.add("receiptsRoot", block.ReceiptHash().Hex(), receiptSha.Hex())
+		if canonical := re.blockchain.GetReceiptsByHash(block.Hash()); canonical != nil {
+			report.FirstTx = findDivergentReceipt(canonical, receipts)
+		}
+	}
+	if len(report.Mismatches) == 0 {
+		return nil
+	}
+	return report
+}
@@ -0,0 +1,38 @@
+package sink
+
+import (
+	"fmt"
+)
+
+const (
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+)
+
+var DefaultConfig = Config{
+	Format:          FormatJSONL,
+	PartitionBlocks: 100000,
+	MaxFileSize:     256 * 1024 * 1024,
+}
+
+// Config controls where and how records are written
+type Config struct {
+	Dir             string // Root directory of all sinks, records of each schema are written to their own sub directory
+	Format          string // Output format, "jsonl" or "csv"
+	Gzip            bool   // Compress output files with gzip
+	PartitionBlocks uint64 // Number of blocks covered by each output file
+	MaxFileSize     uint64 // Start a new part of the partition once a file exceeds this size, 0 means unlimited
+}
+
+func (cfg *Config) Sanitize() error {
+	if cfg.Format == "" {
+		cfg.Format = DefaultConfig.Format
+	}
+	if _, exist := formats[cfg.Format]; !exist {
+		return fmt.Errorf("unsupported sink format %q", cfg.Format)
+	}
+	if cfg.PartitionBlocks == 0 {
+		cfg.PartitionBlocks = DefaultConfig.PartitionBlocks
+	}
+	return nil
+}
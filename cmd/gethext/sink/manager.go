@@ -0,0 +1,84 @@
+package sink
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Manager shares sinks between the processors emitting records of the same schema
+type Manager struct {
+	config *Config
+	sinks  map[string]Sink
+	mtx    sync.Mutex
+}
+
+// Open returns the sink of the schema, the sink is created on first use
+func (m *Manager) Open(schema *Schema) (Sink, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if sink, exist := m.sinks[schema.Name]; exist {
+		if !reflect.DeepEqual(sink.Schema().Fields, schema.Fields) {
+			return nil, fmt.Errorf("schema %s was opened with different fields", schema.Name)
+		}
+		return sink, nil
+	}
+	sink, err := NewFileSink(m.config, schema)
+	if err != nil {
+		return nil, err
+	}
+	m.sinks[schema.Name] = sink
+	return sink, nil
+}
+
+// Attach opens the sink of a processor if it emits records, does nothing otherwise
+func (m *Manager) Attach(proc interface{}) error {
+	emitter, ok := proc.(Emitter)
+	if m == nil || !ok {
+		return nil
+	}
+	sink, err := m.Open(emitter.Schema())
+	if err != nil {
+		return err
+	}
+	emitter.SetSink(sink)
+	return nil
+}
+
+// Flush flushes buffered records of all sinks
+func (m *Manager) Flush() {
+	if m == nil {
+		return
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for name, sink := range m.sinks {
+		if err := sink.Flush(); err != nil {
+			log.Error("Could not flush sink", "schema", name, "error", err)
+		}
+	}
+}
+
+// Close closes all sinks
+func (m *Manager) Close() {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for name, sink := range m.sinks {
+		if err := sink.Close(); err != nil {
+			log.Error("Could not close sink", "schema", name, "error", err)
+		}
+	}
+	m.sinks = make(map[string]Sink)
+}
+
+func NewManager(config *Config) (*Manager, error) {
+	if err := config.Sanitize(); err != nil {
+		return nil, err
+	}
+	return &Manager{
+		config: config,
+		sinks:  make(map[string]Sink),
+	}, nil
+}
@@ -0,0 +1,125 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// FieldType is the declared type of a record field
+type FieldType string
+
+const (
+	TypeString  FieldType = "string"
+	TypeInt     FieldType = "int"
+	TypeUint    FieldType = "uint"
+	TypeFloat   FieldType = "float"
+	TypeBool    FieldType = "bool"
+	TypeAddress FieldType = "address" // Hex encoded address
+	TypeHash    FieldType = "hash"    // Hex encoded 32 bytes hash
+	TypeBigInt  FieldType = "bigint"  // Decimal encoded big integer, written as string to keep precision
+	TypeBytes   FieldType = "bytes"   // Hex encoded bytes
+)
+
+var fieldTypes = map[FieldType]bool{
+	TypeString: true, TypeInt: true, TypeUint: true, TypeFloat: true, TypeBool: true,
+	TypeAddress: true, TypeHash: true, TypeBigInt: true, TypeBytes: true,
+}
+
+type Field struct {
+	Name string    `json:"name"`
+	Type FieldType `json:"type"`
+}
+
+// Schema declares the name and fields of the records a processor emits. The name
+// is used as the directory of the output files.
+type Schema struct {
+	Name   string  `json:"name"`
+	Fields []Field `json:"fields"`
+}
+
+func (s *Schema) Validate() error {
+	if s.Name == "" {
+		return errors.New("schema name is required")
+	}
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("schema %s has no fields", s.Name)
+	}
+	seen := make(map[string]bool, len(s.Fields))
+	for _, field := range s.Fields {
+		if field.Name == "" {
+			return fmt.Errorf("schema %s has a field without name", s.Name)
+		}
+		if seen[field.Name] {
+			return fmt.Errorf("schema %s has duplicated field %s", s.Name, field.Name)
+		}
+		if !fieldTypes[field.Type] {
+			return fmt.Errorf("field %s of schema %s has unknown type %q", field.Name, s.Name, field.Type)
+		}
+		seen[field.Name] = true
+	}
+	return nil
+}
+
+// Record is a row of values keyed by field names, fields missing from the record are written as empty values
+type Record map[string]interface{}
+
+// normalize converts a field value into a value that encodes the same way in every output format
+func normalize(val interface{}) interface{} {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case common.Address:
+		return v.Hex()
+	case *common.Address:
+		if v == nil {
+			return nil
+		}
+		return v.Hex()
+	case common.Hash:
+		return v.Hex()
+	case *big.Int:
+		if v == nil {
+			return nil
+		}
+		return v.String()
+	case []byte:
+		return hexutil.Encode(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return val
+}
+
+// values returns the normalized record values in the order of schema fields
+func (s *Schema) values(rec Record) ([]interface{}, error) {
+	ret := make([]interface{}, len(s.Fields))
+	matched := 0
+	for idx, field := range s.Fields {
+		if val, exist := rec[field.Name]; exist {
+			ret[idx] = normalize(val)
+			matched++
+		}
+	}
+	// some record fields are not declared
+	if matched != len(rec) {
+		for name := range rec {
+			if !s.hasField(name) {
+				return nil, fmt.Errorf("field %s is not declared in schema %s", name, s.Name)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (s *Schema) hasField(name string) bool {
+	for _, field := range s.Fields {
+		if field.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,359 @@
+package sink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	schemaFileName    = "schema.json"
+	maxOpenPartitions = 4 // Maximum number of partition files of a sink kept open
+)
+
+var ErrSinkClosed = errors.New("sink closed")
+
+// Sink receives records emitted by processors
+type Sink interface {
+	// Schema returns the schema of the records the sink accepts
+	Schema() *Schema
+
+	// Write writes a record produced while processing the given block
+	Write(block uint64, rec Record) error
+
+	// Flush writes buffered records to the underlying storage
+	Flush() error
+
+	// Close flushes and closes the sink
+	Close() error
+}
+
+// Emitter is implemented by processors which emit records. The processor declares
+// the schema of its records and receives the sink to write them to.
+type Emitter interface {
+	Schema() *Schema
+	SetSink(sink Sink)
+}
+
+// encoder writes records of a schema in an output format
+type encoder interface {
+	WriteHeader() error
+	Encode(values []interface{}) error
+	Flush() error
+}
+
+type encoderFactory func(w io.Writer, schema *Schema) encoder
+
+// formats holds encoders of the supported output formats by name and file extension
+var formats = map[string]struct {
+	ext     string
+	factory encoderFactory
+}{
+	FormatJSONL: {"jsonl", newJSONLEncoder},
+	FormatCSV:   {"csv", newCSVEncoder},
+}
+
+type jsonlEncoder struct {
+	w      io.Writer
+	schema *Schema
+}
+
+func (e *jsonlEncoder) WriteHeader() error {
+	return nil
+}
+
+func (e *jsonlEncoder) Encode(values []interface{}) error {
+	obj := make(map[string]interface{}, len(values))
+	for idx, field := range e.schema.Fields {
+		obj[field.Name] = values[idx]
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonlEncoder) Flush() error {
+	return nil
+}
+
+func newJSONLEncoder(w io.Writer, schema *Schema) encoder {
+	return &jsonlEncoder{w: w, schema: schema}
+}
+
+type csvEncoder struct {
+	w      *csv.Writer
+	schema *Schema
+	row    []string
+}
+
+func (e *csvEncoder) WriteHeader() error {
+	for idx, field := range e.schema.Fields {
+		e.row[idx] = field.Name
+	}
+	return e.w.Write(e.row)
+}
+
+func (e *csvEncoder) Encode(values []interface{}) error {
+	for idx, val := range values {
+		if val == nil {
+			e.row[idx] = ""
+		} else {
+			e.row[idx] = fmt.Sprint(val)
+		}
+	}
+	return e.w.Write(e.row)
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func newCSVEncoder(w io.Writer, schema *Schema) encoder {
+	return &csvEncoder{w: csv.NewWriter(w), schema: schema, row: make([]string, len(schema.Fields))}
+}
+
+// countingWriter counts the bytes written to the output file
+type countingWriter struct {
+	w    io.Writer
+	size uint64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.size += uint64(n)
+	return n, err
+}
+
+// outputFile is an open output file with its writer chain: encoder -> buffer -> gzip -> file
+type outputFile struct {
+	path    string
+	file    *os.File
+	counter *countingWriter
+	gz      *gzip.Writer
+	buf     *bufio.Writer
+	enc     encoder
+	written uint64 // Sequence number of the last write, the least recently written file is closed first
+}
+
+func (f *outputFile) flush() error {
+	if err := f.enc.Flush(); err != nil {
+		return err
+	}
+	if err := f.buf.Flush(); err != nil {
+		return err
+	}
+	if f.gz != nil {
+		return f.gz.Flush()
+	}
+	return nil
+}
+
+func (f *outputFile) close() error {
+	if err := f.flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+	if f.gz != nil {
+		if err := f.gz.Close(); err != nil {
+			f.file.Close()
+			return err
+		}
+	}
+	return f.file.Close()
+}
+
+// fileSink writes records into files partitioned by block range, every partition file
+// is named by its block range, e.g <dir>/<schema>/000000100000-000000199999.jsonl.
+// A new part of the partition is started when the file exceeds the size limit, or the
+// partition file already exists, existing files are never appended. Every partition
+// written to has its own open file, so writers of different block ranges, e.g. a task
+// replaying history and the chain monitor, do not rotate each other's files. At most
+// maxOpenPartitions files are kept open, the least recently written one is closed first.
+type fileSink struct {
+	config *Config
+	schema *Schema
+	dir    string
+	ext    string
+	enc    encoderFactory
+
+	files  map[uint64]*outputFile // Open files by the first block of their partition
+	writes uint64                 // Number of written records
+	mtx    sync.Mutex
+	closed bool
+}
+
+func (s *fileSink) Schema() *Schema {
+	return s.schema
+}
+
+func (s *fileSink) partitionPath(from uint64, part int) string {
+	name := fmt.Sprintf("%012d-%012d", from, from+s.config.PartitionBlocks-1)
+	if part > 0 {
+		name = fmt.Sprintf("%s.%d", name, part)
+	}
+	name += "." + s.ext
+	if s.config.Gzip {
+		name += ".gz"
+	}
+	return filepath.Join(s.dir, name)
+}
+
+func (s *fileSink) openPartition(from uint64) (*outputFile, error) {
+	var path string
+	for part := 0; ; part++ {
+		path = s.partitionPath(from, part)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	out := &outputFile{path: path, file: file, counter: &countingWriter{w: file}}
+	var w io.Writer = out.counter
+	if s.config.Gzip {
+		out.gz = gzip.NewWriter(w)
+		w = out.gz
+	}
+	out.buf = bufio.NewWriter(w)
+	out.enc = s.enc(out.buf, s.schema)
+	if err := out.enc.WriteHeader(); err != nil {
+		out.close()
+		return nil, err
+	}
+	log.Debug("Opened sink output file", "schema", s.schema.Name, "path", path)
+	return out, nil
+}
+
+// closePartition closes the open file of the partition if there is one
+func (s *fileSink) closePartition(from uint64) error {
+	out, exist := s.files[from]
+	if !exist {
+		return nil
+	}
+	delete(s.files, from)
+	return out.close()
+}
+
+func (s *fileSink) Write(block uint64, rec Record) error {
+	values, err := s.schema.values(rec)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return ErrSinkClosed
+	}
+	from := block / s.config.PartitionBlocks * s.config.PartitionBlocks
+	out := s.files[from]
+	if out != nil && s.config.MaxFileSize > 0 && out.counter.size >= s.config.MaxFileSize {
+		if err := s.closePartition(from); err != nil {
+			return err
+		}
+		out = nil
+	}
+	if out == nil {
+		if len(s.files) >= maxOpenPartitions {
+			if err := s.closePartition(s.leastRecentPartition()); err != nil {
+				return err
+			}
+		}
+		if out, err = s.openPartition(from); err != nil {
+			return err
+		}
+		s.files[from] = out
+	}
+	s.writes++
+	out.written = s.writes
+	return out.enc.Encode(values)
+}
+
+// leastRecentPartition returns the open partition which was written to least recently
+func (s *fileSink) leastRecentPartition() uint64 {
+	var (
+		ret     uint64
+		written = uint64(math.MaxUint64)
+	)
+	for from, out := range s.files {
+		if out.written < written {
+			ret, written = from, out.written
+		}
+	}
+	return ret
+}
+
+func (s *fileSink) Flush() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, out := range s.files {
+		if err := out.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.closed = true
+	var ret error
+	for from := range s.files {
+		if err := s.closePartition(from); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+// writeSchemaFile writes the schema next to the output files so readers know the field types
+func writeSchemaFile(dir string, schema *Schema) error {
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, schemaFileName), data, 0644)
+}
+
+// NewFileSink creates a sink writing records of the schema under config.Dir
+func NewFileSink(config *Config, schema *Schema) (Sink, error) {
+	if err := schema.Validate(); err != nil {
+		return nil, err
+	}
+	format, exist := formats[config.Format]
+	if !exist {
+		return nil, fmt.Errorf("unsupported sink format %q", config.Format)
+	}
+	dir := filepath.Join(config.Dir, schema.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := writeSchemaFile(dir, schema); err != nil {
+		return nil, err
+	}
+	return &fileSink{
+		config: config,
+		schema: schema,
+		dir:    dir,
+		ext:    format.ext,
+		enc:    format.factory,
+		files:  make(map[uint64]*outputFile),
+	}, nil
+}
@@ -0,0 +1,193 @@
+package sink
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSchema = &Schema{
+	Name: "transfers",
+	Fields: []Field{
+		{Name: "block", Type: TypeUint},
+		{Name: "to", Type: TypeAddress},
+		{Name: "value", Type: TypeBigInt},
+	},
+}
+
+func newTestSink(t *testing.T, config *Config) *fileSink {
+	config.Dir = t.TempDir()
+	require.NoError(t, config.Sanitize())
+	sink, err := NewFileSink(config, testSchema)
+	require.NoError(t, err)
+	return sink.(*fileSink)
+}
+
+func writeTestRecord(t *testing.T, sink Sink, block uint64) {
+	require.NoError(t, sink.Write(block, Record{"block": block, "to": common.Address{0x01}, "value": big.NewInt(int64(block))}))
+}
+
+// readJSONL returns the blocks of the records in the file
+func readJSONL(t *testing.T, path string) []uint64 {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var blocks []uint64
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var rec struct {
+			Block uint64 `json:"block"`
+			To    string `json:"to"`
+			Value string `json:"value"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &rec))
+		assert.Equal(t, common.Address{0x01}.Hex(), rec.To)
+		assert.Equal(t, fmt.Sprint(rec.Block), rec.Value)
+		blocks = append(blocks, rec.Block)
+	}
+	return blocks
+}
+
+func outputFiles(t *testing.T, sink *fileSink) []string {
+	entries, err := os.ReadDir(sink.dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		if entry.Name() != schemaFileName {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func TestFileSinkPartitions(t *testing.T) {
+	sink := newTestSink(t, &Config{PartitionBlocks: 100})
+
+	// writers of different block ranges keep writing their own partition files
+	for block := uint64(1); block <= 5; block++ {
+		writeTestRecord(t, sink, block)
+		writeTestRecord(t, sink, 250+block)
+	}
+	require.NoError(t, sink.Close())
+	assert.Equal(t, []string{"000000000000-000000000099.jsonl", "000000000200-000000000299.jsonl"}, outputFiles(t, sink))
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5}, readJSONL(t, filepath.Join(sink.dir, "000000000000-000000000099.jsonl")))
+	assert.Equal(t, []uint64{251, 252, 253, 254, 255}, readJSONL(t, filepath.Join(sink.dir, "000000000200-000000000299.jsonl")))
+	assert.ErrorIs(t, sink.Write(1, Record{"block": 1}), ErrSinkClosed)
+
+	// existing files are never appended
+	reopened, err := NewFileSink(sink.config, testSchema)
+	require.NoError(t, err)
+	writeTestRecord(t, reopened, 6)
+	require.NoError(t, reopened.Close())
+	assert.Equal(t, []uint64{6}, readJSONL(t, filepath.Join(sink.dir, "000000000000-000000000099.1.jsonl")))
+
+	var schema Schema
+	data, err := os.ReadFile(filepath.Join(sink.dir, schemaFileName))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &schema))
+	assert.Equal(t, *testSchema, schema)
+}
+
+func TestFileSinkMaxOpenPartitions(t *testing.T) {
+	sink := newTestSink(t, &Config{PartitionBlocks: 10})
+	for part := uint64(0); part <= maxOpenPartitions; part++ {
+		writeTestRecord(t, sink, part*10)
+	}
+	assert.Len(t, sink.files, maxOpenPartitions)
+	assert.NotContains(t, sink.files, uint64(0))
+
+	// the least recently written partition was closed, it is continued in a new part
+	writeTestRecord(t, sink, 1)
+	assert.Len(t, sink.files, maxOpenPartitions)
+	assert.NotContains(t, sink.files, uint64(10))
+	require.NoError(t, sink.Close())
+	assert.Equal(t, []uint64{0}, readJSONL(t, filepath.Join(sink.dir, "000000000000-000000000009.jsonl")))
+	assert.Equal(t, []uint64{1}, readJSONL(t, filepath.Join(sink.dir, "000000000000-000000000009.1.jsonl")))
+}
+
+func TestFileSinkMaxFileSize(t *testing.T) {
+	sink := newTestSink(t, &Config{PartitionBlocks: 100, MaxFileSize: 1})
+
+	// the size is known once the records were flushed
+	writeTestRecord(t, sink, 1)
+	writeTestRecord(t, sink, 2)
+	require.NoError(t, sink.Flush())
+	writeTestRecord(t, sink, 3)
+	require.NoError(t, sink.Close())
+	assert.Equal(t, []string{"000000000000-000000000099.1.jsonl", "000000000000-000000000099.jsonl"}, outputFiles(t, sink))
+	assert.Equal(t, []uint64{1, 2}, readJSONL(t, filepath.Join(sink.dir, "000000000000-000000000099.jsonl")))
+	assert.Equal(t, []uint64{3}, readJSONL(t, filepath.Join(sink.dir, "000000000000-000000000099.1.jsonl")))
+}
+
+func TestFileSinkGzipCSV(t *testing.T) {
+	sink := newTestSink(t, &Config{Format: FormatCSV, Gzip: true, PartitionBlocks: 100})
+	writeTestRecord(t, sink, 1)
+	require.NoError(t, sink.Write(2, Record{"block": uint64(2)}))
+	require.NoError(t, sink.Close())
+
+	file, err := os.Open(filepath.Join(sink.dir, "000000000000-000000000099.csv.gz"))
+	require.NoError(t, err)
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	rows, err := csv.NewReader(gz).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"block", "to", "value"},
+		{"1", common.Address{0x01}.Hex(), "1"},
+		{"2", "", ""},
+	}, rows)
+}
+
+func TestSchemaValues(t *testing.T) {
+	_, err := testSchema.values(Record{"block": 1, "from": common.Address{}})
+	assert.ErrorContains(t, err, "field from is not declared in schema transfers")
+
+	values, err := testSchema.values(Record{"to": &common.Address{0x02}, "value": (*big.Int)(nil)})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{nil, common.Address{0x02}.Hex(), nil}, values)
+
+	assert.ErrorContains(t, (&Schema{Name: "a", Fields: []Field{{Name: "x", Type: "int"}, {Name: "x", Type: "int"}}}).Validate(), "duplicated field x")
+	assert.ErrorContains(t, (&Schema{Name: "a", Fields: []Field{{Name: "x", Type: "uint256"}}}).Validate(), "unknown type")
+}
+
+type testEmitter struct {
+	schema *Schema
+	sink   Sink
+}
+
+func (e *testEmitter) Schema() *Schema {
+	return e.schema
+}
+
+func (e *testEmitter) SetSink(sink Sink) {
+	e.sink = sink
+}
+
+func TestManagerAttach(t *testing.T) {
+	manager, err := NewManager(&Config{Dir: t.TempDir()})
+	require.NoError(t, err)
+	defer manager.Close()
+
+	// emitters of the same schema share the sink
+	emitter1, emitter2 := &testEmitter{schema: testSchema}, &testEmitter{schema: testSchema}
+	require.NoError(t, manager.Attach(emitter1))
+	require.NoError(t, manager.Attach(emitter2))
+	require.NotNil(t, emitter1.sink)
+	assert.Same(t, emitter1.sink, emitter2.sink)
+
+	other := &testEmitter{schema: &Schema{Name: testSchema.Name, Fields: []Field{{Name: "block", Type: TypeUint}}}}
+	assert.ErrorContains(t, manager.Attach(other), "opened with different fields")
+	assert.NoError(t, manager.Attach(struct{}{}))
+
+	var nilManager *Manager
+	assert.NoError(t, nilManager.Attach(emitter1))
+}
@@ -0,0 +1,228 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/gethext/reexec"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const taskProgressInterval = time.Second
+
+// TaskInfo describes the current state of a task
+type TaskInfo struct {
+	Name     string     `json:"name"`
+	Kind     string     `json:"kind,omitempty"`
+	Status   TaskStatus `json:"status"`
+	Progress uint64     `json:"progress"`
+	Error    string     `json:"error,omitempty"`
+	Created  int64      `json:"created,omitempty"`
+	Updated  int64      `json:"updated,omitempty"`
+}
+
+func (tm *TaskManager) taskInfo(name string, task Task) *TaskInfo {
+	info := &TaskInfo{Name: name, Status: task.Status()}
+	if record, exist := tm.records[name]; exist {
+		info.Kind = record.Kind
+		info.Created = record.Created
+		info.Updated = record.Updated
+	}
+	if ptask, ok := task.(PersistentTask); ok {
+		info.Kind = ptask.Kind()
+		info.Progress = ptask.Progress()
+		if err := ptask.Err(); err != nil {
+			info.Error = err.Error()
+		}
+	}
+	return info
+}
+
+func recordInfo(record *TaskRecord) *TaskInfo {
+	return &TaskInfo{
+		Name:     record.Name,
+		Kind:     record.Kind,
+		Status:   record.Status,
+		Progress: record.Progress,
+		Error:    record.Error,
+		Created:  record.Created,
+		Updated:  record.Updated,
+	}
+}
+
+// TaskInfo returns the state of a running task or the record of a terminated task
+func (tm *TaskManager) TaskInfo(name string) (*TaskInfo, error) {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	if task, exist := tm.tasks[name]; exist {
+		return tm.taskInfo(name, task), nil
+	}
+	if record, exist := tm.records[name]; exist {
+		return recordInfo(record), nil
+	}
+	return nil, ErrTaskNotExists
+}
+
+// TaskInfos returns the state of all running tasks and records of terminated tasks ordered by name
+func (tm *TaskManager) TaskInfos() []*TaskInfo {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	ret := make([]*TaskInfo, 0, len(tm.records)+len(tm.tasks))
+	for name, task := range tm.tasks {
+		ret = append(ret, tm.taskInfo(name, task))
+	}
+	for name, record := range tm.records {
+		if _, live := tm.tasks[name]; !live {
+			ret = append(ret, recordInfo(record))
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// APIs returns the RPC APIs of the task manager
+func (tm *TaskManager) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "task",
+			Service:   &TaskAPI{tm},
+		},
+	}
+}
+
+// TaskAPI provides an API to inspect and control tasks
+type TaskAPI struct {
+	tm *TaskManager
+}
+
+// List returns all tasks including the terminated ones ordered by name
+func (api *TaskAPI) List() []*TaskInfo {
+	return api.tm.TaskInfos()
+}
+
+// Get returns the state of a task
+func (api *TaskAPI) Get(name string) (*TaskInfo, error) {
+	return api.tm.TaskInfo(name)
+}
+
+// Start creates and runs a reexec task with the given block range and registered processors
+func (api *TaskAPI) Start(name string, opts ReExecOptions) (*TaskInfo, error) {
+	if len(opts.ProcessorNames) == 0 && !opts.GasProfile {
+		return nil, errors.New("no processors provided")
+	}
+	opts.Name = name
+	task, err := api.tm.NewReExecTask(&opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := api.tm.RunTask(name, task); err != nil {
+		return nil, err
+	}
+	return api.tm.TaskInfo(name)
+}
+
+// Pause pauses a running task
+func (api *TaskAPI) Pause(name string) (*TaskInfo, error) {
+	task, err := api.tm.GetTask(name)
+	if err != nil {
+		return nil, err
+	}
+	task.Pause()
+	return api.tm.TaskInfo(name)
+}
+
+// Resume resumes a paused task
+func (api *TaskAPI) Resume(name string) (*TaskInfo, error) {
+	task, err := api.tm.GetTask(name)
+	if err != nil {
+		return nil, err
+	}
+	task.Resume()
+	return api.tm.TaskInfo(name)
+}
+
+// Kill aborts a task and removes its record
+func (api *TaskAPI) Kill(name string) error {
+	if _, err := api.tm.TaskInfo(name); err != nil {
+		return err
+	}
+	return api.tm.KillTask(name)
+}
+
+// GasProfile returns the gas used by contract methods in the given block range of a task
+// started with gas profiling, gas is aggregated over all profile windows overlapping the range
+func (api *TaskAPI) GasProfile(name string, from, to uint64) (*reexec.GasProfile, error) {
+	return api.tm.GasProfile(name, from, to)
+}
+
+// GasProfileFolded returns the gas profile of a task in folded stack format which is
+// accepted by flamegraph tools
+func (api *TaskAPI) GasProfileFolded(name string, from, to uint64) (string, error) {
+	profile, err := api.tm.GasProfile(name, from, to)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err := profile.WriteFolded(buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Schedule adds a schedule which creates reexec tasks periodically or once its dependencies finished
+func (api *TaskAPI) Schedule(schedule Schedule) error {
+	return api.tm.AddSchedule(&schedule)
+}
+
+// Unschedule removes a schedule
+func (api *TaskAPI) Unschedule(name string) error {
+	return api.tm.RemoveSchedule(name)
+}
+
+// Schedules returns all schedules
+func (api *TaskAPI) Schedules() []Schedule {
+	return api.tm.Schedules()
+}
+
+// Progress sends the state of a task every time it changed until the task terminated
+func (api *TaskAPI) Progress(ctx context.Context, name string) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	if _, err := api.tm.TaskInfo(name); err != nil {
+		return nil, err
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		ticker := time.NewTicker(taskProgressInterval)
+		defer ticker.Stop()
+		var last *TaskInfo
+		for {
+			select {
+			case <-ticker.C:
+				info, err := api.tm.TaskInfo(name)
+				if err != nil {
+					return
+				}
+				if last == nil || *last != *info {
+					notifier.Notify(rpcSub.ID, info)
+					last = info
+				}
+				if info.Status.isTerminated() {
+					return
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
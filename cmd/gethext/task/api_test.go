@@ -0,0 +1,200 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTaskAPI(t *testing.T, n int) *TaskAPI {
+	db, chain := newTestChain(t, n)
+	tm, err := NewTaskManager(rawdb.NewMemoryDatabase(), db, nil, chain, nil)
+	require.NoError(t, err)
+	require.NoError(t, tm.RegisterProcessor("test", &testProcessor{}))
+	return &TaskAPI{tm}
+}
+
+func waitTaskStatus(t *testing.T, api *TaskAPI, name string, status TaskStatus) {
+	require.Eventually(t, func() bool {
+		info, err := api.Get(name)
+		return err == nil && info.Status == status
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestTaskAPIGasProfile(t *testing.T) {
+	api := newTestTaskAPI(t, 4)
+
+	_, err := api.Start("nostate", ReExecOptions{StartBlock: 1, EndBlock: 4, NoState: true, GasProfile: true})
+	assert.ErrorContains(t, err, "gas profile requires replaying the state")
+	_, err = api.Start("empty", ReExecOptions{StartBlock: 1, EndBlock: 4})
+	assert.ErrorContains(t, err, "no processors provided")
+
+	_, err = api.Start("profile", ReExecOptions{StartBlock: 1, EndBlock: 4, GasProfile: true, ProfileWindow: 2})
+	require.NoError(t, err)
+	waitTaskStatus(t, api, "profile", StatusFinished)
+
+	// the profile is kept after the task finished, every block transfers to 0x01
+	profile, err := api.GasProfile("profile", 1, 4)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), profile.Blocks)
+	require.Len(t, profile.Entries, 1)
+	entry := profile.Entries[0]
+	assert.Equal(t, common.Address{0x01}, entry.Contract)
+	assert.Equal(t, "fallback", entry.Selector)
+	assert.Equal(t, uint64(4), entry.Calls)
+	assert.Equal(t, 4*params.TxGas, entry.Inclusive)
+	assert.Equal(t, 4*params.TxGas, entry.Exclusive)
+
+	// the profile spans the whole windows overlapping the range
+	profile, err = api.GasProfile("profile", 3, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 3, 2}, []uint64{profile.From, profile.To, profile.Blocks})
+
+	folded, err := api.GasProfileFolded("profile", 1, 4)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(folded, strings.ToLower(common.Address{0x01}.Hex())+":fallback "))
+
+	_, err = api.GasProfile("profile", 4, 1)
+	assert.ErrorContains(t, err, "invalid block range")
+	_, err = api.GasProfile("unknown", 1, 4)
+	assert.ErrorIs(t, err, ErrTaskNotExists)
+
+	// the profile is dropped with the task
+	require.NoError(t, api.Kill("profile"))
+	_, err = api.GasProfile("profile", 1, 4)
+	assert.ErrorIs(t, err, ErrTaskNotExists)
+}
+
+func TestTaskAPI(t *testing.T) {
+	api := newTestTaskAPI(t, 2)
+
+	_, err := api.Start("test", ReExecOptions{StartBlock: 1, EndBlock: 2})
+	assert.ErrorContains(t, err, "no processors provided")
+	_, err = api.Start("test", ReExecOptions{StartBlock: 1, EndBlock: 2, ProcessorNames: []string{"unknown"}})
+	assert.ErrorContains(t, err, "processor unknown is not registered")
+	_, err = api.Start("test", ReExecOptions{StartBlock: 2, EndBlock: 1, ProcessorNames: []string{"test"}})
+	assert.ErrorContains(t, err, "invalid block range [2,1]")
+	assert.Empty(t, api.List())
+
+	// the task follows the chain head until it is killed
+	info, err := api.Start("follow", ReExecOptions{Name: "ignored", StartBlock: 1, ProcessorNames: []string{"test"}})
+	require.NoError(t, err)
+	assert.Equal(t, "follow", info.Name)
+	assert.Equal(t, reexecTaskKind, info.Kind)
+	assert.NotZero(t, info.Created)
+	_, err = api.Start("follow", ReExecOptions{StartBlock: 1, ProcessorNames: []string{"test"}})
+	assert.ErrorIs(t, err, ErrTaskAlreadyExists)
+
+	require.Eventually(t, func() bool {
+		info, err := api.Get("follow")
+		return err == nil && info.Progress == 2
+	}, 10*time.Second, 10*time.Millisecond)
+	info, err = api.Pause("follow")
+	require.NoError(t, err)
+	assert.Equal(t, StatusPaused, info.Status)
+	info, err = api.Resume("follow")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, info.Status)
+
+	_, err = api.Start("finished", ReExecOptions{StartBlock: 1, EndBlock: 2, ProcessorNames: []string{"test"}})
+	require.NoError(t, err)
+	waitTaskStatus(t, api, "finished", StatusFinished)
+
+	// terminated tasks are listed from their records, tasks are ordered by name
+	_, err = api.Start("another", ReExecOptions{StartBlock: 1, EndBlock: 2, ProcessorNames: []string{"test"}})
+	require.NoError(t, err)
+	waitTaskStatus(t, api, "another", StatusFinished)
+	var (
+		names    []string
+		statuses []TaskStatus
+	)
+	for _, info := range api.List() {
+		names = append(names, info.Name)
+		statuses = append(statuses, info.Status)
+	}
+	assert.Equal(t, []string{"another", "finished", "follow"}, names)
+	assert.Equal(t, []TaskStatus{StatusFinished, StatusFinished, StatusRunning}, statuses)
+	_, err = api.Pause("finished")
+	assert.ErrorIs(t, err, ErrTaskNotExists)
+
+	// killed tasks are removed with their records
+	require.NoError(t, api.Kill("follow"))
+	require.NoError(t, api.Kill("finished"))
+	require.NoError(t, api.Kill("another"))
+	assert.ErrorIs(t, api.Kill("follow"), ErrTaskNotExists)
+	_, err = api.Get("follow")
+	assert.ErrorIs(t, err, ErrTaskNotExists)
+	assert.Empty(t, api.List())
+	assert.Empty(t, api.tm.Records())
+}
+
+func TestTaskAPIProgress(t *testing.T) {
+	api := newTestTaskAPI(t, 2)
+	server := rpc.NewServer()
+	require.NoError(t, server.RegisterName("task", api))
+	defer server.Stop()
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	infoCh := make(chan *TaskInfo, 4)
+	_, err := client.Subscribe(context.Background(), "task", infoCh, "progress", "unknown")
+	assert.ErrorContains(t, err, ErrTaskNotExists.Error())
+
+	_, err = api.Start("test", ReExecOptions{StartBlock: 1, EndBlock: 2, ProcessorNames: []string{"test"}})
+	require.NoError(t, err)
+	sub, err := client.Subscribe(context.Background(), "task", infoCh, "progress", "test")
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	// the state is sent until the task terminated
+	select {
+	case info := <-infoCh:
+		assert.Equal(t, "test", info.Name)
+		assert.Equal(t, StatusFinished, info.Status)
+		assert.Equal(t, uint64(2), info.Progress)
+	case err := <-sub.Err():
+		t.Fatal(err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("no progress notification")
+	}
+	select {
+	case info := <-infoCh:
+		t.Fatalf("notified after the task terminated: %v", info)
+	case <-time.After(2 * taskProgressInterval):
+	}
+}
+
+func TestTaskRecordEncoding(t *testing.T) {
+	for status := StatusPending; status <= StatusFailed; status++ {
+		data, err := json.Marshal(status)
+		require.NoError(t, err)
+		assert.Equal(t, `"`+status.String()+`"`, string(data))
+		var decoded TaskStatus
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, status, decoded)
+	}
+	var status TaskStatus
+	assert.ErrorContains(t, json.Unmarshal([]byte(`"done"`), &status), `unknown task status "done"`)
+
+	record := &TaskRecord{Name: "test", Kind: reexecTaskKind, Options: json.RawMessage(`{"name":"test"}`), Status: StatusFailed, Progress: 10, Error: "failed"}
+	data, err := json.Marshal(record)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"status":"failed"`)
+	decoded := new(TaskRecord)
+	require.NoError(t, json.Unmarshal(data, decoded))
+	assert.Equal(t, record, decoded)
+	assert.Equal(t, &TaskInfo{Name: "test", Kind: reexecTaskKind, Status: StatusFailed, Progress: 10, Error: "failed"}, recordInfo(decoded))
+
+	for status, terminated := range map[TaskStatus]bool{StatusPending: false, StatusRunning: false, StatusPaused: false, StatusStopped: true, StatusFinished: true, StatusFailed: true} {
+		assert.Equal(t, terminated, status.isTerminated(), status.String())
+	}
+}
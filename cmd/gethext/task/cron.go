@@ -0,0 +1,149 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMaxSteps bounds the search of the next activation time of an expression which never matches, e.g 30th of February
+const cronMaxSteps = 100000
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField is the set of values matched by a field of a cron expression
+type cronField struct {
+	bits uint64
+	star bool // Whether the field matches every value
+}
+
+func (f cronField) match(val int) bool {
+	return f.bits&(1<<uint(val)) != 0
+}
+
+// cronExpr is a parsed standard 5-field cron expression: minute, hour, day of month, month and day of week
+type cronExpr struct {
+	minute, hour, dom, month, dow cronField
+}
+
+func parseCronField(field string, min, max int) (cronField, error) {
+	var ret cronField
+	for _, part := range strings.Split(field, ",") {
+		var (
+			rangeExpr = part
+			step      = 1
+			err       error
+		)
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			rangeExpr = part[:idx]
+			if step, err = strconv.Atoi(part[idx+1:]); err != nil || step <= 0 {
+				return ret, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+		lo, hi := min, max
+		switch {
+		case rangeExpr == "*":
+			if step == 1 {
+				ret.star = true
+			}
+		case strings.Contains(rangeExpr, "-"):
+			bounds := strings.SplitN(rangeExpr, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return ret, fmt.Errorf("invalid range %q", part)
+			}
+			if hi, err = strconv.Atoi(bounds[1]); err != nil {
+				return ret, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			if lo, err = strconv.Atoi(rangeExpr); err != nil {
+				return ret, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if strings.Contains(part, "/") {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return ret, fmt.Errorf("value out of range [%d,%d] in %q", min, max, part)
+		}
+		for val := lo; val <= hi; val += step {
+			ret.bits |= 1 << uint(val)
+		}
+	}
+	return ret, nil
+}
+
+// parseCron parses a cron expression, macros like @daily or @hourly are supported
+func parseCron(expr string) (*cronExpr, error) {
+	expr = strings.TrimSpace(expr)
+	if macro, exist := cronMacros[expr]; exist {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields", expr)
+	}
+	var (
+		ret = new(cronExpr)
+		err error
+	)
+	if ret.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if ret.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if ret.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if ret.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if ret.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// both 0 and 7 are sunday
+	if ret.dow.match(7) {
+		ret.dow.bits |= 1
+	}
+	return ret, nil
+}
+
+func (c *cronExpr) matchDay(t time.Time) bool {
+	domMatch := c.dom.match(t.Day())
+	dowMatch := c.dow.match(int(t.Weekday()))
+	if c.dom.star || c.dow.star {
+		return domMatch && dowMatch
+	}
+	// standard cron matches either day field if both are restricted
+	return domMatch || dowMatch
+}
+
+// Next returns the first activation time after t, zero time if there is none
+func (c *cronExpr) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for step := 0; step < cronMaxSteps; step++ {
+		switch {
+		case !c.month.match(int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.hour.match(t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.minute.match(t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,59 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"* * * * *", "@hourly", "*/15 0-6,22 1 1-12/3 1", "0 0 * * 7", " 5 4 * * * "} {
+		_, err := parseCron(expr)
+		assert.NoError(t, err, expr)
+	}
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@every"} {
+		_, err := parseCron(expr)
+		assert.Error(t, err, expr)
+	}
+
+	// both 0 and 7 are sunday
+	cron, err := parseCron("0 0 * * 7")
+	require.NoError(t, err)
+	assert.True(t, cron.dow.match(0))
+}
+
+func TestCronNext(t *testing.T) {
+	start := time.Date(2023, 3, 15, 10, 30, 45, 0, time.UTC) // Wednesday
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2023, 3, 15, 10, 31, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2023, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2023, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2023, 3, 15, 10, 40, 0, 0, time.UTC)},
+		{"30 10 * * *", time.Date(2023, 3, 16, 10, 30, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", time.Date(2023, 3, 16, 9, 0, 0, 0, time.UTC)},
+		{"0 0 * * 0", time.Date(2023, 3, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// restricted day of month and day of week match either day
+		{"0 0 1 * 5", time.Date(2023, 3, 17, 0, 0, 0, 0, time.UTC)},
+		// activations are strictly after the given time
+		{"31 10 15 3 *", time.Date(2023, 3, 15, 10, 31, 0, 0, time.UTC)},
+		{"30 10 15 3 *", time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		cron, err := parseCron(test.expr)
+		require.NoError(t, err, test.expr)
+		assert.Equal(t, test.next, cron.Next(start), test.expr)
+	}
+
+	// an expression which never matches has no activation
+	cron, err := parseCron("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, cron.Next(start).IsZero())
+}
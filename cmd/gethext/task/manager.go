@@ -5,17 +5,26 @@
 package task
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/cmd/gethext/extdb"
+	"github.com/ethereum/go-ethereum/cmd/gethext/reexec"
+	"github.com/ethereum/go-ethereum/cmd/gethext/sink"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 )
 
 const (
 	TaskMaxCount    = 100
 	TaskKillTimeout = 10 * time.Second
+
+	taskCheckpointInterval = 10 * time.Second
 )
 
 var (
@@ -23,6 +32,8 @@ var (
 	ErrTaskAlreadyExists = errors.New("task already exists")
 	ErrTaskNotExists     = errors.New("task does not exist")
 	ErrTaskKillTimedOut  = errors.New("task kill timed out")
+	ErrProcessorExists   = errors.New("processor already registered")
+	ErrNoGasProfile      = errors.New("task does not profile gas")
 )
 
 type TaskStatus uint32
@@ -32,6 +43,8 @@ const (
 	StatusRunning
 	StatusPaused
 	StatusStopped
+	StatusFinished
+	StatusFailed
 )
 
 func (s TaskStatus) String() string {
@@ -39,11 +52,15 @@ func (s TaskStatus) String() string {
 	case StatusPending:
 		return "pending"
 	case StatusRunning:
-		return "runnnig"
+		return "running"
 	case StatusPaused:
 		return "paused"
 	case StatusStopped:
 		return "stopped"
+	case StatusFinished:
+		return "finished"
+	case StatusFailed:
+		return "failed"
 	}
 	return "unknown"
 }
@@ -58,11 +75,194 @@ type Task interface {
 }
 
 type TaskManager struct {
-	tasks    map[string]Task
-	wg       sync.WaitGroup
-	mtx      sync.Mutex
-	quitLock sync.Mutex
-	quitCh   chan struct{}
+	db          ethdb.Database
+	chaindb     ethdb.Database          // Chain database reexec tasks open their state caches on
+	checkpoints *reexec.CheckpointStore // State checkpoints of reexec tasks, nil if checkpointing is disabled
+	blockchain  *core.BlockChain
+	sinks       *sink.Manager // Sinks of reexec processors emitting records
+	tasks       map[string]Task
+	records     map[string]*TaskRecord     // Checkpointed records of persistent tasks, including terminated ones
+	processors  map[string]ReExecProcessor // Named processors which reexec tasks can be created and restored with
+	restorers   map[string]TaskRestorer    // Task restorers by task kind
+	schedules   map[string]*Schedule
+	profilers   map[string]*reexec.GasProfiler // Gas profilers of tasks, kept until the task record is removed
+	wg          sync.WaitGroup
+	mtx         sync.Mutex
+	quitLock    sync.Mutex
+
+	scheduleMtx sync.Mutex
+	quitCh      chan struct{}
+}
+
+// RegisterProcessor registers a named processor so reexec tasks can refer to it by name
+func (tm *TaskManager) RegisterProcessor(name string, proc ReExecProcessor) error {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	if _, exist := tm.processors[name]; exist {
+		return ErrProcessorExists
+	}
+	tm.processors[name] = proc
+	return nil
+}
+
+func (tm *TaskManager) UnregisterProcessor(name string) {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	delete(tm.processors, name)
+}
+
+// RegisterRestorer registers the function to restore tasks of the given kind after restart
+func (tm *TaskManager) RegisterRestorer(kind string, restorer TaskRestorer) {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	tm.restorers[kind] = restorer
+}
+
+// NewReExecTask creates a reexec task with the registered processors listed in opts.ProcessorNames
+func (tm *TaskManager) NewReExecTask(opts *ReExecOptions) (Task, error) {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	taskOpts := *opts
+	taskOpts.Processors = make([]ReExecProcessor, 0, len(opts.ProcessorNames))
+	for _, name := range opts.ProcessorNames {
+		proc, exist := tm.processors[name]
+		if !exist {
+			return nil, fmt.Errorf("processor %s is not registered", name)
+		}
+		taskOpts.Processors = append(taskOpts.Processors, proc)
+	}
+	task, err := NewReExecTask(tm.chaindb, tm.checkpoints, tm.blockchain, &taskOpts)
+	if err != nil {
+		return nil, err
+	}
+	task.sinks = tm.sinks
+	return task, nil
+}
+
+func (tm *TaskManager) writeRecord(record *TaskRecord) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		log.Error("Could not encode task record", "name", record.Name, "error", err)
+		return
+	}
+	extdb.WriteTaskRecord(tm.db, record.Name, data)
+}
+
+// trackProfiler keeps the gas profiler of the task so the profile can be queried after the task terminated
+func (tm *TaskManager) trackProfiler(name string, task Task) {
+	if ptask, ok := task.(interface{ GasProfiler() *reexec.GasProfiler }); ok && ptask.GasProfiler() != nil {
+		tm.profilers[name] = ptask.GasProfiler()
+	}
+}
+
+// GasProfile returns the gas used by contract methods in the given block range of a task
+func (tm *TaskManager) GasProfile(name string, from, to uint64) (*reexec.GasProfile, error) {
+	if from > to {
+		return nil, fmt.Errorf("invalid block range [%d,%d]", from, to)
+	}
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	profiler, exist := tm.profilers[name]
+	if !exist {
+		if _, live := tm.tasks[name]; !live {
+			if _, exist := tm.records[name]; !exist {
+				return nil, ErrTaskNotExists
+			}
+		}
+		return nil, ErrNoGasProfile
+	}
+	return profiler.Profile(from, to), nil
+}
+
+// checkpointTask writes the current state of a persistent task to database with the
+// given status. Tasks which cannot be restored are not checkpointed.
+func (tm *TaskManager) checkpointTask(name string, task Task, status TaskStatus) {
+	ptask, ok := task.(PersistentTask)
+	if !ok {
+		return
+	}
+	options, err := ptask.Options()
+	if err != nil {
+		log.Debug("Task is not persistent", "name", name, "error", err)
+		return
+	}
+	now := time.Now().Unix()
+	record, exist := tm.records[name]
+	if !exist {
+		record = &TaskRecord{Name: name, Created: now}
+		tm.records[name] = record
+	}
+	record.Kind = ptask.Kind()
+	record.Options = options
+	record.Status = status
+	record.Progress = ptask.Progress()
+	record.Error = ""
+	if err := ptask.Err(); err != nil {
+		record.Error = err.Error()
+	}
+	record.Updated = now
+	tm.writeRecord(record)
+}
+
+// prune removes the oldest records of terminated tasks to keep at most TaskMaxCount records
+func (tm *TaskManager) prune() {
+	if len(tm.records) <= TaskMaxCount {
+		return
+	}
+	var terminated []*TaskRecord
+	for name, record := range tm.records {
+		if _, live := tm.tasks[name]; !live && record.Status.isTerminated() {
+			terminated = append(terminated, record)
+		}
+	}
+	sort.Slice(terminated, func(i, j int) bool { return terminated[i].Updated < terminated[j].Updated })
+	for _, record := range terminated {
+		if len(tm.records) <= TaskMaxCount {
+			break
+		}
+		delete(tm.records, record.Name)
+		delete(tm.profilers, record.Name)
+		extdb.DeleteTaskRecord(tm.db, record.Name)
+	}
+}
+
+// watchTask records the final state of the task once it terminated
+func (tm *TaskManager) watchTask(name string, task Task) {
+	task.Wait()
+	select {
+	case <-tm.quitCh:
+		return
+	default:
+	}
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	if tm.tasks[name] != task {
+		return
+	}
+	tm.checkpointTask(name, task, task.Status())
+	delete(tm.tasks, name)
+	if _, exist := tm.records[name]; !exist {
+		delete(tm.profilers, name)
+	}
+	tm.prune()
+}
+
+func (tm *TaskManager) checkpointLoop() {
+	defer tm.wg.Done()
+	ticker := time.NewTicker(taskCheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			tm.mtx.Lock()
+			for name, task := range tm.tasks {
+				tm.checkpointTask(name, task, task.Status())
+			}
+			tm.mtx.Unlock()
+		case <-tm.quitCh:
+			return
+		}
+	}
 }
 
 func (tm *TaskManager) RunTask(name string, task Task) error {
@@ -70,6 +270,12 @@ func (tm *TaskManager) RunTask(name string, task Task) error {
 		return err
 	}
 	go task.Run()
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	if record, exist := tm.records[name]; exist && record.Status == StatusPending {
+		record.Status = StatusRunning
+		tm.writeRecord(record)
+	}
 	return nil
 }
 
@@ -79,28 +285,72 @@ func (tm *TaskManager) AddTask(name string, task Task) error {
 	if _, exist := tm.tasks[name]; exist {
 		return ErrTaskAlreadyExists
 	}
+	if len(tm.tasks) >= TaskMaxCount {
+		return ErrTaskLimitReached
+	}
+	// the new task replaces the record of a terminated task with the same name
+	if _, exist := tm.records[name]; exist {
+		delete(tm.records, name)
+		extdb.DeleteTaskRecord(tm.db, name)
+	}
 	tm.tasks[name] = task
+	delete(tm.profilers, name)
+	tm.trackProfiler(name, task)
+	tm.checkpointTask(name, task, task.Status())
+	tm.prune()
+	go tm.watchTask(name, task)
 	return nil
 }
 
+// abortTasks aborts all tasks at once, then waits at most TaskKillTimeout until all of
+// them terminated
+func abortTasks(tasks map[string]Task) error {
+	for _, task := range tasks {
+		task.Abort()
+	}
+	termCh := make(chan struct{})
+	go func() {
+		for _, task := range tasks {
+			task.Wait()
+		}
+		close(termCh)
+	}()
+	select {
+	case <-time.After(TaskKillTimeout):
+		for name, task := range tasks {
+			if !task.Status().isTerminated() {
+				log.Error(fmt.Sprintf("Could not kill task `%s`", name), "error", ErrTaskKillTimedOut)
+			}
+		}
+		return ErrTaskKillTimedOut
+	case <-termCh:
+		return nil
+	}
+}
+
+// KillTask aborts the task and removes its record. The manager is not locked while
+// waiting for the task to terminate
 func (tm *TaskManager) KillTask(name string) error {
 	tm.mtx.Lock()
-	defer tm.mtx.Unlock()
-	if task, exists := tm.tasks[name]; exists {
-		termCh := make(chan struct{})
-		go func() {
-			task.Abort()
-			task.Wait()
-			termCh <- struct{}{}
-		}()
-		select {
-		case <-time.After(TaskKillTimeout):
-			log.Error(fmt.Sprintf("Could not kill task `%s`", name), "error", ErrTaskKillTimedOut)
-			return ErrTaskKillTimedOut
-		case <-termCh:
-			delete(tm.tasks, name)
+	task, exists := tm.tasks[name]
+	tm.mtx.Unlock()
+	if exists {
+		if err := abortTasks(map[string]Task{name: task}); err != nil {
+			return err
 		}
 	}
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	// a new task may have been added with the same name in the meantime
+	if current, live := tm.tasks[name]; live && current != task {
+		return nil
+	}
+	delete(tm.tasks, name)
+	delete(tm.profilers, name)
+	if _, exist := tm.records[name]; exist {
+		delete(tm.records, name)
+		extdb.DeleteTaskRecord(tm.db, name)
+	}
 	return nil
 }
 
@@ -114,20 +364,129 @@ func (tm *TaskManager) GetTask(name string) (Task, error) {
 	return nil, ErrTaskNotExists
 }
 
+// Records returns the checkpointed records of all persistent tasks ordered by creation time
+func (tm *TaskManager) Records() []TaskRecord {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	ret := make([]TaskRecord, 0, len(tm.records))
+	for _, record := range tm.records {
+		ret = append(ret, *record)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Created < ret[j].Created })
+	return ret
+}
+
+func (tm *TaskManager) restoreTask(record *TaskRecord) (Task, error) {
+	restorer, exist := tm.restorers[record.Kind]
+	if !exist {
+		return nil, fmt.Errorf("unknown task kind %s", record.Kind)
+	}
+	return restorer(record)
+}
+
+// Start restores tasks from their records, running and pending tasks are run, paused tasks stay paused.
+// Persisted schedules are loaded and triggered from then on.
+func (tm *TaskManager) Start() error {
+	tm.restoreTasks()
+	tm.wg.Add(1)
+	go tm.checkpointLoop()
+
+	tm.loadSchedules()
+	tm.wg.Add(1)
+	go tm.scheduleLoop()
+	return nil
+}
+
+func (tm *TaskManager) restoreTasks() {
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	for _, data := range extdb.ReadAllTaskRecords(tm.db) {
+		record := new(TaskRecord)
+		if err := json.Unmarshal(data, record); err != nil {
+			log.Error("Invalid task record", "error", err)
+			continue
+		}
+		tm.records[record.Name] = record
+	}
+	for name, record := range tm.records {
+		if record.Status.isTerminated() {
+			continue
+		}
+		task, err := tm.restoreTask(record)
+		if err != nil {
+			log.Error("Could not restore task", "name", name, "error", err)
+			record.Status = StatusFailed
+			record.Error = err.Error()
+			record.Updated = time.Now().Unix()
+			tm.writeRecord(record)
+			continue
+		}
+		if record.Status == StatusPaused {
+			task.Pause()
+		}
+		tm.tasks[name] = task
+		tm.trackProfiler(name, task)
+		go tm.watchTask(name, task)
+		// pending tasks are queued again, paused tasks wait to be resumed
+		go task.Run()
+		log.Info("Restored task", "name", name, "kind", record.Kind, "status", record.Status, "progress", record.Progress)
+	}
+	tm.prune()
+}
+
 func (tm *TaskManager) Stop() {
 	tm.quitLock.Lock()
 	defer tm.quitLock.Unlock()
 	close(tm.quitCh)
-	for taskName := range tm.tasks {
-		tm.KillTask(taskName)
-	}
 	tm.wg.Wait()
+
+	// keep the status before aborting so the tasks are restored on next start
+	tm.mtx.Lock()
+	tasks := make(map[string]Task, len(tm.tasks))
+	statuses := make(map[string]TaskStatus, len(tm.tasks))
+	for name, task := range tm.tasks {
+		tasks[name], statuses[name] = task, task.Status()
+	}
+	tm.mtx.Unlock()
+	abortTasks(tasks)
+
+	tm.mtx.Lock()
+	defer tm.mtx.Unlock()
+	for name, task := range tasks {
+		if tm.tasks[name] != task {
+			continue
+		}
+		status := statuses[name]
+		if final := task.Status(); final == StatusFinished || final == StatusFailed {
+			status = final
+		}
+		tm.checkpointTask(name, task, status)
+	}
 	log.Info("TaskManager stopped")
 }
 
-func NewTaskManager() (*TaskManager, error) {
-	return &TaskManager{
-		tasks:  make(map[string]Task),
-		quitCh: make(chan struct{}),
-	}, nil
+func NewTaskManager(db ethdb.Database, chaindb ethdb.Database, checkpoints *reexec.CheckpointStore, bc *core.BlockChain, sinks *sink.Manager) (*TaskManager, error) {
+	tm := &TaskManager{
+		db:          db,
+		chaindb:     chaindb,
+		checkpoints: checkpoints,
+		blockchain:  bc,
+		sinks:       sinks,
+		tasks:       make(map[string]Task),
+		records:     make(map[string]*TaskRecord),
+		processors:  make(map[string]ReExecProcessor),
+		restorers:   make(map[string]TaskRestorer),
+		schedules:   make(map[string]*Schedule),
+		profilers:   make(map[string]*reexec.GasProfiler),
+		quitCh:      make(chan struct{}),
+	}
+	tm.restorers[reexecTaskKind] = func(record *TaskRecord) (Task, error) {
+		task, err := restoreReExecTask(chaindb, checkpoints, bc, record, tm.processors)
+		if err != nil {
+			return nil, err
+		}
+		task.sinks = sinks
+		return task, nil
+	}
+	return tm, nil
 }
@@ -0,0 +1,230 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/gethext/extdb"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// barrierTask terminates once all tasks sharing its barrier were aborted
+type barrierTask struct {
+	barrier *sync.WaitGroup
+	once    sync.Once
+	aborted chan struct{}
+}
+
+func newBarrierTasks(n int) []*barrierTask {
+	barrier := new(sync.WaitGroup)
+	barrier.Add(n)
+	tasks := make([]*barrierTask, n)
+	for i := range tasks {
+		tasks[i] = &barrierTask{barrier: barrier, aborted: make(chan struct{})}
+	}
+	return tasks
+}
+
+func (t *barrierTask) Status() TaskStatus {
+	select {
+	case <-t.aborted:
+		return StatusStopped
+	default:
+		return StatusRunning
+	}
+}
+
+func (t *barrierTask) Run()    {}
+func (t *barrierTask) Wait()   { t.barrier.Wait() }
+func (t *barrierTask) Pause()  {}
+func (t *barrierTask) Resume() {}
+
+func (t *barrierTask) Abort() {
+	t.once.Do(func() {
+		close(t.aborted)
+		t.barrier.Done()
+	})
+}
+
+func runTestTask(t *testing.T, tm *TaskManager, opts ReExecOptions, paused bool) *reexecTask {
+	task, err := tm.NewReExecTask(&opts)
+	require.NoError(t, err)
+	if paused {
+		task.Pause()
+	}
+	require.NoError(t, tm.RunTask(opts.Name, task))
+	return task.(*reexecTask)
+}
+
+func taskRecord(t *testing.T, tm *TaskManager, name string) (*TaskRecord, *ReExecOptions) {
+	data := extdb.ReadTaskRecord(tm.db, name)
+	require.NotEmpty(t, data, name)
+	record := new(TaskRecord)
+	require.NoError(t, json.Unmarshal(data, record))
+	opts := new(ReExecOptions)
+	require.NoError(t, json.Unmarshal(record.Options, opts))
+	return record, opts
+}
+
+func TestTaskManagerRestore(t *testing.T) {
+	db, chain := newTestChain(t, 4)
+	tm, err := NewTaskManager(rawdb.NewMemoryDatabase(), db, nil, chain, nil)
+	require.NoError(t, err)
+	require.NoError(t, tm.RegisterProcessor("test", &testProcessor{}))
+	require.NoError(t, tm.RegisterProcessor("other", &testProcessor{}))
+	require.NoError(t, tm.RegisterProcessor("queued", &testProcessor{}))
+	assert.ErrorIs(t, tm.RegisterProcessor("test", &testProcessor{}), ErrProcessorExists)
+	require.NoError(t, tm.Start())
+
+	runTestTask(t, tm, ReExecOptions{Name: "finished", StartBlock: 1, EndBlock: 2, ProcessorNames: []string{"test"}}, false)
+	waitFinished(t, tm, "finished")
+
+	// the task following the chain head waits for the next block
+	running := runTestTask(t, tm, ReExecOptions{Name: "running", ProcessorNames: []string{"test"}}, false)
+	require.Eventually(t, func() bool { return running.CurrentBlock() == 4 }, 10*time.Second, 10*time.Millisecond)
+	runTestTask(t, tm, ReExecOptions{Name: "paused", StartBlock: 1, EndBlock: 4, ProcessorNames: []string{"test"}}, true)
+	runTestTask(t, tm, ReExecOptions{Name: "orphan", StartBlock: 1, EndBlock: 4, ProcessorNames: []string{"other"}}, true)
+	pending, err := tm.NewReExecTask(&ReExecOptions{Name: "pending", StartBlock: 1, EndBlock: 4, ProcessorNames: []string{"queued"}})
+	require.NoError(t, err)
+	require.NoError(t, tm.AddTask("pending", pending))
+
+	// tasks with unnamed processors can not be restored
+	task, err := NewReExecTask(db, nil, chain, &ReExecOptions{Name: "unnamed", StartBlock: 1, EndBlock: 4, Processors: []ReExecProcessor{&testProcessor{}}})
+	require.NoError(t, err)
+	task.Pause()
+	require.NoError(t, tm.RunTask("unnamed", task))
+	tm.Stop()
+
+	// the tasks are checkpointed with their status before they were stopped
+	record, _ := taskRecord(t, tm, "finished")
+	assert.Equal(t, StatusFinished, record.Status)
+	assert.Equal(t, uint64(2), record.Progress)
+	record, opts := taskRecord(t, tm, "running")
+	assert.Equal(t, StatusRunning, record.Status)
+	assert.Equal(t, uint64(4), record.Progress)
+	assert.Equal(t, uint64(4), opts.StartBlock)
+	record, _ = taskRecord(t, tm, "paused")
+	assert.Equal(t, StatusPaused, record.Status)
+	assert.Zero(t, record.Progress)
+	record, _ = taskRecord(t, tm, "pending")
+	assert.Equal(t, StatusPending, record.Status)
+	assert.Empty(t, extdb.ReadTaskRecord(tm.db, "unnamed"))
+
+	proc := &testProcessor{}
+	restored, err := NewTaskManager(tm.db, db, nil, chain, nil)
+	require.NoError(t, err)
+	require.NoError(t, restored.RegisterProcessor("test", proc))
+	queued := &testProcessor{}
+	require.NoError(t, restored.RegisterProcessor("queued", queued))
+	require.NoError(t, restored.Start())
+	defer restored.Stop()
+
+	// running tasks continue after their progress, pending tasks are run, paused tasks stay paused
+	waitTaskStatus(t, &TaskAPI{restored}, "running", StatusRunning)
+	waitFinished(t, restored, "pending")
+	assert.Equal(t, []uint64{1, 2, 3, 4}, queued.processed())
+	info, err := restored.TaskInfo("running")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), info.Progress)
+	paused, err := restored.GetTask("paused")
+	require.NoError(t, err)
+	assert.Equal(t, StatusPaused, paused.Status())
+	assert.Empty(t, proc.processed())
+	paused.Resume()
+	waitFinished(t, restored, "paused")
+	assert.Equal(t, []uint64{1, 2, 3, 4}, proc.processed())
+
+	// terminated tasks are kept as records, tasks which can not be restored fail
+	_, err = restored.GetTask("finished")
+	assert.ErrorIs(t, err, ErrTaskNotExists)
+	info, err = restored.TaskInfo("finished")
+	require.NoError(t, err)
+	assert.Equal(t, StatusFinished, info.Status)
+	info, err = restored.TaskInfo("orphan")
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, info.Status)
+	assert.Equal(t, "processor other is not registered", info.Error)
+	assert.Len(t, restored.Records(), 5)
+}
+
+func TestTaskManagerKill(t *testing.T) {
+	db, chain := newTestChain(t, 1)
+	tm, err := NewTaskManager(rawdb.NewMemoryDatabase(), db, nil, chain, nil)
+	require.NoError(t, err)
+	tasks := newBarrierTasks(2)
+	require.NoError(t, tm.AddTask("a", tasks[0]))
+	require.NoError(t, tm.AddTask("b", tasks[1]))
+
+	// the manager is usable while a killed task is terminating
+	killed := make(chan error, 1)
+	go func() { killed <- tm.KillTask("a") }()
+	<-tasks[0].aborted
+	_, err = tm.GetTask("b")
+	require.NoError(t, err)
+	require.NoError(t, tm.KillTask("b"))
+	require.NoError(t, <-killed)
+	_, err = tm.GetTask("a")
+	assert.ErrorIs(t, err, ErrTaskNotExists)
+}
+
+func TestTaskManagerStop(t *testing.T) {
+	db, chain := newTestChain(t, 1)
+	tm, err := NewTaskManager(rawdb.NewMemoryDatabase(), db, nil, chain, nil)
+	require.NoError(t, err)
+	require.NoError(t, tm.Start())
+	tasks := newBarrierTasks(3)
+	for i, task := range tasks {
+		require.NoError(t, tm.AddTask(fmt.Sprintf("task%d", i), task))
+	}
+
+	// all tasks are aborted before waiting for them
+	start := time.Now()
+	tm.Stop()
+	assert.Less(t, time.Since(start), TaskKillTimeout)
+}
+
+func TestTaskManagerPrune(t *testing.T) {
+	db, chain := newTestChain(t, 1)
+	tm, err := NewTaskManager(rawdb.NewMemoryDatabase(), db, nil, chain, nil)
+	require.NoError(t, err)
+	for i := 0; i < TaskMaxCount+5; i++ {
+		record := &TaskRecord{Name: fmt.Sprintf("task%d", i), Kind: reexecTaskKind, Status: StatusFinished, Updated: int64(i)}
+		if i == 0 {
+			record.Status = StatusPaused
+		}
+		tm.records[record.Name] = record
+		tm.writeRecord(record)
+	}
+	tm.prune()
+
+	// the oldest terminated records are removed, records of live tasks are kept
+	assert.Len(t, tm.records, TaskMaxCount)
+	assert.Len(t, extdb.ReadAllTaskRecords(tm.db), TaskMaxCount)
+	assert.Contains(t, tm.records, "task0")
+	for i := 1; i <= 5; i++ {
+		assert.NotContains(t, tm.records, fmt.Sprintf("task%d", i))
+	}
+	assert.Contains(t, tm.records, "task6")
+}
+
+func TestReExecTaskOptionsWhileRunning(t *testing.T) {
+	db, chain := newTestChain(t, 2)
+	task, err := NewReExecTask(db, nil, chain, &ReExecOptions{Name: "test", ProcessorNames: []string{"test"}, Processors: []ReExecProcessor{&testProcessor{}}})
+	require.NoError(t, err)
+
+	// the task is checkpointed while it resolves the start block
+	go task.Run()
+	defer task.Abort()
+	require.Eventually(t, func() bool {
+		data, err := task.Options()
+		require.NoError(t, err)
+		opts := new(ReExecOptions)
+		require.NoError(t, json.Unmarshal(data, opts))
+		return opts.StartBlock == 2
+	}, 10*time.Second, time.Millisecond)
+}
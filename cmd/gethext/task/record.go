@@ -0,0 +1,49 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// TaskRecord is the state of a task checkpointed in the extension database
+type TaskRecord struct {
+	Name     string          `json:"name"`
+	Kind     string          `json:"kind"`            // Kind of the task, used to find the restorer
+	Options  json.RawMessage `json:"options"`         // Encoded options the task was created with
+	Status   TaskStatus      `json:"status"`          // Last known status of the task
+	Progress uint64          `json:"progress"`        // Progress cursor, e.g the last completed block
+	Error    string          `json:"error,omitempty"` // Error that caused the task to fail
+	Created  int64           `json:"created"`         // Unix timestamp the task was added
+	Updated  int64           `json:"updated"`         // Unix timestamp of the last checkpoint
+}
+
+// PersistentTask is implemented by tasks that can be checkpointed and restored after restart
+type PersistentTask interface {
+	Task
+	Kind() string
+	Options() (json.RawMessage, error)
+	Progress() uint64
+	Err() error
+}
+
+// TaskRestorer recreates a task of a kind from its record
+type TaskRestorer func(record *TaskRecord) (Task, error)
+
+func (s TaskStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *TaskStatus) UnmarshalText(text []byte) error {
+	for status := StatusPending; status <= StatusFailed; status++ {
+		if status.String() == string(text) {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown task status %q", text)
+}
+
+// isTerminated returns whether the task reached a final status
+func (s TaskStatus) isTerminated() bool {
+	return s == StatusStopped || s == StatusFinished || s == StatusFailed
+}
@@ -7,38 +7,277 @@
 package task
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/cmd/gethext/reexec"
+	"github.com/ethereum/go-ethereum/cmd/gethext/sink"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	reexecTaskKind      = "reexec"
+	reexecTriesInMemory = 128
+	reexecTrieCache     = 128 // Memory allowance (MB) for trie nodes cache of the state cache of a task
 )
 
+var _ PersistentTask = (*reexecTask)(nil)
+
 type ReExecProcessor interface {
 	ProcessTx(state *state.StateDB, block *types.Block, txIndex int) error
 }
 
 type ReExecOptions struct {
-	Name       string
-	NoState    bool              // Disable state generation
-	StartBlock uint64            // Starting block number to process. If not provided, latest block will used instead.
-	EndBlock   uint64            // Ending block number to process. If not provided, task keep processing every new block.
-	Processors []ReExecProcessor // List of processors to process the transactions
+	Name           string            `json:"name"`
+	NoState        bool              `json:"noState"`                  // Disable state generation
+	StartBlock     uint64            `json:"startBlock"`               // Starting block number to process. If not provided, latest block will used instead.
+	EndBlock       uint64            `json:"endBlock"`                 // Ending block number to process. If not provided, task keep processing every new block.
+	ProcessorNames []string          `json:"processors"`               // Names of the processors registered in TaskManager, required to restore the task after restart
+	Processors     []ReExecProcessor `json:"-"`                        // List of processors to process the transactions
+	GasProfile     bool              `json:"gasProfile"`               // Attribute gas used by replayed transactions to the called contract methods
+	ProfileWindow  uint64            `json:"profileWindow,omitempty"`  // Number of blocks gas usage is aggregated over, the default window is used if zero
+	ProfileWindows int               `json:"profileWindows,omitempty"` // Number of most recent windows kept, the default retention is used if zero
+}
+
+// processorHook calls the reexec processors with the state after each transaction was replayed
+type processorHook struct {
+	processors []ReExecProcessor
+	profiler   *reexec.GasProfiler // Optional profiler of the replayed transactions
+	err        error               // First error returned by processors
+}
+
+func (h *processorHook) OnTxStart(ctx *reexec.Context, gasLimit uint64) {
+	if h.profiler != nil {
+		h.profiler.OnTxStart(ctx, gasLimit)
+	}
+}
+
+func (h *processorHook) OnCallEnter(ctx *reexec.Context, call *reexec.CallFrame) {}
+
+func (h *processorHook) OnCallExit(ctx *reexec.Context, call *reexec.CallFrame) {}
+
+func (h *processorHook) OnTxEnd(ctx *reexec.Context, ret *reexec.TxResult, restGas uint64) {
+	if h.profiler != nil {
+		h.profiler.OnTxEnd(ctx, ret, restGas)
+	}
+	if h.err != nil {
+		return
+	}
+	txIndex, _ := ctx.Transaction()
+	for _, proc := range h.processors {
+		if err := proc.ProcessTx(ctx.State(), ctx.Block(), txIndex); err != nil {
+			h.err = err
+			return
+		}
+	}
+}
+
+func (h *processorHook) OnBlockCommit(ctx *reexec.Context) {
+	if h.profiler != nil {
+		h.profiler.OnBlockCommit(ctx)
+	}
+}
+
+func (h *processorHook) OnBlockDiscard(ctx *reexec.Context, report *reexec.DivergenceReport) {
+	if h.profiler != nil {
+		h.profiler.OnBlockDiscard(ctx, report)
+	}
 }
 
 // reexecTask re-execute transactions to get blockchain state and
 // call registered processor to analyze the transactions
 type reexecTask struct {
 	*ReExecOptions
+	blockchain   *core.BlockChain
+	replayer     *reexec.ChainReplayer
+	sinks        *sink.Manager       // Optional sinks of processors emitting records
+	profiler     *reexec.GasProfiler // Gas profiler of the replayed blocks, nil if profiling is disabled
 	stateCache   *state.StateDB
-	currentBlock uint64
-	status       uint64
-	termCh       chan struct{}
+	currentBlock uint64 // Last processed block number, accessed atomically
+	status       uint32 // Current TaskStatus, accessed atomically
+	started      uint32 // Whether the task was run or aborted, accessed atomically
+	err          error  // Error that caused the task to fail
+
+	resumeCh chan struct{} // Closed on resume, nil if the task is not paused
+	ctx      context.Context
+	cancel   context.CancelFunc
+	termCh   chan struct{}
+	termOnce sync.Once
+	mtx      sync.Mutex
+}
+
+func (t *reexecTask) setStatus(status TaskStatus) {
+	atomic.StoreUint32(&t.status, uint32(status))
+}
+
+func (t *reexecTask) Status() TaskStatus {
+	return TaskStatus(atomic.LoadUint32(&t.status))
+}
+
+// CurrentBlock returns the number of the last processed block
+func (t *reexecTask) CurrentBlock() uint64 {
+	return atomic.LoadUint64(&t.currentBlock)
+}
+
+func (t *reexecTask) Kind() string {
+	return reexecTaskKind
+}
+
+// GasProfiler returns the gas profiler of the task, nil if the task does not profile gas
+func (t *reexecTask) GasProfiler() *reexec.GasProfiler {
+	return t.profiler
+}
+
+// Options returns the encoded task options, the task can only be restored if all
+// of its processors are registered by name
+func (t *reexecTask) Options() (json.RawMessage, error) {
+	if len(t.ProcessorNames) != len(t.Processors) {
+		return nil, errors.New("task has unnamed processors")
+	}
+	// the start block is resolved by Run while the task may be checkpointed
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return json.Marshal(t.ReExecOptions)
 }
 
-func (t *reexecTask) Status() uint64 {
-	return 0
+// Progress returns the last processed block number
+func (t *reexecTask) Progress() uint64 {
+	return t.CurrentBlock()
 }
 
-func (t *reexecTask) Run() error {
-	return nil
+// Err returns the error that caused the task to fail
+func (t *reexecTask) Err() error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.err
+}
+
+func (t *reexecTask) terminate(status TaskStatus, err error) {
+	t.mtx.Lock()
+	t.err = err
+	t.mtx.Unlock()
+	t.setStatus(status)
+	t.termOnce.Do(func() { close(t.termCh) })
+}
+
+// waitResume blocks while the task is paused, returns false if the task was aborted
+func (t *reexecTask) waitResume() bool {
+	t.mtx.Lock()
+	resumeCh := t.resumeCh
+	t.mtx.Unlock()
+	if resumeCh != nil {
+		select {
+		case <-resumeCh:
+		case <-t.ctx.Done():
+			return false
+		}
+	}
+	return t.ctx.Err() == nil
+}
+
+// waitBlock returns the block with given number, waits for new chain heads if the block is not imported yet
+func (t *reexecTask) waitBlock(number uint64) *types.Block {
+	if block := t.blockchain.GetBlockByNumber(number); block != nil {
+		return block
+	}
+	headCh := make(chan core.ChainHeadEvent, 1)
+	headSub := t.blockchain.SubscribeChainHeadEvent(headCh)
+	defer headSub.Unsubscribe()
+	for {
+		if block := t.blockchain.GetBlockByNumber(number); block != nil {
+			return block
+		}
+		select {
+		case <-headCh:
+		case <-t.ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (t *reexecTask) processBlock(block *types.Block) error {
+	if t.NoState {
+		for txIndex := range block.Transactions() {
+			for _, proc := range t.Processors {
+				if err := proc.ProcessTx(nil, block, txIndex); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	hook := &processorHook{processors: t.Processors, profiler: t.profiler}
+	statedb, err := t.replayer.ReplayBlock(t.ctx, block, t.stateCache, hook)
+	if err != nil {
+		t.stateCache = nil
+		return err
+	}
+	t.stateCache = statedb
+	t.replayer.CapTrieDB(reexecTriesInMemory)
+	return hook.err
+}
+
+func (t *reexecTask) Run() {
+	if !atomic.CompareAndSwapUint32(&t.started, 0, 1) {
+		return
+	}
+	// the task may be paused before it started
+	atomic.CompareAndSwapUint32(&t.status, uint32(StatusPending), uint32(StatusRunning))
+	defer func() {
+		t.stateCache = nil
+		t.replayer.Reset()
+	}()
+	if t.StartBlock == 0 {
+		t.mtx.Lock()
+		t.StartBlock = t.blockchain.CurrentBlock().NumberU64()
+		t.mtx.Unlock()
+	}
+	for _, proc := range t.Processors {
+		if err := t.sinks.Attach(proc); err != nil {
+			t.terminate(StatusFailed, fmt.Errorf("open sink failed: %w", err))
+			return
+		}
+	}
+	start := t.StartBlock
+	if current := t.CurrentBlock(); current >= start {
+		start = current + 1
+	}
+	log.Info("Reexec task started", "name", t.Name, "from", start, "to", t.EndBlock, "nostate", t.NoState)
+	for number := start; t.EndBlock == 0 || number <= t.EndBlock; number++ {
+		if !t.waitResume() {
+			break
+		}
+		block := t.waitBlock(number)
+		if block == nil {
+			break
+		}
+		if err := t.processBlock(block); err != nil {
+			if t.ctx.Err() != nil {
+				break
+			}
+			log.Error("Reexec task failed", "name", t.Name, "number", number, "error", err)
+			t.terminate(StatusFailed, fmt.Errorf("process block #%d failed: %w", number, err))
+			return
+		}
+		t.sinks.Flush()
+		atomic.StoreUint64(&t.currentBlock, number)
+	}
+	if t.ctx.Err() != nil {
+		log.Info("Reexec task aborted", "name", t.Name, "current", t.CurrentBlock())
+		t.terminate(StatusStopped, nil)
+		return
+	}
+	log.Info("Reexec task finished", "name", t.Name, "current", t.CurrentBlock())
+	t.terminate(StatusFinished, nil)
 }
 
 func (t *reexecTask) Wait() {
@@ -46,20 +285,85 @@ func (t *reexecTask) Wait() {
 }
 
 func (t *reexecTask) Pause() {
-	close(t.termCh)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if status := t.Status(); status != StatusRunning && status != StatusPending {
+		return
+	}
+	t.resumeCh = make(chan struct{})
+	t.setStatus(StatusPaused)
 }
 
 func (t *reexecTask) Resume() {
-	close(t.termCh)
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.Status() != StatusPaused {
+		return
+	}
+	close(t.resumeCh)
+	t.resumeCh = nil
+	t.setStatus(StatusRunning)
 }
 
 func (t *reexecTask) Abort() {
-	close(t.termCh)
+	t.cancel()
+	// a task that has not been started never runs
+	if atomic.CompareAndSwapUint32(&t.started, 0, 1) {
+		t.terminate(StatusStopped, nil)
+	}
 }
 
-func NewReExecTask(opts *ReExecOptions) *reexecTask {
+// restoreReExecTask recreates a reexec task from its record, processing continues from the block after the progress cursor
+func restoreReExecTask(chaindb ethdb.Database, checkpoints *reexec.CheckpointStore, bc *core.BlockChain, record *TaskRecord, processors map[string]ReExecProcessor) (*reexecTask, error) {
+	opts := new(ReExecOptions)
+	if err := json.Unmarshal(record.Options, opts); err != nil {
+		return nil, err
+	}
+	for _, name := range opts.ProcessorNames {
+		proc, exist := processors[name]
+		if !exist {
+			return nil, fmt.Errorf("processor %s is not registered", name)
+		}
+		opts.Processors = append(opts.Processors, proc)
+	}
+	task, err := NewReExecTask(chaindb, checkpoints, bc, opts)
+	if err != nil {
+		return nil, err
+	}
+	task.currentBlock = record.Progress
+	return task, nil
+}
+
+// NewReExecTask creates a reexec task, the task replays blocks with its own state cache
+// on top of the chain database so it does not evict the tries of the live chain. If
+// checkpoints is not nil, the state cache is layered on the checkpoint store instead
+func NewReExecTask(chaindb ethdb.Database, checkpoints *reexec.CheckpointStore, bc *core.BlockChain, opts *ReExecOptions) (*reexecTask, error) {
+	if opts.EndBlock != 0 && opts.StartBlock > opts.EndBlock {
+		return nil, fmt.Errorf("invalid block range [%d,%d]", opts.StartBlock, opts.EndBlock)
+	}
+	if opts.StartBlock == 0 && opts.EndBlock != 0 {
+		return nil, errors.New("start block is required if end block is provided")
+	}
+	if opts.GasProfile && opts.NoState {
+		return nil, errors.New("gas profile requires replaying the state")
+	}
+	replayer := reexec.NewChainReplayer(state.NewDatabaseWithConfig(chaindb, &trie.Config{Cache: reexecTrieCache}), bc)
+	if checkpoints != nil {
+		replayer = reexec.NewChainReplayerWithCheckpoints(checkpoints, bc)
+	}
+	var profiler *reexec.GasProfiler
+	if opts.GasProfile {
+		profiler = reexec.NewGasProfiler(opts.ProfileWindow, opts.ProfileWindows)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &reexecTask{
 		ReExecOptions: opts,
+		blockchain:    bc,
+		replayer:      replayer,
+		profiler:      profiler,
+		status:        uint32(StatusPending),
+		ctx:           ctx,
+		cancel:        cancel,
 		termCh:        make(chan struct{}),
-	}
+	}, nil
 }
@@ -0,0 +1,175 @@
+package task
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddress = crypto.PubkeyToAddress(testKey.PublicKey)
+)
+
+// newTestChain returns an archive chain of n blocks with a transfer in every block
+func newTestChain(t *testing.T, n int) (ethdb.Database, *core.BlockChain) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		engine = ethash.NewFaker()
+		gspec  = &core.Genesis{
+			Config: params.TestChainConfig,
+			Alloc:  core.GenesisAlloc{testAddress: {Balance: big.NewInt(params.Ether)}},
+		}
+		genesis = gspec.MustCommit(db)
+		signer  = types.HomesteadSigner{}
+	)
+	blocks, _ := core.GenerateChain(gspec.Config, genesis, engine, db, n, func(i int, b *core.BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(b.TxNonce(testAddress), common.Address{0x01}, big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, testKey)
+		require.NoError(t, err)
+		b.AddTx(tx)
+	})
+	cacheConfig := &core.CacheConfig{
+		TrieCleanLimit:    256,
+		TrieDirtyLimit:    256,
+		TrieTimeLimit:     5 * time.Minute,
+		TriesInMemory:     128,
+		TrieDirtyDisabled: true,
+	}
+	chain, err := core.NewBlockChain(db, cacheConfig, gspec.Config, engine, vm.Config{}, nil, nil)
+	require.NoError(t, err)
+	_, err = chain.InsertChain(blocks)
+	require.NoError(t, err)
+	t.Cleanup(chain.Stop)
+	return db, chain
+}
+
+// testProcessor records the blocks of processed transactions, if gate is set every
+// call signals entered then waits for the gate
+type testProcessor struct {
+	blocks  []uint64
+	entered chan struct{}
+	gate    chan struct{}
+	mtx     sync.Mutex
+}
+
+func (p *testProcessor) ProcessTx(state *state.StateDB, block *types.Block, txIndex int) error {
+	if p.gate != nil {
+		p.entered <- struct{}{}
+		<-p.gate
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	p.blocks = append(p.blocks, block.NumberU64())
+	return nil
+}
+
+func (p *testProcessor) processed() []uint64 {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	return append([]uint64{}, p.blocks...)
+}
+
+func waitTerminated(t *testing.T, task *reexecTask) {
+	select {
+	case <-task.termCh:
+	case <-time.After(10 * time.Second):
+		t.Fatal("task did not terminate")
+	}
+}
+
+func TestReExecTaskOwnStateCache(t *testing.T) {
+	db, chain := newTestChain(t, 4)
+	proc := &testProcessor{}
+	task, err := NewReExecTask(db, nil, chain, &ReExecOptions{Name: "test", StartBlock: 1, EndBlock: 4, Processors: []ReExecProcessor{proc}})
+	require.NoError(t, err)
+	assert.NotEqual(t, chain.StateCache(), task.replayer.StateCache())
+
+	task.Run()
+	assert.Equal(t, StatusFinished, task.Status())
+	assert.Equal(t, []uint64{1, 2, 3, 4}, proc.processed())
+	assert.Equal(t, uint64(4), task.CurrentBlock())
+
+	// the live chain state is still readable after the task reset its cache
+	_, err = chain.StateAt(chain.CurrentBlock().Root())
+	assert.NoError(t, err)
+}
+
+func TestReExecTaskPauseResume(t *testing.T) {
+	db, chain := newTestChain(t, 4)
+	proc := &testProcessor{entered: make(chan struct{}), gate: make(chan struct{})}
+	task, err := NewReExecTask(db, nil, chain, &ReExecOptions{Name: "test", StartBlock: 1, EndBlock: 4, Processors: []ReExecProcessor{proc}})
+	require.NoError(t, err)
+	go task.Run()
+
+	// pause while the first block is processed, the task stops after the block
+	<-proc.entered
+	task.Pause()
+	assert.Equal(t, StatusPaused, task.Status())
+	proc.gate <- struct{}{}
+	select {
+	case <-proc.entered:
+		t.Fatal("paused task processed the next block")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Equal(t, uint64(1), task.CurrentBlock())
+
+	task.Resume()
+	assert.Equal(t, StatusRunning, task.Status())
+	close(proc.gate)
+	go func() {
+		for range proc.entered {
+		}
+	}()
+	waitTerminated(t, task)
+	close(proc.entered)
+	assert.Equal(t, StatusFinished, task.Status())
+	assert.Equal(t, []uint64{1, 2, 3, 4}, proc.processed())
+}
+
+func TestReExecTaskAbort(t *testing.T) {
+	db, chain := newTestChain(t, 2)
+
+	// following the chain head, the task waits for new blocks until aborted
+	proc := &testProcessor{}
+	task, err := NewReExecTask(db, nil, chain, &ReExecOptions{Name: "test", StartBlock: 1, Processors: []ReExecProcessor{proc}})
+	require.NoError(t, err)
+	go task.Run()
+	require.Eventually(t, func() bool { return task.CurrentBlock() == 2 }, 10*time.Second, 10*time.Millisecond)
+	task.Abort()
+	waitTerminated(t, task)
+	assert.Equal(t, StatusStopped, task.Status())
+	assert.NoError(t, task.Err())
+	assert.Equal(t, []uint64{1, 2}, proc.processed())
+
+	// a paused task is aborted without resuming
+	task, err = NewReExecTask(db, nil, chain, &ReExecOptions{Name: "test", StartBlock: 1, EndBlock: 2, Processors: []ReExecProcessor{proc}})
+	require.NoError(t, err)
+	task.Pause()
+	go task.Run()
+	task.Abort()
+	waitTerminated(t, task)
+	assert.Equal(t, StatusStopped, task.Status())
+
+	// a task aborted before it started never runs
+	proc = &testProcessor{}
+	task, err = NewReExecTask(db, nil, chain, &ReExecOptions{Name: "test", StartBlock: 1, EndBlock: 2, Processors: []ReExecProcessor{proc}})
+	require.NoError(t, err)
+	task.Abort()
+	task.Run()
+	assert.Equal(t, StatusStopped, task.Status())
+	assert.Empty(t, proc.processed())
+}
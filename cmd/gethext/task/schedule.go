@@ -0,0 +1,387 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/gethext/extdb"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	scheduleCheckInterval    = time.Second
+	defaultDependencyTimeout = 24 * time.Hour // Time a triggered run waits for its dependencies if the schedule sets no timeout
+)
+
+var (
+	ErrScheduleExists    = errors.New("schedule already exists")
+	ErrScheduleNotExists = errors.New("schedule does not exist")
+)
+
+// Schedule describes when reexec tasks are created from a task template. A schedule
+// is triggered by a cron expression, every N blocks or once at a given time. If no
+// trigger is given, the schedule runs once as soon as its dependencies finished.
+//
+// Dependencies are names of tasks, e.g "snapshot#3" for the third run of a recurring
+// schedule, or names of schedules, which refer to the task of their latest run. A
+// triggered run fails if a dependency does not exist, failed or was stopped, or did not
+// finish within the dependency timeout. A triggered run also fails if the run before it
+// is still in progress when the timeout expires.
+type Schedule struct {
+	Name        string        `json:"name"`
+	Cron        string        `json:"cron,omitempty"`        // Cron expression, e.g "0 0 * * *" or "@hourly"
+	EveryBlocks uint64        `json:"everyBlocks,omitempty"` // Trigger every N blocks
+	At          int64         `json:"at,omitempty"`          // Unix timestamp to run a one-shot task at
+	After       []string      `json:"after,omitempty"`       // Names of the tasks or schedules that must finish successfully before a run starts
+	Timeout     uint64        `json:"timeout,omitempty"`     // Seconds a triggered run waits for its dependencies and the previous run, defaults to a day
+	Blocks      uint64        `json:"blocks,omitempty"`      // If set, each run processes the last N blocks up to the head block
+	Options     ReExecOptions `json:"options"`               // Template options of the created tasks
+
+	Runs         uint64 `json:"runs"`                   // Number of started runs
+	Failures     uint64 `json:"failures"`               // Number of triggered runs which could not start
+	Pending      bool   `json:"pending"`                // Whether a run was triggered and waits for its dependencies
+	PendingSince int64  `json:"pendingSince,omitempty"` // Unix timestamp the pending run was triggered at
+	NextRun      int64  `json:"nextRun,omitempty"`      // Unix timestamp of the next cron activation
+	NextBlock    uint64 `json:"nextBlock,omitempty"`    // Block number of the next block interval activation
+	LastTask     string `json:"lastTask,omitempty"`     // Name of the task created by the last run
+	LastError    string `json:"lastError,omitempty"`    // Error of the last run which could not start
+
+	cron *cronExpr
+}
+
+// oneShot returns whether the schedule runs only once
+func (s *Schedule) oneShot() bool {
+	return s.cron == nil && s.EveryBlocks == 0
+}
+
+func (s *Schedule) validate() error {
+	if s.Name == "" {
+		return errors.New("schedule name is required")
+	}
+	triggers := 0
+	if s.Cron != "" {
+		cron, err := parseCron(s.Cron)
+		if err != nil {
+			return err
+		}
+		s.cron = cron
+		triggers++
+	}
+	if s.EveryBlocks > 0 {
+		triggers++
+	}
+	if s.At > 0 {
+		triggers++
+	}
+	if triggers > 1 {
+		return errors.New("only one of cron, everyBlocks and at can be set")
+	}
+	if triggers == 0 && len(s.After) == 0 {
+		return errors.New("schedule has no trigger")
+	}
+	for _, name := range s.After {
+		if name == s.Name {
+			return errors.New("schedule can not depend on itself")
+		}
+	}
+	if !s.oneShot() && s.Blocks == 0 && s.Options.EndBlock == 0 {
+		// every run would keep following the head block and never finish
+		return errors.New("recurring schedule requires blocks or an end block")
+	}
+	if len(s.Options.ProcessorNames) == 0 && !s.Options.GasProfile {
+		return errors.New("no processors provided")
+	}
+	return nil
+}
+
+// dependencyTimeout returns how long a triggered run waits for its dependencies and the previous run
+func (s *Schedule) dependencyTimeout() time.Duration {
+	if s.Timeout > 0 {
+		return time.Duration(s.Timeout) * time.Second
+	}
+	return defaultDependencyTimeout
+}
+
+// due returns whether the schedule should be triggered, then advances its next activation
+func (s *Schedule) due(now time.Time, head uint64) bool {
+	switch {
+	case s.cron != nil:
+		if s.NextRun == 0 {
+			s.NextRun = cronTimestamp(s.cron.Next(now))
+		}
+		if s.NextRun == 0 || now.Unix() < s.NextRun {
+			return false
+		}
+		s.NextRun = cronTimestamp(s.cron.Next(now))
+		return true
+	case s.EveryBlocks > 0:
+		if s.NextBlock == 0 {
+			s.NextBlock = head + s.EveryBlocks
+		}
+		if head < s.NextBlock {
+			return false
+		}
+		s.NextBlock = head + s.EveryBlocks
+		return true
+	default:
+		return s.Runs == 0 && s.Failures == 0 && now.Unix() >= s.At
+	}
+}
+
+// taskName returns the name of the task created by the next run, one-shot tasks are named after the schedule.
+// Runs which could not start created no task, so they do not take a run number.
+func (s *Schedule) taskName() string {
+	if s.oneShot() {
+		return s.Name
+	}
+	return fmt.Sprintf("%s#%d", s.Name, s.Runs+1)
+}
+
+// taskOptions returns the options of the task created by the next run
+func (s *Schedule) taskOptions(head uint64) *ReExecOptions {
+	opts := s.Options
+	opts.Name = s.taskName()
+	opts.ProcessorNames = append([]string{}, s.Options.ProcessorNames...)
+	opts.Processors = nil
+	if s.Blocks > 0 {
+		opts.EndBlock = head
+		opts.StartBlock = 1
+		if head > s.Blocks {
+			opts.StartBlock = head - s.Blocks + 1
+		}
+	}
+	return &opts
+}
+
+// cronTimestamp returns the unix timestamp of a cron activation, 0 if there is none
+func cronTimestamp(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// resolveDependency returns the name of the task a dependency refers to. Schedules refer
+// to the task of their latest run, an empty name is returned if the task is not created
+// yet. Must be called with scheduleMtx held.
+func (tm *TaskManager) resolveDependency(name string) (string, error) {
+	if s, exist := tm.schedules[name]; exist {
+		return s.LastTask, nil
+	}
+	if _, err := tm.TaskInfo(name); err == nil {
+		return name, nil
+	}
+	// a recurring schedule may not have reached the run yet
+	if idx := strings.LastIndex(name, "#"); idx > 0 {
+		run, err := strconv.ParseUint(name[idx+1:], 10, 64)
+		if s, exist := tm.schedules[name[:idx]]; exist && err == nil && !s.oneShot() && run > s.Runs {
+			return "", nil
+		}
+	}
+	return "", fmt.Errorf("dependency %s does not exist", name)
+}
+
+// dependencyStatus returns whether all dependencies finished successfully, or the error if a dependency did not.
+// Must be called with scheduleMtx held.
+func (tm *TaskManager) dependencyStatus(names []string) (bool, error) {
+	for _, dep := range names {
+		name, err := tm.resolveDependency(dep)
+		if err != nil {
+			return false, err
+		}
+		if name == "" {
+			return false, nil
+		}
+		info, err := tm.TaskInfo(name)
+		if err != nil {
+			return false, fmt.Errorf("dependency %s does not exist", name)
+		}
+		switch info.Status {
+		case StatusFinished:
+			continue
+		case StatusFailed, StatusStopped:
+			return false, fmt.Errorf("dependency %s %s", name, info.Status)
+		default:
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (tm *TaskManager) writeSchedule(s *Schedule) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		log.Error("Could not encode task schedule", "name", s.Name, "error", err)
+		return
+	}
+	extdb.WriteTaskSchedule(tm.db, s.Name, data)
+}
+
+// AddSchedule validates and persists a new schedule
+func (tm *TaskManager) AddSchedule(s *Schedule) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	tm.mtx.Lock()
+	for _, name := range s.Options.ProcessorNames {
+		if _, exist := tm.processors[name]; !exist {
+			tm.mtx.Unlock()
+			return fmt.Errorf("processor %s is not registered", name)
+		}
+	}
+	tm.mtx.Unlock()
+
+	tm.scheduleMtx.Lock()
+	defer tm.scheduleMtx.Unlock()
+	if _, exist := tm.schedules[s.Name]; exist {
+		return ErrScheduleExists
+	}
+	s.Runs, s.Failures, s.Pending, s.PendingSince, s.NextRun, s.NextBlock, s.LastTask, s.LastError = 0, 0, false, 0, 0, 0, "", ""
+	tm.schedules[s.Name] = s
+	tm.writeSchedule(s)
+	return nil
+}
+
+// RemoveSchedule deletes a schedule, tasks which were already created are not affected
+func (tm *TaskManager) RemoveSchedule(name string) error {
+	tm.scheduleMtx.Lock()
+	defer tm.scheduleMtx.Unlock()
+	if _, exist := tm.schedules[name]; !exist {
+		return ErrScheduleNotExists
+	}
+	delete(tm.schedules, name)
+	extdb.DeleteTaskSchedule(tm.db, name)
+	return nil
+}
+
+// Schedules returns all schedules ordered by name
+func (tm *TaskManager) Schedules() []Schedule {
+	tm.scheduleMtx.Lock()
+	defer tm.scheduleMtx.Unlock()
+	ret := make([]Schedule, 0, len(tm.schedules))
+	for _, s := range tm.schedules {
+		ret = append(ret, *s)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+func (tm *TaskManager) loadSchedules() {
+	tm.scheduleMtx.Lock()
+	defer tm.scheduleMtx.Unlock()
+	for _, data := range extdb.ReadAllTaskSchedules(tm.db) {
+		s := new(Schedule)
+		if err := json.Unmarshal(data, s); err != nil {
+			log.Error("Invalid task schedule", "error", err)
+			continue
+		}
+		if err := s.validate(); err != nil {
+			log.Error("Invalid task schedule", "name", s.Name, "error", err)
+			continue
+		}
+		tm.schedules[s.Name] = s
+	}
+}
+
+// startRun creates and runs the task of a schedule run
+func (tm *TaskManager) startRun(s *Schedule, head uint64) error {
+	opts := s.taskOptions(head)
+	task, err := tm.NewReExecTask(opts)
+	if err != nil {
+		return err
+	}
+	return tm.RunTask(opts.Name, task)
+}
+
+// runSchedules triggers due schedules and starts runs whose dependencies finished
+func (tm *TaskManager) runSchedules(now time.Time, head uint64) {
+	tm.scheduleMtx.Lock()
+	defer tm.scheduleMtx.Unlock()
+	for name, s := range tm.schedules {
+		var (
+			nextRun   = s.NextRun
+			nextBlock = s.NextBlock
+			triggered = !s.Pending && s.due(now, head)
+		)
+		if triggered {
+			s.Pending, s.PendingSince = true, now.Unix()
+		}
+		changed := triggered || s.NextRun != nextRun || s.NextBlock != nextBlock
+		if s.Pending {
+			var (
+				ready   bool
+				err     error
+				running bool
+			)
+			// wait while the previous run is still in progress
+			if s.LastTask != "" {
+				_, lastErr := tm.GetTask(s.LastTask)
+				running = lastErr == nil
+			}
+			if !running {
+				ready, err = tm.dependencyStatus(s.After)
+			}
+			if err == nil && !ready && now.Sub(time.Unix(s.PendingSince, 0)) >= s.dependencyTimeout() {
+				if running {
+					err = fmt.Errorf("previous run %s did not finish within %v", s.LastTask, s.dependencyTimeout())
+				} else {
+					err = fmt.Errorf("dependencies did not finish within %v", s.dependencyTimeout())
+				}
+			}
+			if err == nil && ready {
+				err = tm.startRun(s, head)
+				if err == nil {
+					s.LastTask = s.taskName()
+					s.LastError = ""
+					s.Runs++
+					log.Info("Started scheduled task", "schedule", name, "task", s.LastTask)
+				}
+			}
+			if err != nil {
+				log.Error("Could not start scheduled task", "schedule", name, "error", err)
+				s.LastError = err.Error()
+				s.Failures++
+			}
+			if ready || err != nil {
+				s.Pending, s.PendingSince = false, 0
+				changed = true
+			}
+		}
+		if !s.Pending && s.oneShot() && s.Runs+s.Failures > 0 {
+			delete(tm.schedules, name)
+			extdb.DeleteTaskSchedule(tm.db, name)
+			continue
+		}
+		if changed {
+			tm.writeSchedule(s)
+		}
+	}
+}
+
+func (tm *TaskManager) scheduleLoop() {
+	defer tm.wg.Done()
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+	headCh := make(chan core.ChainHeadEvent, 1)
+	headSub := tm.blockchain.SubscribeChainHeadEvent(headCh)
+	defer headSub.Unsubscribe()
+
+	head := tm.blockchain.CurrentBlock().NumberU64()
+	for {
+		select {
+		case <-ticker.C:
+			tm.runSchedules(time.Now(), head)
+		case ev := <-headCh:
+			head = ev.Block.NumberU64()
+			tm.runSchedules(time.Now(), head)
+		case <-tm.quitCh:
+			return
+		}
+	}
+}
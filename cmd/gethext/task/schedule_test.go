@@ -0,0 +1,230 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestScheduler returns a task manager with the processor "test" registered, schedules
+// are run by calling runSchedules
+func newTestScheduler(t *testing.T, n int) *TaskManager {
+	db, chain := newTestChain(t, n)
+	tm, err := NewTaskManager(rawdb.NewMemoryDatabase(), db, nil, chain, nil)
+	require.NoError(t, err)
+	require.NoError(t, tm.RegisterProcessor("test", &testProcessor{}))
+	t.Cleanup(tm.Stop)
+	return tm
+}
+
+func testOptions() ReExecOptions {
+	return ReExecOptions{ProcessorNames: []string{"test"}}
+}
+
+func schedule(t *testing.T, tm *TaskManager, name string) Schedule {
+	for _, s := range tm.Schedules() {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("schedule %s does not exist", name)
+	return Schedule{}
+}
+
+func waitFinished(t *testing.T, tm *TaskManager, name string) {
+	require.Eventually(t, func() bool {
+		info, err := tm.TaskInfo(name)
+		return err == nil && info.Status == StatusFinished
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestScheduleValidate(t *testing.T) {
+	tests := []struct {
+		schedule Schedule
+		err      string
+	}{
+		{Schedule{Cron: "@daily", Options: testOptions()}, "schedule name is required"},
+		{Schedule{Name: "a", Options: testOptions()}, "schedule has no trigger"},
+		{Schedule{Name: "a", Cron: "@daily", EveryBlocks: 10, Options: testOptions()}, "only one of cron, everyBlocks and at can be set"},
+		{Schedule{Name: "a", Cron: "* * *", Blocks: 1, Options: testOptions()}, "invalid cron expression"},
+		{Schedule{Name: "a", EveryBlocks: 10, After: []string{"a"}, Options: testOptions()}, "schedule can not depend on itself"},
+		{Schedule{Name: "a", EveryBlocks: 10, Options: testOptions()}, "recurring schedule requires blocks or an end block"},
+		{Schedule{Name: "a", Cron: "@daily", Options: testOptions()}, "recurring schedule requires blocks or an end block"},
+		{Schedule{Name: "a", EveryBlocks: 10, Blocks: 10}, "no processors provided"},
+		{Schedule{Name: "a", After: []string{"b"}, Options: testOptions()}, ""},
+		{Schedule{Name: "a", EveryBlocks: 10, Blocks: 10, Options: ReExecOptions{GasProfile: true}}, ""},
+		{Schedule{Name: "a", Cron: "@daily", Options: ReExecOptions{ProcessorNames: []string{"test"}, StartBlock: 1, EndBlock: 10}}, ""},
+	}
+	for _, test := range tests {
+		err := test.schedule.validate()
+		if test.err == "" {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorContains(t, err, test.err)
+		}
+	}
+}
+
+func TestScheduleDue(t *testing.T) {
+	now := time.Date(2023, 3, 15, 10, 30, 0, 0, time.UTC)
+
+	// block intervals start counting at the first check
+	s := &Schedule{Name: "blocks", EveryBlocks: 5}
+	assert.False(t, s.due(now, 10))
+	assert.Equal(t, uint64(15), s.NextBlock)
+	assert.False(t, s.due(now, 14))
+	assert.True(t, s.due(now, 16))
+	assert.Equal(t, uint64(21), s.NextBlock)
+
+	s = &Schedule{Name: "cron", Cron: "@hourly", Blocks: 1, Options: testOptions()}
+	require.NoError(t, s.validate())
+	assert.False(t, s.due(now, 0))
+	assert.Equal(t, now.Add(30*time.Minute).Unix(), s.NextRun)
+	assert.False(t, s.due(now.Add(29*time.Minute), 0))
+	assert.True(t, s.due(now.Add(30*time.Minute), 0))
+	assert.Equal(t, now.Add(90*time.Minute).Unix(), s.NextRun)
+
+	// an expression which never matches is never due
+	s = &Schedule{Name: "never", Cron: "0 0 30 2 *", Blocks: 1, Options: testOptions()}
+	require.NoError(t, s.validate())
+	assert.False(t, s.due(now, 0))
+	assert.False(t, s.due(now.Add(time.Hour), 0))
+
+	s = &Schedule{Name: "once", At: now.Add(time.Minute).Unix()}
+	assert.False(t, s.due(now, 0))
+	assert.True(t, s.due(now.Add(time.Minute), 0))
+	s.Runs++
+	assert.False(t, s.due(now.Add(time.Hour), 0))
+
+	// recurring runs process the last blocks up to the head
+	s = &Schedule{Name: "last", EveryBlocks: 5, Blocks: 3, Options: testOptions()}
+	opts := s.taskOptions(10)
+	assert.Equal(t, "last#1", opts.Name)
+	assert.Equal(t, []uint64{8, 10}, []uint64{opts.StartBlock, opts.EndBlock})
+	assert.Equal(t, uint64(1), s.taskOptions(2).StartBlock)
+}
+
+func TestScheduleRecurringDependency(t *testing.T) {
+	tm := newTestScheduler(t, 8)
+	now := time.Now()
+	require.NoError(t, tm.AddSchedule(&Schedule{Name: "base", EveryBlocks: 2, Blocks: 1, Options: testOptions()}))
+	require.NoError(t, tm.AddSchedule(&Schedule{Name: "latest", After: []string{"base"}, Options: testOptions(), Blocks: 1}))
+	require.NoError(t, tm.AddSchedule(&Schedule{Name: "second", After: []string{"base#2"}, Options: testOptions(), Blocks: 1}))
+
+	// the schedule has no run yet, dependent runs wait for it
+	tm.runSchedules(now, 4)
+	assert.True(t, schedule(t, tm, "latest").Pending)
+	assert.True(t, schedule(t, tm, "second").Pending)
+
+	tm.runSchedules(now, 6)
+	waitFinished(t, tm, "base#1")
+	tm.runSchedules(now, 6)
+
+	// a schedule dependency refers to its latest run, a run number waits for that run
+	waitFinished(t, tm, "latest")
+	assert.Len(t, tm.Schedules(), 2)
+	assert.True(t, schedule(t, tm, "second").Pending)
+
+	tm.runSchedules(now, 8)
+	waitFinished(t, tm, "base#2")
+	tm.runSchedules(now, 8)
+	waitFinished(t, tm, "second")
+	require.Len(t, tm.Schedules(), 1)
+	assert.Equal(t, uint64(2), schedule(t, tm, "base").Runs)
+}
+
+func TestScheduleDependencyFailure(t *testing.T) {
+	tm := newTestScheduler(t, 4)
+	now := time.Now()
+
+	// missing dependencies fail the run instead of waiting forever, failed runs take no run number
+	require.NoError(t, tm.AddSchedule(&Schedule{Name: "missing", EveryBlocks: 1, Blocks: 1, After: []string{"nothing"}, Options: testOptions()}))
+	tm.runSchedules(now, 1)
+	tm.runSchedules(now, 2)
+	s := schedule(t, tm, "missing")
+	assert.False(t, s.Pending)
+	assert.Zero(t, s.Runs)
+	assert.Equal(t, uint64(1), s.Failures)
+	assert.Equal(t, "missing#1", s.taskName())
+	assert.Equal(t, "dependency nothing does not exist", s.LastError)
+	require.NoError(t, tm.RemoveSchedule("missing"))
+
+	// runs which are not reached in time fail after the timeout
+	require.NoError(t, tm.AddSchedule(&Schedule{Name: "base", Cron: "@yearly", Blocks: 1, Options: testOptions()}))
+	require.NoError(t, tm.AddSchedule(&Schedule{Name: "slow", EveryBlocks: 1, Blocks: 1, After: []string{"base#1"}, Timeout: 60, Options: testOptions()}))
+	tm.runSchedules(now, 1)
+	tm.runSchedules(now, 2)
+	assert.True(t, schedule(t, tm, "slow").Pending)
+	tm.runSchedules(now.Add(59*time.Second), 2)
+	assert.True(t, schedule(t, tm, "slow").Pending)
+	tm.runSchedules(now.Add(time.Minute), 2)
+	s = schedule(t, tm, "slow")
+	assert.False(t, s.Pending)
+	assert.Zero(t, s.PendingSince)
+	assert.Equal(t, "dependencies did not finish within 1m0s", s.LastError)
+
+	// dependencies which did not finish successfully fail the run
+	opts := testOptions()
+	opts.Name, opts.StartBlock, opts.EndBlock = "stopped", 1, 1
+	task, err := tm.NewReExecTask(&opts)
+	require.NoError(t, err)
+	task.Abort()
+	require.NoError(t, tm.RunTask("stopped", task))
+	require.NoError(t, tm.AddSchedule(&Schedule{Name: "after", EveryBlocks: 1, Blocks: 1, After: []string{"stopped"}, Options: testOptions()}))
+	tm.runSchedules(now, 3)
+	tm.runSchedules(now, 4)
+	assert.Equal(t, "dependency stopped stopped", schedule(t, tm, "after").LastError)
+}
+
+func TestSchedulePreviousRunTimeout(t *testing.T) {
+	tm := newTestScheduler(t, 4)
+	now := time.Now()
+	live := newBarrierTasks(1)[0]
+	require.NoError(t, tm.RunTask("live", live))
+	require.NoError(t, tm.AddSchedule(&Schedule{Name: "follow", EveryBlocks: 1, Blocks: 1, Timeout: 60, Options: testOptions()}))
+	tm.scheduleMtx.Lock()
+	tm.schedules["follow"].LastTask = "live"
+	tm.scheduleMtx.Unlock()
+
+	// a triggered run waits for the previous run, until the timeout expires
+	tm.runSchedules(now, 1)
+	tm.runSchedules(now, 2)
+	assert.True(t, schedule(t, tm, "follow").Pending)
+	tm.runSchedules(now.Add(59*time.Second), 2)
+	assert.True(t, schedule(t, tm, "follow").Pending)
+	tm.runSchedules(now.Add(time.Minute), 2)
+	s := schedule(t, tm, "follow")
+	assert.False(t, s.Pending)
+	assert.Equal(t, "previous run live did not finish within 1m0s", s.LastError)
+	assert.Equal(t, []uint64{0, 1}, []uint64{s.Runs, s.Failures})
+	live.Abort()
+}
+
+func TestSchedulePersistence(t *testing.T) {
+	tm := newTestScheduler(t, 2)
+	require.NoError(t, tm.AddSchedule(&Schedule{Name: "nightly", Cron: "@daily", Blocks: 1, Options: testOptions()}))
+	assert.ErrorIs(t, tm.AddSchedule(&Schedule{Name: "nightly", Cron: "@daily", Blocks: 1, Options: testOptions()}), ErrScheduleExists)
+	assert.ErrorContains(t, tm.AddSchedule(&Schedule{Name: "other", Cron: "@daily", Blocks: 1, Options: ReExecOptions{ProcessorNames: []string{"unknown"}}}), "processor unknown is not registered")
+	tm.runSchedules(time.Now(), 1)
+	nextRun := schedule(t, tm, "nightly").NextRun
+	assert.NotZero(t, nextRun)
+
+	// schedules are restored with their next activation
+	restored, err := NewTaskManager(tm.db, tm.chaindb, nil, tm.blockchain, nil)
+	require.NoError(t, err)
+	restored.loadSchedules()
+	require.Len(t, restored.Schedules(), 1)
+	s := schedule(t, restored, "nightly")
+	assert.Equal(t, nextRun, s.NextRun)
+	assert.NotNil(t, restored.schedules["nightly"].cron)
+
+	require.NoError(t, restored.RemoveSchedule("nightly"))
+	assert.ErrorIs(t, restored.RemoveSchedule("nightly"), ErrScheduleNotExists)
+	restored, err = NewTaskManager(tm.db, tm.chaindb, nil, tm.blockchain, nil)
+	require.NoError(t, err)
+	restored.loadSchedules()
+	assert.Empty(t, restored.Schedules())
+}
@@ -0,0 +1,120 @@
+package main
+
+import "github.com/ethereum/go-ethereum/internal/web3ext"
+
+func init() {
+	web3ext.Modules["task"] = TaskJs
+	web3ext.Modules["plugin"] = PluginJs
+}
+
+const TaskJs = `
+web3._extend({
+	property: 'task',
+	methods: [
+		new web3._extend.Method({
+			name: 'get',
+			call: 'task_get',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'start',
+			call: 'task_start',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'pause',
+			call: 'task_pause',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'resume',
+			call: 'task_resume',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'kill',
+			call: 'task_kill',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'gasProfile',
+			call: 'task_gasProfile',
+			params: 3
+		}),
+		new web3._extend.Method({
+			name: 'gasProfileFolded',
+			call: 'task_gasProfileFolded',
+			params: 3
+		}),
+		new web3._extend.Method({
+			name: 'schedule',
+			call: 'task_schedule',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'unschedule',
+			call: 'task_unschedule',
+			params: 1
+		}),
+	],
+	properties: [
+		new web3._extend.Property({
+			name: 'list',
+			getter: 'task_list'
+		}),
+		new web3._extend.Property({
+			name: 'schedules',
+			getter: 'task_schedules'
+		}),
+	]
+});
+`
+
+const PluginJs = `
+web3._extend({
+	property: 'plugin',
+	methods: [
+		new web3._extend.Method({
+			name: 'enable',
+			call: 'plugin_enable',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'disable',
+			call: 'plugin_disable',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'restart',
+			call: 'plugin_restart',
+			params: 1
+		}),
+		new web3._extend.Method({
+			name: 'reloadConfig',
+			call: 'plugin_reloadConfig',
+			params: 0
+		}),
+		new web3._extend.Method({
+			name: 'setLogLevel',
+			call: 'plugin_setLogLevel',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'logs',
+			call: 'plugin_logs',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'rescan',
+			call: 'plugin_rescan',
+			params: 0
+		}),
+	],
+	properties: [
+		new web3._extend.Property({
+			name: 'list',
+			getter: 'plugin_list'
+		}),
+	]
+});
+`